@@ -0,0 +1,106 @@
+package vhoster
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backend returns the test server, that responds with the body.
+func backend(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// getBody requests the host through the gateway and returns the status code
+// and the body.
+func getBody(t *testing.T, g *Gateway, host string) (int, string) {
+	t.Helper()
+	resp, err := get(g, host)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(b)
+}
+
+func TestGateway_aliases(t *testing.T) {
+	v1, v2 := backend(t, "v1"), backend(t, "v2")
+	g := testGateway(t)
+
+	h := withAliases(testHost("example.com", v1.URL), "www.example.com", "old.example.com")
+	require.NoError(t, g.Apply(Op{Action: ActionAdd, Host: h}))
+	assert.Equal(t, []Host{h}, g.List())
+	for _, name := range []string{"example.com", "www.example.com", "old.example.com"} {
+		code, body := getBody(t, g, name)
+		assert.Equal(t, http.StatusOK, code, name)
+		assert.Equal(t, "v1", body, name)
+	}
+
+	t.Run("conflicts are detected across aliases", func(t *testing.T) {
+		for _, h := range []Host{
+			testHost("www.example.com", v2.URL),
+			withAliases(testHost("other.example.com", v2.URL), "old.example.com"),
+			withAliases(testHost("other.example.com", v2.URL), "example.com"),
+		} {
+			assert.ErrorIs(t, g.Apply(Op{Action: ActionAdd, Host: h}), ErrAlreadyExists, h.Name)
+		}
+		assert.Len(t, g.List(), 1)
+		code, _ := getBody(t, g, "other.example.com")
+		assert.Equal(t, http.StatusNotFound, code, "partially registered host is cleaned up")
+	})
+	t.Run("aliases exist", func(t *testing.T) {
+		for _, name := range []string{"example.com", "WWW.example.com", "old.example.com"} {
+			assert.True(t, g.Exists(name), name)
+		}
+		assert.False(t, g.Exists("other.example.com"))
+	})
+	t.Run("replace updates all aliases", func(t *testing.T) {
+		require.NoError(t, g.Replace("example.com", Must(Parse(v2.URL)).URL()))
+		for _, name := range []string{"example.com", "www.example.com", "old.example.com"} {
+			_, body := getBody(t, g, name)
+			assert.Equal(t, "v2", body, name)
+		}
+		assert.Equal(t, []string{"www.example.com", "old.example.com"}, g.List()[0].Aliases)
+	})
+	t.Run("failed replace keeps the host", func(t *testing.T) {
+		require.NoError(t, g.Add("taken.example.com", Must(Parse(v1.URL)).URL()))
+		err := g.Apply(Op{Action: ActionReplace, Host: withAliases(testHost("example.com", v1.URL), "taken.example.com")})
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		_, body := getBody(t, g, "www.example.com")
+		assert.Equal(t, "v2", body)
+		require.NoError(t, g.Remove("taken.example.com"))
+	})
+	t.Run("aliases are removed together", func(t *testing.T) {
+		require.NoError(t, g.Remove("example.com"))
+		for _, name := range []string{"example.com", "www.example.com", "old.example.com"} {
+			code, _ := getBody(t, g, name)
+			assert.Equal(t, http.StatusNotFound, code, name)
+		}
+		// the names are free again.
+		assert.NoError(t, g.Add("www.example.com", Must(Parse(v1.URL)).URL()))
+	})
+}
+
+func TestHost_Validate_aliases(t *testing.T) {
+	assert.Error(t, withAliases(testHost("a.example.com", "http://a"), "").Validate())
+	assert.Error(t, withAliases(testHost("a.example.com", "http://a"), "A.example.com").Validate())
+	assert.Error(t, withAliases(testHost("a.example.com", "http://a"), "b.example.com", "b.example.com").Validate())
+	assert.NoError(t, withAliases(testHost("a.example.com", "http://a"), "b.example.com").Validate())
+}
+
+func TestNew_preconfiguredAliases(t *testing.T) {
+	srv := backend(t, "ok")
+	g := testGateway(t, withAliases(testHost("example.com", srv.URL), "www.example.com"))
+	code, body := getBody(t, g, "www.example.com")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body)
+}
@@ -1,30 +1,60 @@
 package apiserver
 
 import (
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
-	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/audit"
 )
 
-func Run(vg HostManager, apiAddr, pubAddr string) error {
-	gw := &gateway{
-		addr: pubAddr,
-		vg:   vg,
+// Run starts the API server on apiAddr and blocks until it fails.  Use
+// New to be able to shut the server down.
+func Run(vg HostManager, apiAddr, pubAddr string, opts ...Option) error {
+	return New(vg, apiAddr, pubAddr, opts...).ListenAndServe()
+}
+
+// Option is a functional option for the API server.
+type Option func(*gateway)
+
+// WithDocs enables the Swagger UI page on /docs/ that renders the OpenAPI
+// specification of the API.
+func WithDocs(enabled bool) Option {
+	return func(g *gateway) {
+		g.docs = enabled
 	}
-	return http.ListenAndServe(apiAddr, gw.handler())
 }
 
 func (g *gateway) handler() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/vhost/", Only(g.handleVhost, http.MethodPost, http.MethodDelete, http.MethodGet, http.MethodPatch))
-	mux.HandleFunc("/random/", Only(g.handleRandom, http.MethodPost))
+	mux.HandleFunc("/vhost/", Only(g.audited(g.handleVhost), http.MethodPost, http.MethodDelete, http.MethodGet, http.MethodPatch, http.MethodPut))
+	mux.HandleFunc("/random/", Only(g.audited(g.handleRandom), http.MethodPost))
+	mux.HandleFunc("/batch/", Only(g.audited(g.handleBatch), http.MethodPost))
+	mux.HandleFunc("/history/", Only(g.handleHistory, http.MethodGet))
+	mux.HandleFunc("/watch/", Only(g.handleWatch, http.MethodGet))
+	mux.HandleFunc("/rollback/", Only(g.audited(g.handleRollback), http.MethodPost))
+	mux.HandleFunc("/extend/", Only(g.audited(g.handleExtend), http.MethodPost))
+	mux.HandleFunc("/lease/", Only(g.handleLease, http.MethodPost, http.MethodDelete))
+	mux.HandleFunc("/fallback/", Only(g.audited(g.handleFallback), http.MethodGet, http.MethodPut, http.MethodDelete))
+	if g.audit != nil {
+		mux.HandleFunc("/audit/", Only(g.handleAudit, http.MethodGet))
+	}
+	if g.upgrade != nil {
+		mux.HandleFunc("/upgrade/", Only(g.audited(g.handleUpgrade), http.MethodPost))
+	}
 	mux.HandleFunc("/health/", Only(g.handleHealth, http.MethodGet))
+	mux.HandleFunc("/ready/", Only(g.handleReady, http.MethodGet))
+	mux.HandleFunc("/openapi.json", Only(g.handleOpenAPI, http.MethodGet))
+	if g.docs {
+		mux.HandleFunc("/docs/", Only(g.handleDocs, http.MethodGet))
+	}
 	return mux
 }
 
@@ -35,20 +65,62 @@ type HostManager interface {
 	Replace(string, *url.URL) error
 	List() []vhoster.Host
 	Exists(string) bool
+	Apply(...vhoster.Op) error
+	History() []vhoster.Revision
+	Rollback(int64, string) ([]vhoster.Revision, error)
+	SetFallback(*url.URL) error
+	Fallback() *vhoster.URI
+	Extend(string, time.Duration, string) (vhoster.Host, error)
+	Renew(string) (vhoster.Host, error)
+	Revoke(string, string) (vhoster.Host, error)
+	Revision() int64
+	Watch(context.Context, int64) (<-chan vhoster.Revision, error)
 }
 
 type gateway struct {
-	addr string
-	vg   HostManager
+	addr        string
+	vg          HostManager
+	docs        bool          // serve the Swagger UI page
+	audit       *audit.Log    // optional audit log
+	upgrade     func() error  // optional upgrade trigger
+	draining    atomic.Bool   // the gateway is shutting down
+	auditFailed atomic.Bool   // the last audit log entry was not written
+	closing     chan struct{} // closed on shutdown to end the event streams
+
+	generators map[string]Generator // custom generators of the random names
+	defaultGen string               // default generator name
+	reserved   map[string]bool      // additional reserved words
+
+	reservedNames map[string]bool       // prefixes that can't be claimed, nil means the default ones
+	policy        *vhoster.TargetPolicy // optional target policy
 }
 
 type AddRequest struct {
 	HostPrefix string `json:"host_prefix,omitempty"`
 	Target     string `json:"target,omitempty"`
+	// Aliases are the other names of the host, given either as prefixes or
+	// as full names.  On replace, if Aliases is omitted, the existing aliases
+	// are kept.
+	Aliases []string `json:"aliases,omitempty"`
+	// TTL is the time to live of the host, after which it's removed.  On
+	// replace, if TTL is omitted, the existing expiry time is kept.
+	TTL Duration `json:"ttl,omitempty"`
+	// Lease is the lease interval.  If set, the host gets a lease, that must
+	// be renewed within the interval, otherwise the host is removed.  It
+	// can't be combined with TTL.
+	Lease Duration `json:"lease,omitempty"`
+	// Labels are the labels of the host, that can be used to select it.  On
+	// replace, if Labels is omitted, the existing labels are kept.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are the free-form attributes of the host.  On replace, if
+	// Annotations is omitted, the existing annotations are kept.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type AddResponse struct {
-	Hostname string `json:"hostname,omitempty"`
+	Hostname string     `json:"hostname,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	LeaseID  string     `json:"lease_id,omitempty"`
 }
 
 func Only(h http.HandlerFunc, methods ...string) http.HandlerFunc {
@@ -78,6 +150,13 @@ func (g *gateway) handleVhost(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		// list
 		g.handleList(w, r)
+	case http.MethodPut:
+		// sync
+		if vhostName(r) != "" {
+			http.Error(w, "400 sync is only allowed on the collection", http.StatusBadRequest)
+			return
+		}
+		g.handleSync(w, r)
 	}
 }
 
@@ -94,7 +173,7 @@ func (g *gateway) handleAdd(w http.ResponseWriter, r *http.Request) {
 		httStatus(w, http.StatusBadRequest)
 		return
 	}
-	g.process(w, r, &req, g.vg.Add)
+	g.process(w, r, &req, vhoster.ActionAdd)
 }
 
 type ReplaceRequest AddRequest
@@ -109,30 +188,20 @@ func (g *gateway) handleReplace(w http.ResponseWriter, r *http.Request) {
 		httStatus(w, http.StatusBadRequest)
 		return
 	}
-	g.process(w, r, (*AddRequest)(&req), g.vg.Replace)
+	g.process(w, r, (*AddRequest)(&req), vhoster.ActionReplace)
 }
 
-func (g *gateway) process(w http.ResponseWriter, r *http.Request, req *AddRequest, fn func(string, *url.URL) error) {
-	if req.Target == "" {
-		log.Print("missing target")
-		http.Error(w, "400 missing target", http.StatusBadRequest)
-		return
-	}
-	uri, err := url.Parse(req.Target)
+// process validates the request and applies the action to the host manager
+// on behalf of the caller.
+func (g *gateway) process(w http.ResponseWriter, r *http.Request, req *AddRequest, action vhoster.Action) {
+	h, err := g.newHost(r.Context(), req, action)
 	if err != nil {
-		log.Print("error parsing the target hostname:", err)
-		http.Error(w, "400 invalid target", http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
-
-	vhost := g.withDomain(req.HostPrefix)
-	if _, err := url.Parse(vhost); err != nil {
-		log.Printf("error parsing the resulting hostname %q: %s", vhost, err)
-		http.Error(w, "400 invalid host prefix", http.StatusBadRequest)
-		return
-	}
-	if err := fn(vhost, uri); err != nil {
-		log.Printf("error adding host %q: %s", vhost, err)
+	op := vhoster.Op{Action: action, Host: h, Actor: actor(r)}
+	if err := g.vg.Apply(op); err != nil {
+		log.Printf("error adding host %q: %s", h.Name, err)
 		if errors.Is(err, vhoster.ErrAlreadyExists) {
 			http.Error(w, "409 host already exists", http.StatusConflict)
 			return
@@ -140,80 +209,288 @@ func (g *gateway) process(w http.ResponseWriter, r *http.Request, req *AddReques
 		httStatus(w, http.StatusInternalServerError)
 		return
 	}
+	writeJSON(w, h.Name, addResponse(h))
+}
+
+// newHost validates the request and returns the host to apply the action
+// to.  The returned error is an *httpError, if it's caused by the request.
+func (g *gateway) newHost(ctx context.Context, req *AddRequest, action vhoster.Action) (vhoster.Host, error) {
+	uri, err := parseTarget(req.Target)
+	if err != nil {
+		return vhoster.Host{}, err
+	}
+	if err := g.checkTarget(ctx, uri); err != nil {
+		log.Print(err)
+		return vhoster.Host{}, err
+	}
+
+	prefix, err := hostPrefix(req.HostPrefix)
+	if err != nil {
+		log.Print(err)
+		return vhoster.Host{}, &httpError{http.StatusBadRequest, err.Error()}
+	}
+	vhost, err := vhoster.NormalizeName(g.withDomain(prefix))
+	if err != nil {
+		log.Print(err)
+		return vhoster.Host{}, &httpError{http.StatusBadRequest, err.Error()}
+	}
+	var prev *vhoster.Host
+	if action == vhoster.ActionReplace {
+		prev = hostByName(g.vg.List(), vhost)
+	}
+	return g.buildHost(vhost, uri, req, prev)
+}
+
+// parseTarget parses the target of the request.  The returned error is an
+// *httpError.
+func parseTarget(target string) (*url.URL, error) {
+	if target == "" {
+		log.Print("missing target")
+		return nil, &httpError{http.StatusBadRequest, "missing target"}
+	}
+	uri, err := url.Parse(target)
+	if err != nil {
+		log.Print("error parsing the target hostname:", err)
+		return nil, &httpError{http.StatusBadRequest, "invalid target"}
+	}
+	return uri, nil
+}
+
+// buildHost returns the host with the name and the target, that is described
+// by the request, and replaces prev, if it's not nil.  The expiry, the lease
+// and the pinned state of prev are kept, as well as its aliases, labels and
+// annotations, that are omitted in the request.  The target is not checked
+// against the target policy.  The returned error is an *httpError, if it's
+// caused by the request.
+func (g *gateway) buildHost(vhost string, uri *url.URL, req *AddRequest, prev *vhoster.Host) (vhoster.Host, error) {
+	var err error
+	if req.TTL < 0 || req.Lease < 0 {
+		log.Printf("negative ttl or lease for %q", vhost)
+		return vhoster.Host{}, &httpError{http.StatusBadRequest, vhoster.ErrInvalidTTL.Error()}
+	}
+	if req.TTL > 0 && req.Lease > 0 {
+		log.Printf("both ttl and lease are set for %q", vhost)
+		return vhoster.Host{}, &httpError{http.StatusBadRequest, "ttl and lease are mutually exclusive"}
+	}
+	h := vhoster.Host{Name: vhost, URI: vhoster.ToURI(uri)}
+	if req.Aliases != nil {
+		if h.Aliases, err = g.aliasNames(req.Aliases); err != nil {
+			log.Print(err)
+			return vhoster.Host{}, &httpError{http.StatusBadRequest, err.Error()}
+		}
+	} else if prev != nil {
+		h.Aliases = prev.Aliases
+	}
+	h.Labels, h.Annotations = req.Labels, req.Annotations
+	if prev != nil {
+		// the hosts from the config file stay pinned.
+		h.Pinned = prev.Pinned
+		if req.Labels == nil {
+			h.Labels = prev.Labels
+		}
+		if req.Annotations == nil {
+			h.Annotations = prev.Annotations
+		}
+	}
+	switch {
+	case req.Lease > 0:
+		if h.Lease, err = vhoster.NewLease(time.Duration(req.Lease)); err != nil {
+			log.Print(err)
+			return vhoster.Host{}, err
+		}
+		expires := time.Now().Add(h.Lease.Interval).UTC()
+		h.Expires = &expires
+	case req.TTL > 0:
+		expires := time.Now().Add(time.Duration(req.TTL)).UTC()
+		h.Expires = &expires
+	case prev != nil:
+		h.Expires, h.Lease = prev.Expires, prev.Lease
+	}
+	if err := h.Validate(); err != nil {
+		log.Printf("invalid host %q: %s", vhost, err)
+		return vhoster.Host{}, &httpError{http.StatusBadRequest, err.Error()}
+	}
+	// the names of the replaced host are not claimed again.
+	var claimed []string
+	for _, name := range append([]string{h.Name}, h.Aliases...) {
+		if prev == nil || findHost([]vhoster.Host{*prev}, name) == nil {
+			claimed = append(claimed, name)
+		}
+	}
+	if err := g.checkReserved(claimed...); err != nil {
+		log.Print(err)
+		return vhoster.Host{}, err
+	}
+	return h, nil
+}
+
+// httpError is the error caused by the request, that is returned to the
+// caller with the status code.
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string {
+	return strconv.Itoa(e.code) + " " + e.msg
+}
+
+// writeError writes the *httpError to the response, and any other error as
+// the internal server error.
+func writeError(w http.ResponseWriter, err error) {
+	var he *httpError
+	if errors.As(err, &he) {
+		http.Error(w, he.Error(), he.code)
+		return
+	}
+	httStatus(w, http.StatusInternalServerError)
+}
+
+// writeJSON encodes the response for the vhost.
+func writeJSON(w http.ResponseWriter, vhost string, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(AddResponse{Hostname: vhost}); err != nil {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
 		log.Printf("error encoding response for vhost %q: %s", vhost, err)
 		httStatus(w, http.StatusInternalServerError)
 		return
 	}
 }
 
+// addResponse returns the response for the added host.
+func addResponse(h vhoster.Host) AddResponse {
+	resp := AddResponse{Hostname: h.Name, Expires: h.Expires}
+	if h.Lease != nil {
+		resp.LeaseID = h.Lease.ID
+	}
+	return resp
+}
+
 func (g *gateway) withDomain(hostprefix string) string {
 	return hostprefix + "." + g.addr
 }
 
 func (g *gateway) handleList(w http.ResponseWriter, r *http.Request) {
 	vHost := vhostName(r)
-	hosts := g.vg.List()
 	if vHost == "" {
-		g.listHosts(w, hosts)
+		g.handleListPage(w, r)
 		return
 	}
-	fullName := g.withDomain(vHost)
+	hosts := g.vg.List()
+	if h := findHost(hosts, g.candidates(vHost)...); h != nil {
+		g.listHosts(w, []vhoster.Host{*h})
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// hostByName returns the host with the name, aliases are not matched.
+func hostByName(hosts []vhoster.Host, name string) *vhoster.Host {
 	for _, h := range hosts {
-		if h.Name == fullName || h.Name == vHost {
-			g.listHosts(w, []vhoster.Host{h})
-			return
+		if h.Name == name {
+			return &h
 		}
 	}
-	http.NotFound(w, r)
+	return nil
+}
+
+// findHost returns the host, that has one of the names as its name or alias.
+func findHost(hosts []vhoster.Host, names ...string) *vhoster.Host {
+	for _, h := range hosts {
+		for _, hn := range append([]string{h.Name}, h.Aliases...) {
+			for _, name := range names {
+				if hn == name {
+					return &h
+				}
+			}
+		}
+	}
+	return nil
 }
 
 // ListResponse is a response for the list request.
 type ListResponse struct {
 	Hosts []vhoster.Host `json:"hosts,omitempty"`
+	// NextCursor is the cursor of the next page, empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // listHosts encodes the list of hosts to the response.
 func (g *gateway) listHosts(w http.ResponseWriter, hosts []vhoster.Host) {
+	g.writeList(w, ListResponse{Hosts: hosts})
+}
+
+// writeList encodes the list response.
+func (g *gateway) writeList(w http.ResponseWriter, resp ListResponse) {
+	resp.Hosts = withoutLeases(resp.Hosts)
 	w.Header().Set("Content-Type", "application/json")
-	var resp = ListResponse{
-		Hosts: hosts,
-	}
 	json.NewEncoder(w).Encode(resp)
 }
 
 type RandomResponse struct {
 	AddResponse
+	// Generator is the name of the generator of the host prefix.
+	Generator string `json:"generator,omitempty"`
 }
 
 type RandomRequest struct {
-	Target string `json:"target,omitempty"`
+	Target string   `json:"target,omitempty"`
+	TTL    Duration `json:"ttl,omitempty"`
+	Lease  Duration `json:"lease,omitempty"`
+	// Generator is the name of the generator of the host prefix, if empty,
+	// the default one is used.
+	Generator string `json:"generator,omitempty"`
+	// Labels and Annotations are set on the host.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // handleRandom creates a random hostname and adds it to the gateway
-// it returns the hostname
+// it returns the hostname.  Reserved and taken names are regenerated.
 func (g *gateway) handleRandom(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	// generate a random uuid without using external libs
-	h := randString(16)
 	var req RandomRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Print("error decoding body:", err)
 		http.Error(w, "error decoding body", http.StatusBadRequest)
 		return
 	}
-	g.process(w, r, &AddRequest{HostPrefix: h, Target: req.Target}, g.vg.Add)
-}
-
-var randString = func(n int) string {
-	b := make([]byte, n)
-	for i := 0; i < n; i++ {
-		b[i] = byte(rand.Intn(256))
+	genName, gen, err := g.generator(req.Generator)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+		return
 	}
-
-	return hex.EncodeToString(b)
+	for i := 0; i < maxRandomAttempts; i++ {
+		prefix, err := gen()
+		if err != nil {
+			log.Printf("generator %q: %s", genName, err)
+			httStatus(w, http.StatusInternalServerError)
+			return
+		}
+		if g.isReserved(prefix) {
+			continue
+		}
+		h, err := g.newHost(r.Context(), &AddRequest{HostPrefix: prefix, Target: req.Target, TTL: req.TTL, Lease: req.Lease, Labels: req.Labels, Annotations: req.Annotations}, vhoster.ActionAdd)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		err = g.vg.Apply(vhoster.Op{Action: vhoster.ActionAdd, Host: h, Actor: actor(r)})
+		if errors.Is(err, vhoster.ErrAlreadyExists) {
+			log.Printf("random host %q is taken, retrying", h.Name)
+			continue
+		}
+		if err != nil {
+			log.Printf("error adding host %q: %s", h.Name, err)
+			httStatus(w, http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, h.Name, RandomResponse{AddResponse: addResponse(h), Generator: genName})
+		return
+	}
+	log.Printf("no free host name after %d attempts with generator %q", maxRandomAttempts, genName)
+	http.Error(w, "409 could not generate a free host name", http.StatusConflict)
 }
 
 func (g *gateway) handleHealth(w http.ResponseWriter, _ *http.Request) {
@@ -227,18 +504,29 @@ func vhostName(r *http.Request) string {
 func (g *gateway) handleRemove(w http.ResponseWriter, r *http.Request) {
 	// remove
 	vhost := vhostName(r)
+	if vhost == "" && r.URL.Query().Has("selector") {
+		g.handleRemoveSelected(w, r)
+		return
+	}
 	if vhost == "" {
 		log.Print("got empty vhost")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	var err error
-	if g.vg.Exists(vhost) {
-		err = g.vg.Remove(vhost)
-	} else if g.vg.Exists(vhost + "." + g.addr) {
-		err = g.vg.Remove(vhost + "." + g.addr)
-	} else {
-		err = vhoster.ErrNotFound
+	err := vhoster.ErrNotFound
+	for _, name := range g.candidates(vhost) {
+		if !g.vg.Exists(name) {
+			continue
+		}
+		// the alias is removed with its host, or by replacing the host
+		// without it.
+		if h := findHost(g.vg.List(), name); h != nil && h.Name != name {
+			log.Printf("%q is an alias of %q", name, h.Name)
+			http.Error(w, "400 cannot delete an alias, remove or replace the host "+h.Name, http.StatusBadRequest)
+			return
+		}
+		err = g.remove(r, name)
+		break
 	}
 	if err != nil {
 		log.Print("error removing host:", err)
@@ -247,3 +535,8 @@ func (g *gateway) handleRemove(w http.ResponseWriter, r *http.Request) {
 	}
 	httStatus(w, http.StatusOK)
 }
+
+// remove removes the host on behalf of the caller.
+func (g *gateway) remove(r *http.Request, vhost string) error {
+	return g.vg.Apply(vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: vhost}, Actor: actor(r)})
+}
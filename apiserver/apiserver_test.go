@@ -3,9 +3,11 @@ package apiserver
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
 	"github.com/rusq/vhoster/mocks"
 	"github.com/stretchr/testify/assert"
 )
@@ -30,10 +32,20 @@ func TestHandleRemove(t *testing.T) {
 			mockFn: func(mc *mocks.MockHostManager) {
 				mc.EXPECT().Exists("test").Return(false)
 				mc.EXPECT().Exists("test.example.com").Return(true)
-				mc.EXPECT().Remove("test.example.com").Return(nil)
+				mc.EXPECT().List().Return([]vhoster.Host{{Name: "test.example.com"}})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: "test.example.com"}}).Return(nil)
 			},
 			statusCode: http.StatusOK,
 		},
+		{
+			name:  "alias",
+			vhost: "web.example.com",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Exists("web.example.com").Return(true)
+				mc.EXPECT().List().Return([]vhoster.Host{{Name: "test.example.com", Aliases: []string{"web.example.com"}}})
+			},
+			statusCode: http.StatusBadRequest,
+		},
 		{
 			name:       "bad request",
 			vhost:      "",
@@ -83,3 +95,120 @@ func TestHandleRemove(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleAliases(t *testing.T) {
+	uri := vhoster.Must(vhoster.Parse("http://localhost:8082"))
+	existing := vhoster.Host{Name: "test.example.com", Aliases: []string{"web.example.com"}, URI: vhoster.Must(vhoster.Parse("http://localhost:8081"))}
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		wantBody   string
+	}{
+		{
+			name:   "add with aliases",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://localhost:8082","aliases":["web","example.com","old.example.com"]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionAdd, Host: vhoster.Host{
+					Name:    "test.example.com",
+					Aliases: []string{"web.example.com", "example.com", "old.example.com"},
+					URI:     uri,
+				}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "duplicate alias",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"test","target":"http://localhost:8082","aliases":["test"]}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "alias conflict",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"new","target":"http://localhost:8082","aliases":["web"]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(gomock.Any()).Return(&vhoster.OpError{Err: vhoster.ErrAlreadyExists})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:   "replace keeps the aliases",
+			method: http.MethodPatch,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://localhost:8082"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{existing})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionReplace, Host: vhoster.Host{
+					Name:    "test.example.com",
+					Aliases: []string{"web.example.com"},
+					URI:     uri,
+				}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "replace clears the aliases",
+			method: http.MethodPatch,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://localhost:8082","aliases":[]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{{Name: "test.example.com", Aliases: []string{"web.example.com"}, URI: uri}})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionReplace, Host: vhoster.Host{
+					Name:    "test.example.com",
+					Aliases: []string{},
+					URI:     uri,
+				}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "replace keeps the config host pinned",
+			method: http.MethodPatch,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://localhost:8082"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{{Name: "test.example.com", URI: uri, Pinned: true}})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionReplace, Host: vhoster.Host{
+					Name:   "test.example.com",
+					URI:    uri,
+					Pinned: true,
+				}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "get by alias",
+			method: http.MethodGet,
+			path:   "/vhost/web",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{existing})
+			},
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"test.example.com","aliases":["web.example.com"],"uri":"http://localhost:8081"}]}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
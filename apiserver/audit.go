@@ -0,0 +1,289 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rusq/vhoster/audit"
+)
+
+const (
+	// maxAuditBody is the maximum size of the request body recorded in the
+	// audit log.
+	maxAuditBody = 64 << 10
+	// maxAuditResult is the maximum size of the error response recorded in
+	// the audit log.
+	maxAuditResult = 512
+	// defaultAuditLimit is the default number of entries returned by the
+	// audit endpoint.
+	defaultAuditLimit = 100
+)
+
+// WithAudit enables recording of all changes made through the API in the
+// audit log, and the endpoint to query it.
+func WithAudit(l *audit.Log) Option {
+	return func(g *gateway) {
+		g.audit = l
+	}
+}
+
+// AuditResponse is the response for the audit query.
+type AuditResponse struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
+// audited wraps the handler and records every request, that may change the
+// route table, in the audit log.  The response is sent once the request is
+// recorded.  If the entry can't be written, the caller gets 500 instead, as
+// the change is not accounted for, and the readiness endpoint reports that
+// the gateway is not ready, until an entry is written again.
+func (g *gateway) audited(h http.HandlerFunc) http.HandlerFunc {
+	if g.audit == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h(w, r)
+			return
+		}
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+			if err != nil {
+				log.Print("audit: error reading the request body:", err)
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+
+		entry := audit.Entry{
+			Actor:    actor(r),
+			SourceIP: remoteIP(r),
+			Method:   r.Method,
+			Path:     r.URL.RequestURI(),
+			Hosts:    g.affectedHosts(r, body, rec.body.Bytes()),
+			Request:  jsonBody(body),
+			Status:   rec.status,
+			Result:   "ok",
+		}
+		if rec.status >= http.StatusBadRequest {
+			entry.Result = strings.TrimSpace(rec.body.String())
+			if len(entry.Result) > maxAuditResult {
+				entry.Result = entry.Result[:maxAuditResult]
+			}
+		}
+		if _, err := g.audit.Append(entry); err != nil {
+			log.Print("audit: error writing the entry:", err)
+			g.auditFailed.Store(true)
+			http.Error(w, "500 error writing the audit log, the request is not recorded", http.StatusInternalServerError)
+			return
+		}
+		g.auditFailed.Store(false)
+		rec.flush()
+	}
+}
+
+// handleAudit returns the recent audit log entries.  Entries can be filtered
+// by the host name with the "host" query parameter, and by time with "since"
+// and "until" parameters in RFC3339 format.  The "limit" parameter sets the
+// maximum number of returned entries.
+func (g *gateway) handleAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := audit.Filter{Limit: defaultAuditLimit}
+	if host := q.Get("host"); host != "" {
+		f.Host = g.fullName(host)
+	}
+	var err error
+	if f.Since, err = parseTime(q.Get("since")); err != nil {
+		http.Error(w, "400 invalid since parameter", http.StatusBadRequest)
+		return
+	}
+	if f.Until, err = parseTime(q.Get("until")); err != nil {
+		http.Error(w, "400 invalid until parameter", http.StatusBadRequest)
+		return
+	}
+	if s := q.Get("limit"); s != "" {
+		if f.Limit, err = strconv.Atoi(s); err != nil || f.Limit < 0 {
+			http.Error(w, "400 invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	entries, err := g.audit.Query(f)
+	if err != nil {
+		log.Print("audit: error querying the log:", err)
+		httStatus(w, http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(AuditResponse{Entries: entries}); err != nil {
+		log.Print("error encoding audit response:", err)
+	}
+}
+
+// affectedHosts returns the full names of the hosts mentioned in the request
+// path, the request body and the response body.
+func (g *gateway) affectedHosts(r *http.Request, reqBody, respBody []byte) []string {
+	var (
+		hosts []string
+		seen  = make(map[string]struct{})
+	)
+	addHost := func(name string) {
+		if name == "" {
+			return
+		}
+		name = g.fullName(name)
+		if _, ok := seen[name]; ok {
+			return
+		}
+		seen[name] = struct{}{}
+		hosts = append(hosts, name)
+	}
+	if strings.HasPrefix(r.URL.Path, "/vhost/") {
+		addHost(vhostName(r))
+	}
+	for _, b := range [][]byte{reqBody, respBody} {
+		var f hostFields
+		// the fields of the wrong type are skipped, and the rest are decoded.
+		_ = json.Unmarshal(b, &f)
+		f.names(addHost)
+	}
+	return hosts
+}
+
+// hostFields are the fields of the API requests and responses, that contain
+// the host names.  The labels, the annotations and the other free-form data
+// is never taken for the host names.
+type hostFields struct {
+	HostPrefix string      `json:"host_prefix"` // add and replace requests
+	Aliases    []string    `json:"aliases"`     // add and replace requests
+	Hostname   string      `json:"hostname"`    // add, extend and lease responses
+	Hosts      []namedHost `json:"hosts"`       // sync request
+	Ops        []struct {
+		Host namedHost `json:"host"`
+	} `json:"ops"` // batch request
+	Changes struct {
+		Add     []namedHost `json:"add"`
+		Replace []namedHost `json:"replace"`
+		Remove  []namedHost `json:"remove"`
+	} `json:"changes"` // sync response
+	Revisions []struct {
+		Host     namedHost  `json:"host"`
+		Previous *namedHost `json:"previous"`
+	} `json:"revisions"` // rollback response
+	Removed []string `json:"removed"` // remove by selector response
+}
+
+// namedHost is the host in the requests and responses.
+type namedHost struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+func (h *namedHost) names(fn func(string)) {
+	if h == nil {
+		return
+	}
+	fn(h.Name)
+	for _, a := range h.Aliases {
+		fn(a)
+	}
+}
+
+// names calls fn for every host name and alias in the fields.
+func (f *hostFields) names(fn func(string)) {
+	fn(f.HostPrefix)
+	fn(f.Hostname)
+	for _, a := range f.Aliases {
+		fn(a)
+	}
+	for _, name := range f.Removed {
+		fn(name)
+	}
+	for _, hosts := range [][]namedHost{f.Hosts, f.Changes.Add, f.Changes.Replace, f.Changes.Remove} {
+		for i := range hosts {
+			hosts[i].names(fn)
+		}
+	}
+	for i := range f.Ops {
+		f.Ops[i].Host.names(fn)
+	}
+	for i := range f.Revisions {
+		f.Revisions[i].Host.names(fn)
+		f.Revisions[i].Previous.names(fn)
+	}
+}
+
+// fullName appends the domain name to the host prefix, if it's not there.
+// The domain name itself is returned as is.
+func (g *gateway) fullName(name string) string {
+	if name == g.addr || strings.HasSuffix(name, "."+g.addr) {
+		return name
+	}
+	return g.withDomain(name)
+}
+
+// jsonBody returns the body as JSON, if the body is not a valid JSON, it is
+// returned as a JSON string.
+func jsonBody(b []byte) json.RawMessage {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil
+	}
+	if json.Valid(b) {
+		return b
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+// parseTime parses the RFC3339 time, empty string is zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// responseRecorder records the status code and the response body, that are
+// written to the underlying ResponseWriter on flush.  The headers are set on
+// the underlying ResponseWriter directly.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if !rr.wroteHeader {
+		rr.status = code
+		rr.wroteHeader = true
+	}
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	return rr.body.Write(b)
+}
+
+// flush writes the recorded response to the underlying ResponseWriter.
+func (rr *responseRecorder) flush() {
+	rr.ResponseWriter.WriteHeader(rr.status)
+	if _, err := rr.ResponseWriter.Write(rr.body.Bytes()); err != nil {
+		log.Print("error writing the response:", err)
+	}
+}
@@ -0,0 +1,141 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/audit"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAuditLog(t *testing.T) *audit.Log {
+	t.Helper()
+	l, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestAudit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mc := mocks.NewMockHostManager(ctrl)
+	gomock.InOrder(
+		mc.EXPECT().Apply(gomock.Any()).Return(nil),
+		mc.EXPECT().Apply(gomock.Any()).Return(&vhoster.OpError{Err: vhoster.ErrAlreadyExists}),
+		mc.EXPECT().Exists("test").Return(false),
+		mc.EXPECT().Exists("test.example.com").Return(true),
+		mc.EXPECT().Apply(gomock.Any()).Return(nil),
+	)
+	mc.EXPECT().List().Return(nil).Times(2)
+	g := &gateway{vg: mc, addr: "example.com", audit: testAuditLog(t)}
+	h := g.handler()
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/vhost/", strings.NewReader(`{"host_prefix":"test","target":"http://localhost:8082"}`)),
+		httptest.NewRequest(http.MethodPost, "/vhost/", strings.NewReader(`{"host_prefix":"test","target":"http://localhost:8082"}`)),
+		httptest.NewRequest(http.MethodGet, "/vhost/", nil), // not audited
+		httptest.NewRequest(http.MethodDelete, "/vhost/test", nil),
+	}
+	requests[0].Header.Set(ActorHeader, "alice")
+	for _, req := range requests {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/audit/?host=test", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp AuditResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Len(t, resp.Entries, 3)
+
+	first := resp.Entries[0]
+	assert.Equal(t, "alice (unverified)", first.Actor)
+	assert.Equal(t, "192.0.2.1", first.SourceIP)
+	assert.Equal(t, []string{"test.example.com"}, first.Hosts)
+	assert.JSONEq(t, `{"host_prefix":"test","target":"http://localhost:8082"}`, string(first.Request))
+	assert.Equal(t, http.StatusOK, first.Status)
+	assert.Equal(t, "ok", first.Result)
+
+	assert.Equal(t, http.StatusConflict, resp.Entries[1].Status)
+	assert.Equal(t, "409 host already exists", resp.Entries[1].Result)
+
+	assert.Equal(t, http.MethodDelete, resp.Entries[2].Method)
+	assert.Equal(t, resp.Entries[1].Hash, resp.Entries[2].PrevHash)
+
+	t.Run("filters", func(t *testing.T) {
+		for _, q := range []string{"?host=other", "?until=2000-01-01T00:00:00Z"} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/audit/"+q, nil))
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.JSONEq(t, `{"entries":[]}`, rr.Body.String(), q)
+		}
+		for _, q := range []string{"?since=yesterday", "?limit=-1"} {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/audit/"+q, nil))
+			assert.Equal(t, http.StatusBadRequest, rr.Code, q)
+		}
+	})
+}
+
+func TestAudit_writeError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mc := mocks.NewMockHostManager(ctrl)
+	mc.EXPECT().Apply(gomock.Any()).Return(nil)
+	l := testAuditLog(t)
+	g := &gateway{vg: mc, addr: "example.com", audit: l}
+	h := g.handler()
+
+	ready := func() int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ready/", nil))
+		return rr.Code
+	}
+	require.Equal(t, http.StatusOK, ready())
+
+	require.NoError(t, l.Close())
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/vhost/", strings.NewReader(`{"host_prefix":"test","target":"http://localhost:8082"}`)))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "500 error writing the audit log, the request is not recorded\n", rr.Body.String(), "the response of the handler is not sent")
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+}
+
+func Test_gateway_affectedHosts(t *testing.T) {
+	g := &gateway{addr: "example.com"}
+	tests := []struct {
+		name string
+		path string
+		req  string
+		resp string
+		want []string
+	}{
+		{"add", "/vhost/", `{"host_prefix":"test","aliases":["www"],"labels":{"name":"web"},"annotations":{"hostname":"x"}}`, `{"hostname":"test.example.com"}`, []string{"test.example.com", "www.example.com"}},
+		{"remove", "/vhost/test", ``, `OK`, []string{"test.example.com"}},
+		{"remove by selector", "/vhost/", ``, `{"removed":["a.example.com","b.example.com"]}`, []string{"a.example.com", "b.example.com"}},
+		{"sync", "/vhost/", `{"hosts":[{"name":"a","labels":{"name":"web"}}]}`, `{"changes":{"add":[{"name":"a.example.com"}],"remove":[{"name":"b.example.com","aliases":["c.example.com"]}]}}`, []string{"a.example.com", "b.example.com", "c.example.com"}},
+		{"batch", "/batch/", `{"ops":[{"action":"remove","host":{"name":"a"}},{"action":"add","host":{"name":"b","annotations":{"name":"x"}}}]}`, `{"applied":2}`, []string{"a.example.com", "b.example.com"}},
+		{"rollback", "/rollback/1", ``, `{"revisions":[{"host":{"name":"a.example.com"},"previous":{"name":"a.example.com","labels":{"name":"web"}}}]}`, []string{"a.example.com"}},
+		{"invalid body", "/batch/", `{"ops":"x","hosts":[{"name":"a"}]}`, ``, []string{"a.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			assert.Equal(t, tt.want, g.affectedHosts(r, []byte(tt.req), []byte(tt.resp)))
+		})
+	}
+}
+
+func TestAudit_disabled(t *testing.T) {
+	g := &gateway{}
+	rr := httptest.NewRecorder()
+	g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/audit/", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
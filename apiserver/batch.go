@@ -0,0 +1,121 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/rusq/vhoster"
+)
+
+// BatchRequest is an ordered list of operations on the route table, that
+// are applied all or nothing.
+type BatchRequest struct {
+	Ops []BatchOp `json:"ops"`
+}
+
+// BatchOp is the operation of the batch request.
+type BatchOp struct {
+	// Action is the action to apply: add, replace or remove.
+	Action vhoster.Action `json:"action"`
+	// Host is the host to operate on, only the name is required for the
+	// remove action.  On replace, the omitted aliases, labels and
+	// annotations of the host are kept.
+	Host HostSpec `json:"host"`
+}
+
+// BatchResponse is the response for the batch request.
+type BatchResponse struct {
+	// Applied is the number of applied operations.
+	Applied int `json:"applied"`
+}
+
+// handleBatch applies the batch of operations to the host manager.
+func (g *gateway) handleBatch(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Print("error decoding body:", err)
+		httStatus(w, http.StatusBadRequest)
+		return
+	}
+	if len(req.Ops) == 0 {
+		http.Error(w, "400 empty batch", http.StatusBadRequest)
+		return
+	}
+	ops, err := g.batchOps(r.Context(), req.Ops, actor(r))
+	if err != nil {
+		log.Print("error applying batch:", err)
+		writeError(w, err)
+		return
+	}
+	if err := g.vg.Apply(ops...); err != nil {
+		log.Print("error applying batch:", err)
+		var oe *vhoster.OpError
+		if !errors.As(err, &oe) {
+			httStatus(w, http.StatusInternalServerError)
+			return
+		}
+		var code int
+		switch {
+		case errors.Is(oe.Err, vhoster.ErrNotFound):
+			code = http.StatusNotFound
+		case errors.Is(oe.Err, vhoster.ErrAlreadyExists):
+			code = http.StatusConflict
+		default:
+			code = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("%d op %d: %s", code, oe.Index, oe.Err), code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(BatchResponse{Applied: len(req.Ops)}); err != nil {
+		log.Print("error encoding batch response:", err)
+	}
+}
+
+// batchOps returns the operations of the batch request on behalf of the
+// actor.  The hosts of the add and replace operations are built as for the
+// add and replace requests, and the replaced hosts keep their expiry, lease
+// and pinned state.  It returns an *httpError, if the operation is invalid.
+func (g *gateway) batchOps(ctx context.Context, bops []BatchOp, actor string) ([]vhoster.Op, error) {
+	var current []vhoster.Host // hosts replaced by the batch
+	for _, bop := range bops {
+		if bop.Action == vhoster.ActionReplace {
+			current = g.vg.List()
+			break
+		}
+	}
+	ops := make([]vhoster.Op, len(bops))
+	for i, bop := range bops {
+		ops[i] = vhoster.Op{Action: bop.Action, Actor: actor}
+		switch bop.Action {
+		case vhoster.ActionAdd, vhoster.ActionReplace:
+			var cur []vhoster.Host
+			if bop.Action == vhoster.ActionReplace {
+				cur = current
+			}
+			h, err := g.specHost(bop.Host, cur)
+			if err != nil {
+				return nil, indexed(err, "op", i)
+			}
+			if err := g.checkTarget(ctx, h.URI.URL()); err != nil {
+				return nil, indexed(err, "op", i)
+			}
+			ops[i].Host = h
+		case vhoster.ActionRemove:
+			name, err := g.hostName(bop.Host.Name)
+			if err != nil {
+				return nil, &httpError{http.StatusBadRequest, fmt.Sprintf("op %d: %s", i, err)}
+			}
+			ops[i].Host = vhoster.Host{Name: name}
+		default:
+			return nil, &httpError{http.StatusBadRequest, fmt.Sprintf("op %d: %s %q", i, vhoster.ErrInvalidOp, bop.Action)}
+		}
+	}
+	return ops, nil
+}
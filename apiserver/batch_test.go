@@ -0,0 +1,165 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+)
+
+func TestHandleBatch(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		name       string
+		body       string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		wantBody   string
+	}{
+		{
+			name: "success",
+			body: `{"ops":[
+				{"action":"remove","host":{"name":"old"}},
+				{"action":"add","host":{"name":"new.example.com","target":"http://localhost:8082"}}
+			]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(
+					vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: "old.example.com"}, Actor: "192.0.2.1"},
+					vhoster.Op{Action: vhoster.ActionAdd, Host: vhoster.Host{Name: "new.example.com", URI: vhoster.Must(vhoster.Parse("http://localhost:8082"))}, Actor: "192.0.2.1"},
+				).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "aliases are qualified",
+			body: `{"ops":[{"action":"add","host":{"name":"new","target":"http://localhost:8082","aliases":["Web","Old.Example.com"]}}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionAdd, Host: vhoster.Host{
+					Name:    "new.example.com",
+					Aliases: []string{"web.example.com", "old.example.com"},
+					URI:     vhoster.Must(vhoster.Parse("http://localhost:8082")),
+				}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "reserved alias prefix",
+			body: `{"ops":[{"action":"add","host":{"name":"new","target":"http://localhost:8082","aliases":["www"]}}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return(nil)
+			},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "invalid alias",
+			body:       `{"ops":[{"action":"add","host":{"name":"new","target":"http://localhost:8082","aliases":["-bad"]}}]}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "empty batch",
+			body:       `{"ops":[]}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "malformed body",
+			body:       `{"ops":`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid operation",
+			body:       `{"ops":[{"action":"upsert","host":{"name":"a"}}]}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			wantBody:   "400 op 0: invalid operation \"upsert\"\n",
+		},
+		{
+			name:       "missing target",
+			body:       `{"ops":[{"action":"remove","host":{"name":"a"}},{"action":"add","host":{"name":"b"}}]}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			wantBody:   "400 op 1: missing target\n",
+		},
+		{
+			name: "replace keeps the host state",
+			// the attributes, that are not part of the spec, are ignored.
+			body: `{"ops":[{"action":"replace","host":{"name":"a","target":"http://new:80","pinned":false,"expires":"2000-01-01T00:00:00Z"}}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{{
+					Name:    "a.example.com",
+					URI:     vhoster.Must(vhoster.Parse("http://old:80")),
+					Labels:  map[string]string{"env": "prod"},
+					Expires: &expires,
+					Pinned:  true,
+				}})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionReplace, Host: vhoster.Host{
+					Name:    "a.example.com",
+					URI:     vhoster.Must(vhoster.Parse("http://new:80")),
+					Labels:  map[string]string{"env": "prod"},
+					Expires: &expires,
+					Pinned:  true,
+				}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "not found",
+			body: `{"ops":[{"action":"remove","host":{"name":"a"}}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(gomock.Any()).Return(&vhoster.OpError{Err: vhoster.ErrNotFound})
+			},
+			statusCode: http.StatusNotFound,
+			wantBody:   "404 op 0: vhost not found\n",
+		},
+		{
+			name: "conflict",
+			body: `{"ops":[{"action":"add","host":{"name":"a","target":"http://a"}}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(gomock.Any()).Return(&vhoster.OpError{Index: 0, Err: vhoster.ErrAlreadyExists})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name: "invalid host",
+			body: `{"ops":[{"action":"remove","host":{"name":"a"}},{"action":"remove","host":{"name":"a"}}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(gomock.Any()).Return(&vhoster.OpError{Index: 1, Err: vhoster.ErrInvalidName})
+			},
+			statusCode: http.StatusBadRequest,
+			wantBody:   "400 op 1: " + vhoster.ErrInvalidName.Error() + "\n",
+		},
+		{
+			name: "internal error",
+			body: `{"ops":[{"action":"remove","host":{"name":"a"}}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(gomock.Any()).Return(errors.New("boom"))
+			},
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/batch/", strings.NewReader(tc.body)))
+			if rr.Code != tc.statusCode {
+				t.Errorf("unexpected status code: %d", rr.Code)
+			}
+			if tc.wantBody != "" && rr.Body.String() != tc.wantBody {
+				t.Errorf("unexpected body: %q", rr.Body.String())
+			}
+		})
+	}
+}
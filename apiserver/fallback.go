@@ -0,0 +1,80 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// FallbackRequest is the request to set the fallback target, that receives
+// the requests for the unknown hosts.
+type FallbackRequest struct {
+	Target string `json:"target,omitempty"`
+}
+
+// FallbackResponse is the current fallback target, empty if it's not set.
+type FallbackResponse struct {
+	Target string `json:"target,omitempty"`
+}
+
+func (g *gateway) handleFallback(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		g.writeFallback(w)
+	case http.MethodPut:
+		g.handleSetFallback(w, r)
+	case http.MethodDelete:
+		if err := g.vg.SetFallback(nil); err != nil {
+			log.Print("error removing the fallback:", err)
+			httStatus(w, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("fallback removed by %s", actor(r))
+		g.writeFallback(w)
+	}
+}
+
+func (g *gateway) handleSetFallback(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var req FallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Print("error decoding body:", err)
+		httStatus(w, http.StatusBadRequest)
+		return
+	}
+	if req.Target == "" {
+		log.Print("missing target")
+		http.Error(w, "400 missing target", http.StatusBadRequest)
+		return
+	}
+	uri, err := url.Parse(req.Target)
+	if err != nil {
+		log.Print("error parsing the fallback target:", err)
+		http.Error(w, "400 invalid target", http.StatusBadRequest)
+		return
+	}
+	if err := g.checkTarget(r.Context(), uri); err != nil {
+		log.Print(err)
+		writeError(w, err)
+		return
+	}
+	if err := g.vg.SetFallback(uri); err != nil {
+		log.Print("error setting the fallback:", err)
+		http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("fallback set to %s by %s", uri, actor(r))
+	g.writeFallback(w)
+}
+
+func (g *gateway) writeFallback(w http.ResponseWriter) {
+	var resp FallbackResponse
+	if u := g.vg.Fallback(); u != nil {
+		resp.Target = u.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Print("error encoding the fallback:", err)
+	}
+}
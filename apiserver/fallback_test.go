@@ -0,0 +1,98 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleFallback(t *testing.T) {
+	landing := vhoster.Must(vhoster.Parse("http://localhost:8090"))
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		want       string
+	}{
+		{
+			name:   "get",
+			method: http.MethodGet,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Fallback().Return(landing)
+			},
+			statusCode: http.StatusOK,
+			want:       `{"target":"http://localhost:8090"}` + "\n",
+		},
+		{
+			name:   "get not set",
+			method: http.MethodGet,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Fallback().Return(nil)
+			},
+			statusCode: http.StatusOK,
+			want:       "{}\n",
+		},
+		{
+			name:   "set",
+			method: http.MethodPut,
+			body:   `{"target":"http://localhost:8090"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().SetFallback(landing.URL()).Return(nil)
+				mc.EXPECT().Fallback().Return(landing)
+			},
+			statusCode: http.StatusOK,
+			want:       `{"target":"http://localhost:8090"}` + "\n",
+		},
+		{
+			name:       "set without target",
+			method:     http.MethodPut,
+			body:       `{}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			want:       "400 missing target\n",
+		},
+		{
+			name:   "set invalid target",
+			method: http.MethodPut,
+			body:   `{"target":"ftp://localhost"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().SetFallback(gomock.Any()).Return(errors.New(`unsupported fallback scheme "ftp", must be http or https`))
+			},
+			statusCode: http.StatusBadRequest,
+			want:       "400 unsupported fallback scheme \"ftp\", must be http or https\n",
+		},
+		{
+			name:   "remove",
+			method: http.MethodDelete,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().SetFallback((*url.URL)(nil)).Return(nil)
+				mc.EXPECT().Fallback().Return(nil)
+			},
+			statusCode: http.StatusOK,
+			want:       "{}\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(tc.method, "/fallback/", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.statusCode, rr.Code)
+			assert.Equal(t, tc.want, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rusq/vhoster"
+)
+
+// ActorHeader is the request header, that names the caller in the history and
+// the audit log.  The API doesn't authenticate the callers, so the name is
+// recorded as unverified.
+const ActorHeader = "X-Vhoster-Actor"
+
+// unverified is appended to the identity claimed by the caller.
+const unverified = " (unverified)"
+
+// HistoryResponse is the response for the history and rollback requests.
+type HistoryResponse struct {
+	Revisions []vhoster.Revision `json:"revisions"`
+}
+
+// actor returns the identity of the caller: the value of the ActorHeader,
+// marked as unverified, as anyone can set it, or the remote address.
+func actor(r *http.Request) string {
+	if a := strings.TrimSpace(r.Header.Get(ActorHeader)); a != "" {
+		return a + unverified
+	}
+	return remoteIP(r)
+}
+
+// remoteIP returns the IP address of the caller.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// handleHistory returns the revisions of the route table, the oldest first.
+func (g *gateway) handleHistory(w http.ResponseWriter, r *http.Request) {
+	writeRevisions(w, g.vg.History())
+}
+
+// handleRollback restores the route table to the revision given in the path.
+func (g *gateway) handleRollback(w http.ResponseWriter, r *http.Request) {
+	rev, err := strconv.ParseInt(r.URL.Path[len("/rollback/"):], 10, 64)
+	if err != nil {
+		log.Print("invalid revision:", err)
+		http.Error(w, "400 invalid revision", http.StatusBadRequest)
+		return
+	}
+	revs, err := g.vg.Rollback(rev, actor(r))
+	if err != nil {
+		log.Printf("error rolling back to revision %d: %s", rev, err)
+		switch {
+		case errors.Is(err, vhoster.ErrRevisionNotFound):
+			http.Error(w, "404 revision not found", http.StatusNotFound)
+		case errors.Is(err, vhoster.ErrNotFound), errors.Is(err, vhoster.ErrAlreadyExists):
+			http.Error(w, "409 "+err.Error(), http.StatusConflict)
+		default:
+			httStatus(w, http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("rolled back to revision %d, %d changes reverted", rev, len(revs))
+	writeRevisions(w, revs)
+}
+
+func writeRevisions(w http.ResponseWriter, revs []vhoster.Revision) {
+	ret := make([]vhoster.Revision, len(revs))
+	for i, r := range revs {
+		ret[i] = revisionWithoutLease(r)
+	}
+	revs = ret
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(HistoryResponse{Revisions: revs}); err != nil {
+		log.Print("error encoding revisions:", err)
+	}
+}
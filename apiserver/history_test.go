@@ -0,0 +1,113 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_actor(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, "192.0.2.1", actor(r))
+	r.SetBasicAuth("alice", "secret")
+	assert.Equal(t, "192.0.2.1", actor(r), "basic auth is not verified")
+	r.Header.Set(ActorHeader, "ci")
+	assert.Equal(t, "ci (unverified)", actor(r))
+}
+
+func TestHandleRollback(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		actor      string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+	}{
+		{
+			name:  "success",
+			path:  "/rollback/3",
+			actor: "alice",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Rollback(int64(3), "alice (unverified)").Return([]vhoster.Revision{{ID: 5, Actor: "alice (unverified)"}}, nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "invalid revision",
+			path:       "/rollback/abc",
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name: "unknown revision",
+			path: "/rollback/42",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Rollback(int64(42), gomock.Any()).Return(nil, vhoster.ErrRevisionNotFound)
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name: "conflict",
+			path: "/rollback/1",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Rollback(int64(1), gomock.Any()).Return(nil, &vhoster.OpError{Err: vhoster.ErrAlreadyExists})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name: "error",
+			path: "/rollback/1",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Rollback(int64(1), gomock.Any()).Return(nil, errors.New("disk full"))
+			},
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			if tc.actor != "" {
+				req.Header.Set(ActorHeader, tc.actor)
+			}
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, req)
+			require.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if rr.Code == http.StatusOK {
+				var resp HistoryResponse
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+				assert.Len(t, resp.Revisions, 1)
+			}
+		})
+	}
+}
+
+func TestHandleHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mc := mocks.NewMockHostManager(ctrl)
+	mc.EXPECT().History().Return([]vhoster.Revision{
+		{ID: 1, Action: vhoster.ActionAdd, Host: vhoster.Host{Name: "a.example.com"}},
+		{ID: 2, Action: vhoster.ActionRemove, Host: vhoster.Host{Name: "a.example.com"}},
+	})
+	g := &gateway{vg: mc, addr: "example.com"}
+
+	rr := httptest.NewRecorder()
+	g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/history/", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp HistoryResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Len(t, resp.Revisions, 2)
+	assert.Equal(t, int64(2), resp.Revisions[1].ID)
+}
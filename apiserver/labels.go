@@ -0,0 +1,64 @@
+package apiserver
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/rusq/vhoster"
+)
+
+// RemoveResponse is the response for the removal of the hosts by selector.
+type RemoveResponse struct {
+	// Removed are the names of the removed hosts.
+	Removed []string `json:"removed"`
+}
+
+// selector returns the label selector from the "selector" query parameter.
+func selector(r *http.Request) (vhoster.Selector, error) {
+	sel, err := vhoster.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		log.Print(err)
+		return nil, &httpError{http.StatusBadRequest, err.Error()}
+	}
+	return sel, nil
+}
+
+// handleRemoveSelected removes all hosts, that match the selector, in one
+// batch.  The selector must not be empty, so that all hosts are not removed
+// by accident.
+func (g *gateway) handleRemoveSelected(w http.ResponseWriter, r *http.Request) {
+	sel, err := selector(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if sel.Empty() {
+		log.Print("empty selector")
+		http.Error(w, "400 empty selector", http.StatusBadRequest)
+		return
+	}
+	hosts := vhoster.Select(g.vg.List(), sel)
+	resp := RemoveResponse{Removed: make([]string, 0, len(hosts))}
+	if len(hosts) == 0 {
+		writeJSON(w, "", resp)
+		return
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	ops := make([]vhoster.Op, len(hosts))
+	for i, h := range hosts {
+		ops[i] = vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: h.Name}, Actor: actor(r)}
+		resp.Removed = append(resp.Removed, h.Name)
+	}
+	if err := g.vg.Apply(ops...); err != nil {
+		log.Printf("error removing hosts by selector %q: %s", sel, err)
+		if errors.Is(err, vhoster.ErrNotFound) {
+			http.Error(w, "409 hosts were changed concurrently, try again", http.StatusConflict)
+			return
+		}
+		httStatus(w, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, "", resp)
+}
@@ -0,0 +1,148 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+)
+
+func TestLabels(t *testing.T) {
+	uri := vhoster.Must(vhoster.Parse("http://localhost:8082"))
+	preview := vhoster.Host{Name: "a.example.com", URI: uri, Labels: map[string]string{"env": "preview", "team": "web"}, Annotations: map[string]string{"git-sha": "abc"}}
+	api := vhoster.Host{Name: "b.example.com", URI: uri, Labels: map[string]string{"env": "preview", "team": "api"}}
+	prod := vhoster.Host{Name: "c.example.com", URI: uri, Labels: map[string]string{"env": "prod", "team": "web"}}
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		wantBody   string
+	}{
+		{
+			name:   "add with labels",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"a","target":"http://localhost:8082","labels":{"env":"preview","team":"web"},"annotations":{"git-sha":"abc"}}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionAdd, Host: preview, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "invalid label",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"a","target":"http://localhost:8082","labels":{"env":"pre view"}}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			wantBody:   `400 label "env": invalid value "pre view", must be at most 63 letters, digits, ".", "_" and "-"` + "\n",
+		},
+		{
+			name:   "replace keeps labels",
+			method: http.MethodPatch,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"a","target":"http://localhost:8082"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{preview})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionReplace, Host: preview, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "replace clears labels",
+			method: http.MethodPatch,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"a","target":"http://localhost:8082","labels":{}}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{preview})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionReplace, Host: vhoster.Host{
+					Name: "a.example.com", URI: uri, Labels: map[string]string{}, Annotations: preview.Annotations,
+				}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "list by selector",
+			method: http.MethodGet,
+			path:   "/vhost/?selector=env=preview,team=web",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{preview, api, prod})
+			},
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"a.example.com","uri":"http://localhost:8082","labels":{"env":"preview","team":"web"},"annotations":{"git-sha":"abc"}}]}` + "\n",
+		},
+		{
+			name:       "list by invalid selector",
+			method:     http.MethodGet,
+			path:       "/vhost/?selector=env=pre+view",
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "remove by selector",
+			method: http.MethodDelete,
+			path:   "/vhost/?selector=team!=api",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{prod, api, preview})
+				mc.EXPECT().Apply(
+					vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: "a.example.com"}, Actor: "192.0.2.1"},
+					vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: "c.example.com"}, Actor: "192.0.2.1"},
+				).Return(nil)
+			},
+			statusCode: http.StatusOK,
+			wantBody:   `{"removed":["a.example.com","c.example.com"]}` + "\n",
+		},
+		{
+			name:   "remove by selector, nothing matches",
+			method: http.MethodDelete,
+			path:   "/vhost/?selector=env=staging",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{prod, api, preview})
+			},
+			statusCode: http.StatusOK,
+			wantBody:   `{"removed":[]}` + "\n",
+		},
+		{
+			name:       "remove by empty selector",
+			method:     http.MethodDelete,
+			path:       "/vhost/?selector=",
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			wantBody:   "400 empty selector\n",
+		},
+		{
+			name:   "remove by selector, concurrent change",
+			method: http.MethodDelete,
+			path:   "/vhost/?selector=env=prod",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{prod})
+				mc.EXPECT().Apply(gomock.Any()).Return(&vhoster.OpError{Err: vhoster.ErrNotFound})
+			},
+			statusCode: http.StatusConflict,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
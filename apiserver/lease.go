@@ -0,0 +1,101 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rusq/vhoster"
+)
+
+// LeaseResponse is the response for the lease renewal and revocation.
+type LeaseResponse struct {
+	LeaseID  string     `json:"lease_id"`
+	Hostname string     `json:"hostname"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+// handleLease renews the lease given in the path on POST, and revokes it,
+// removing the host, on DELETE.  Renewals are frequent and only move the
+// expiry time, so only the revocations are audited.
+func (g *gateway) handleLease(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		g.handleRenew(w, r)
+	case http.MethodDelete:
+		g.audited(g.handleRevoke)(w, r)
+	}
+}
+
+func leaseID(r *http.Request) string {
+	return r.URL.Path[len("/lease/"):]
+}
+
+func (g *gateway) handleRenew(w http.ResponseWriter, r *http.Request) {
+	h, err := g.vg.Renew(leaseID(r))
+	if err != nil {
+		leaseError(w, err)
+		return
+	}
+	writeLease(w, h)
+}
+
+func (g *gateway) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	h, err := g.vg.Revoke(leaseID(r), actor(r))
+	if err != nil {
+		leaseError(w, err)
+		return
+	}
+	log.Printf("lease of host %q revoked by %s", h.Name, actor(r))
+	h.Expires = nil
+	writeLease(w, h)
+}
+
+func leaseError(w http.ResponseWriter, err error) {
+	if errors.Is(err, vhoster.ErrLeaseNotFound) {
+		http.Error(w, "404 lease not found", http.StatusNotFound)
+		return
+	}
+	log.Print("lease error:", err)
+	httStatus(w, http.StatusInternalServerError)
+}
+
+func writeLease(w http.ResponseWriter, h vhoster.Host) {
+	resp := LeaseResponse{Hostname: h.Name, Expires: h.Expires}
+	if h.Lease != nil {
+		resp.LeaseID = h.Lease.ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Print("error encoding the lease:", err)
+	}
+}
+
+// withoutLeases returns the copy of the hosts without the leases.  The lease
+// ID allows to renew and revoke the host, so it is returned only to the one,
+// who added the host, and is left out of the listings and the events.
+func withoutLeases(hosts []vhoster.Host) []vhoster.Host {
+	if hosts == nil {
+		return nil
+	}
+	ret := make([]vhoster.Host, len(hosts))
+	for i, h := range hosts {
+		h.Lease = nil
+		ret[i] = h
+	}
+	return ret
+}
+
+// revisionWithoutLease returns the copy of the revision without the leases
+// of the hosts, see withoutLeases.
+func revisionWithoutLease(r vhoster.Revision) vhoster.Revision {
+	r.Host.Lease = nil
+	if r.Previous != nil {
+		prev := *r.Previous
+		prev.Lease = nil
+		r.Previous = &prev
+	}
+	return r
+}
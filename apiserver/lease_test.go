@@ -0,0 +1,103 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/audit"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleLease(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	leased := vhoster.Host{Name: "test.example.com", Expires: &expires, Lease: &vhoster.Lease{ID: "abc", Interval: time.Minute}}
+	testCases := []struct {
+		name       string
+		method     string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		want       string
+	}{
+		{
+			name:   "renew",
+			method: http.MethodPost,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Renew("abc").Return(leased, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `{"lease_id":"abc","hostname":"test.example.com","expires":"2030-01-02T03:04:05Z"}` + "\n",
+		},
+		{
+			name:   "renew expired",
+			method: http.MethodPost,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Renew("abc").Return(vhoster.Host{}, vhoster.ErrLeaseNotFound)
+			},
+			statusCode: http.StatusNotFound,
+			want:       "404 lease not found\n",
+		},
+		{
+			name:   "revoke",
+			method: http.MethodDelete,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Revoke("abc", "192.0.2.1").Return(leased, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `{"lease_id":"abc","hostname":"test.example.com"}` + "\n",
+		},
+		{
+			name:   "revoke error",
+			method: http.MethodDelete,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Revoke("abc", "192.0.2.1").Return(vhoster.Host{}, errors.New("disk full"))
+			},
+			statusCode: http.StatusInternalServerError,
+			want:       "Internal Server Error\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com", audit: testAuditLog(t)}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(tc.method, "/lease/abc", nil))
+			assert.Equal(t, tc.statusCode, rr.Code)
+			assert.Equal(t, tc.want, rr.Body.String())
+
+			entries, err := g.audit.Query(audit.Filter{})
+			assert.NoError(t, err)
+			if tc.method == http.MethodPost {
+				assert.Empty(t, entries, "renewals are not audited")
+			} else {
+				assert.Len(t, entries, 1)
+			}
+		})
+	}
+}
+
+func TestLeaseNotListed(t *testing.T) {
+	leased := vhoster.Host{Name: "test.example.com", URI: vhoster.Must(vhoster.Parse("http://localhost:8082")), Lease: &vhoster.Lease{ID: "secret", Interval: time.Minute}}
+	ctrl := gomock.NewController(t)
+	mc := mocks.NewMockHostManager(ctrl)
+	mc.EXPECT().List().Return([]vhoster.Host{leased}).AnyTimes()
+	mc.EXPECT().History().Return([]vhoster.Revision{{ID: 1, Action: vhoster.ActionReplace, Host: leased, Previous: &leased}})
+	g := &gateway{vg: mc, addr: "example.com"}
+
+	for _, path := range []string{"/vhost/", "/vhost/?limit=1", "/history/"} {
+		rr := httptest.NewRecorder()
+		g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+		assert.Contains(t, rr.Body.String(), "test.example.com", path)
+		assert.NotContains(t, rr.Body.String(), "secret", path)
+	}
+	assert.Equal(t, "secret", leased.Lease.ID, "the hosts of the gateway are not modified")
+}
@@ -0,0 +1,115 @@
+package apiserver
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rusq/vhoster"
+)
+
+// maxPageSize is the maximum number of hosts on one page of the list.
+const maxPageSize = 1000
+
+// listQuery is the query of the list request.
+type listQuery struct {
+	sel    vhoster.Selector
+	name   string // substring of the name or of one of the aliases
+	target string // substring of the target
+	limit  int    // page size, 0 means all hosts
+	after  string // name of the last host on the previous page
+}
+
+// parseListQuery parses the query parameters of the list request.
+func parseListQuery(r *http.Request) (listQuery, error) {
+	var (
+		q   listQuery
+		err error
+		v   = r.URL.Query()
+	)
+	if q.sel, err = selector(r); err != nil {
+		return q, err
+	}
+	q.name = strings.ToLower(v.Get("name"))
+	q.target = strings.ToLower(v.Get("target"))
+	if s := v.Get("limit"); s != "" {
+		q.limit, err = strconv.Atoi(s)
+		if err != nil || q.limit < 1 || q.limit > maxPageSize {
+			log.Printf("invalid limit %q", s)
+			return q, &httpError{http.StatusBadRequest, "limit must be a number from 1 to " + strconv.Itoa(maxPageSize)}
+		}
+	}
+	if s := v.Get("cursor"); s != "" {
+		if q.after, err = decodeCursor(s); err != nil {
+			log.Printf("invalid cursor %q: %s", s, err)
+			return q, &httpError{http.StatusBadRequest, "invalid cursor"}
+		}
+	}
+	return q, nil
+}
+
+// matches returns true if the host satisfies the filters of the query.
+func (q listQuery) matches(h vhoster.Host) bool {
+	if !q.sel.Matches(h.Labels) {
+		return false
+	}
+	if q.target != "" && (h.URI == nil || !strings.Contains(strings.ToLower(h.URI.String()), q.target)) {
+		return false
+	}
+	if q.name == "" {
+		return true
+	}
+	for _, name := range append([]string{h.Name}, h.Aliases...) {
+		if strings.Contains(name, q.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleListPage lists the hosts, that match the filters of the query,
+// sorted by name.  If the limit is set, the hosts are returned in pages,
+// and the response contains the cursor of the next page, that points past
+// the last returned host, so that the pages stay consistent, while the hosts
+// are added and removed.
+func (g *gateway) handleListPage(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	hosts := g.vg.List()
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	if q.after != "" {
+		hosts = hosts[sort.Search(len(hosts), func(i int) bool { return hosts[i].Name > q.after }):]
+	}
+	var resp ListResponse
+	for _, h := range hosts {
+		if !q.matches(h) {
+			continue
+		}
+		if q.limit > 0 && len(resp.Hosts) == q.limit {
+			resp.NextCursor = encodeCursor(resp.Hosts[len(resp.Hosts)-1].Name)
+			break
+		}
+		resp.Hosts = append(resp.Hosts, h)
+	}
+	g.writeList(w, resp)
+}
+
+// encodeCursor returns the opaque cursor, that points past the host name.
+func encodeCursor(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+// decodeCursor returns the host name from the cursor.
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,101 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+)
+
+func TestHandleListPage(t *testing.T) {
+	host := func(name, target string, aliases ...string) vhoster.Host {
+		return vhoster.Host{Name: name, Aliases: aliases, URI: vhoster.Must(vhoster.Parse(target))}
+	}
+	hosts := []vhoster.Host{
+		host("d.example.com", "http://web:8080"),
+		host("b.example.com", "http://api:8081", "legacy.example.com"),
+		host("a.example.com", "http://web:8082"),
+		host("c.example.com", "http://api:8083"),
+	}
+	testCases := []struct {
+		name       string
+		path       string
+		statusCode int
+		wantBody   string
+	}{
+		{
+			name:       "all hosts sorted",
+			path:       "/vhost/",
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"a.example.com","uri":"http://web:8082"},{"name":"b.example.com","aliases":["legacy.example.com"],"uri":"http://api:8081"},{"name":"c.example.com","uri":"http://api:8083"},{"name":"d.example.com","uri":"http://web:8080"}]}` + "\n",
+		},
+		{
+			name:       "first page",
+			path:       "/vhost/?limit=2",
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"a.example.com","uri":"http://web:8082"},{"name":"b.example.com","aliases":["legacy.example.com"],"uri":"http://api:8081"}],"next_cursor":"Yi5leGFtcGxlLmNvbQ"}` + "\n",
+		},
+		{
+			name:       "last page",
+			path:       "/vhost/?limit=2&cursor=Yi5leGFtcGxlLmNvbQ",
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"c.example.com","uri":"http://api:8083"},{"name":"d.example.com","uri":"http://web:8080"}]}` + "\n",
+		},
+		{
+			name:       "page is not cut on the exact limit",
+			path:       "/vhost/?limit=4",
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"a.example.com","uri":"http://web:8082"},{"name":"b.example.com","aliases":["legacy.example.com"],"uri":"http://api:8081"},{"name":"c.example.com","uri":"http://api:8083"},{"name":"d.example.com","uri":"http://web:8080"}]}` + "\n",
+		},
+		{
+			name:       "name matches alias",
+			path:       "/vhost/?name=LEGACY",
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"b.example.com","aliases":["legacy.example.com"],"uri":"http://api:8081"}]}` + "\n",
+		},
+		{
+			name:       "target and limit",
+			path:       "/vhost/?target=web:&limit=1",
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"a.example.com","uri":"http://web:8082"}],"next_cursor":"YS5leGFtcGxlLmNvbQ"}` + "\n",
+		},
+		{
+			name:       "nothing matches",
+			path:       "/vhost/?name=nope",
+			statusCode: http.StatusOK,
+			wantBody:   `{}` + "\n",
+		},
+		{
+			name:       "invalid limit",
+			path:       "/vhost/?limit=0",
+			statusCode: http.StatusBadRequest,
+			wantBody:   "400 limit must be a number from 1 to 1000\n",
+		},
+		{
+			name:       "invalid cursor",
+			path:       "/vhost/?cursor=***",
+			statusCode: http.StatusBadRequest,
+			wantBody:   "400 invalid cursor\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			if tc.statusCode == http.StatusOK {
+				mc.EXPECT().List().Return(append([]vhoster.Host{}, hosts...))
+			}
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			assert.Equal(t, tc.wantBody, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package apiserver
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Names of the built-in generators of the random host prefixes.
+const (
+	GeneratorHex    = "hex"    // 32 hex characters
+	GeneratorBase32 = "base32" // 8 lowercase base32 characters
+	GeneratorWords  = "words"  // adjective-noun-number, i.e. "brave-otter-42"
+
+	// DefaultGenerator is the generator used when none is configured.
+	DefaultGenerator = GeneratorHex
+)
+
+// maxRandomAttempts is the number of attempts to generate a random host
+// prefix, that is neither reserved nor taken.
+const maxRandomAttempts = 8
+
+// Generator generates random host prefixes.  The prefix must be a valid DNS
+// label.
+type Generator func() (string, error)
+
+var builtinGenerators = map[string]Generator{
+	GeneratorHex:    hexName,
+	GeneratorBase32: base32Name,
+	GeneratorWords:  wordsName,
+}
+
+// defaultReserved are the prefixes, that are never generated.
+var defaultReserved = []string{
+	"admin", "api", "app", "auth", "dashboard", "dev", "ftp", "login",
+	"mail", "ns", "ns1", "ns2", "root", "smtp", "staging", "status", "www",
+}
+
+// Generators returns the names of the built-in generators.
+func Generators() []string {
+	names := make([]string, 0, len(builtinGenerators))
+	for name := range builtinGenerators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithGenerator registers the custom generator under the name, that can be
+// requested in the random host request, or made the default with
+// WithDefaultGenerator.
+func WithGenerator(name string, gen Generator) Option {
+	return func(g *gateway) {
+		if g.generators == nil {
+			g.generators = make(map[string]Generator)
+		}
+		g.generators[name] = gen
+	}
+}
+
+// WithDefaultGenerator sets the generator used when the random host request
+// does not specify one.
+func WithDefaultGenerator(name string) Option {
+	return func(g *gateway) {
+		g.defaultGen = name
+	}
+}
+
+// WithReservedWords adds the words to the blocklist of the prefixes, that
+// are never generated.
+func WithReservedWords(words ...string) Option {
+	return func(g *gateway) {
+		if g.reserved == nil {
+			g.reserved = make(map[string]bool)
+		}
+		for _, w := range words {
+			g.reserved[strings.ToLower(w)] = true
+		}
+	}
+}
+
+// generator returns the generator by name, empty name means the default
+// one.
+func (g *gateway) generator(name string) (string, Generator, error) {
+	if name == "" {
+		name = g.defaultGen
+	}
+	if name == "" {
+		name = DefaultGenerator
+	}
+	if gen, ok := g.generators[name]; ok {
+		return name, gen, nil
+	}
+	if gen, ok := builtinGenerators[name]; ok {
+		return name, gen, nil
+	}
+	return "", nil, fmt.Errorf("unknown generator %q", name)
+}
+
+// isReserved returns true if the prefix is a reserved name, is in the
+// blocklist, or contains a blocklisted word, i.e. "admin" in
+// "admin-otter-42".
+func (g *gateway) isReserved(prefix string) bool {
+	prefix = strings.ToLower(prefix)
+	if g.isReservedName(g.withDomain(prefix)) {
+		return true
+	}
+	for _, part := range strings.Split(prefix, "-") {
+		if g.reserved[part] {
+			return true
+		}
+		for _, w := range defaultReserved {
+			if part == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hexName() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+var lowerBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+func base32Name() (string, error) {
+	var b [5]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return lowerBase32.EncodeToString(b[:]), nil
+}
+
+var (
+	adjectives = []string{
+		"able", "amber", "bold", "brave", "bright", "calm", "clever", "cool",
+		"crisp", "eager", "fancy", "fast", "gentle", "glad", "golden", "happy",
+		"jolly", "keen", "kind", "lively", "lucky", "merry", "mighty", "misty",
+		"neat", "nimble", "noble", "polite", "proud", "quick", "quiet", "rapid",
+		"shiny", "silent", "silver", "smart", "snowy", "solid", "sunny", "swift",
+		"tidy", "tiny", "vivid", "warm", "wild", "wise", "witty", "young",
+	}
+	nouns = []string{
+		"badger", "bear", "beaver", "bison", "cedar", "comet", "crane", "daisy",
+		"dolphin", "eagle", "falcon", "fern", "finch", "fox", "gecko", "heron",
+		"koala", "lake", "lark", "lemur", "lion", "lynx", "maple", "meadow",
+		"moose", "moth", "newt", "oak", "orca", "otter", "owl", "panda",
+		"pine", "puffin", "quail", "raven", "river", "robin", "seal", "sparrow",
+		"stone", "swan", "tiger", "trout", "tulip", "walrus", "willow", "wolf",
+	}
+)
+
+func wordsName() (string, error) {
+	adj, err := randInt(len(adjectives))
+	if err != nil {
+		return "", err
+	}
+	noun, err := randInt(len(nouns))
+	if err != nil {
+		return "", err
+	}
+	num, err := randInt(1000)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s-%d", adjectives[adj], nouns[noun], num), nil
+}
+
+// randInt returns a uniform random number in [0, n).
+func randInt(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
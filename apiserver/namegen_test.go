@@ -0,0 +1,151 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinGenerators(t *testing.T) {
+	patterns := map[string]*regexp.Regexp{
+		GeneratorHex:    regexp.MustCompile(`^[0-9a-f]{32}$`),
+		GeneratorBase32: regexp.MustCompile(`^[a-z2-7]{8}$`),
+		GeneratorWords:  regexp.MustCompile(`^[a-z]+-[a-z]+-[0-9]{1,3}$`),
+	}
+	assert.Equal(t, []string{GeneratorBase32, GeneratorHex, GeneratorWords}, Generators())
+	for name, re := range patterns {
+		seen := make(map[string]bool)
+		for i := 0; i < 20; i++ {
+			s, err := builtinGenerators[name]()
+			require.NoError(t, err)
+			assert.Regexp(t, re, s, name)
+			seen[s] = true
+		}
+		assert.Greater(t, len(seen), 1, "%s is not random", name)
+	}
+}
+
+func TestGateway_isReserved(t *testing.T) {
+	g := &gateway{}
+	WithReservedWords("Secret")(g)
+	assert.True(t, g.isReserved("api"))
+	assert.True(t, g.isReserved("admin-otter-42"))
+	assert.True(t, g.isReserved("secret"))
+	assert.False(t, g.isReserved("brave-otter-42"))
+	assert.False(t, g.isReserved("rapid"))
+}
+
+// sequence returns the generator, that returns the names in order.
+func sequence(names ...string) Generator {
+	return func() (string, error) {
+		s := names[0]
+		names = names[1:]
+		return s, nil
+	}
+}
+
+func TestHandleRandom(t *testing.T) {
+	testCases := []struct {
+		name       string
+		body       string
+		opts       []Option
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		wantHost   string
+		wantGen    string
+	}{
+		{
+			name:       "default generator",
+			body:       `{"target":"http://localhost:8082"}`,
+			opts:       []Option{WithGenerator(GeneratorHex, sequence("0123456789abcdef0123456789abcdef"))},
+			mockFn:     func(mc *mocks.MockHostManager) { mc.EXPECT().Apply(gomock.Any()).Return(nil) },
+			statusCode: http.StatusOK,
+			wantHost:   "0123456789abcdef0123456789abcdef.example.com",
+			wantGen:    GeneratorHex,
+		},
+		{
+			name:       "requested generator",
+			body:       `{"target":"http://localhost:8082","generator":"words"}`,
+			opts:       []Option{WithGenerator(GeneratorWords, sequence("brave-otter-42"))},
+			mockFn:     func(mc *mocks.MockHostManager) { mc.EXPECT().Apply(gomock.Any()).Return(nil) },
+			statusCode: http.StatusOK,
+			wantHost:   "brave-otter-42.example.com",
+			wantGen:    GeneratorWords,
+		},
+		{
+			name: "configured default and retry on collision",
+			body: `{"target":"http://localhost:8082"}`,
+			opts: []Option{WithGenerator("seq", sequence("taken", "free")), WithDefaultGenerator("seq")},
+			mockFn: func(mc *mocks.MockHostManager) {
+				gomock.InOrder(
+					mc.EXPECT().Apply(gomock.Any()).Return(&vhoster.OpError{Err: vhoster.ErrAlreadyExists}),
+					mc.EXPECT().Apply(gomock.Any()).Return(nil),
+				)
+			},
+			statusCode: http.StatusOK,
+			wantHost:   "free.example.com",
+			wantGen:    "seq",
+		},
+		{
+			name:       "reserved words are skipped",
+			body:       `{"target":"http://localhost:8082","generator":"seq"}`,
+			opts:       []Option{WithGenerator("seq", sequence("api", "www-1", "fine"))},
+			mockFn:     func(mc *mocks.MockHostManager) { mc.EXPECT().Apply(gomock.Any()).Return(nil) },
+			statusCode: http.StatusOK,
+			wantHost:   "fine.example.com",
+			wantGen:    "seq",
+		},
+		{
+			name: "no free names",
+			body: `{"target":"http://localhost:8082","generator":"same"}`,
+			opts: []Option{WithGenerator("same", func() (string, error) { return "same", nil })},
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(gomock.Any()).Return(vhoster.ErrAlreadyExists).Times(maxRandomAttempts)
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "unknown generator",
+			body:       `{"target":"http://localhost:8082","generator":"uuid"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "missing target",
+			body:       `{}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+			for _, opt := range tc.opts {
+				opt(g)
+			}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/random/", strings.NewReader(tc.body)))
+			require.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+			var resp RandomResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tc.wantHost, resp.Hostname)
+			assert.Equal(t, tc.wantGen, resp.Generator)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rusq/vhoster"
+)
+
+// defaultReservedNames are the host prefixes, that can't be claimed through
+// the API, unless configured otherwise.
+var defaultReservedNames = []string{"api", "www"}
+
+// WithReservedNames sets the host prefixes, that can't be claimed through the
+// API, replacing the default ones, "api" and "www".  The hosts, that already
+// have these names, i.e. the ones from the config file, can still be
+// replaced.  Call it without names to allow any name.
+func WithReservedNames(names ...string) Option {
+	return func(g *gateway) {
+		g.reservedNames = make(map[string]bool, len(names))
+		for _, name := range names {
+			g.reservedNames[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// hostPrefix validates and normalises the host prefix, that must be a
+// single DNS label.
+func hostPrefix(prefix string) (string, error) {
+	p, err := vhoster.NormalizeName(prefix)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(p, ".:") || strings.HasPrefix(p, "*") {
+		return "", &vhoster.NameError{Name: prefix, Reason: "host prefix must be a single DNS label"}
+	}
+	return p, nil
+}
+
+// hostName returns the normalised full name of the host, given either as a
+// prefix or as a full name.
+func (g *gateway) hostName(name string) (string, error) {
+	n, err := vhoster.NormalizeName(name)
+	if err != nil {
+		return "", err
+	}
+	return vhoster.NormalizeName(g.fullName(n))
+}
+
+// aliasNames returns the normalised full names of the aliases, given either
+// as prefixes or as full names.
+func (g *gateway) aliasNames(aliases []string) ([]string, error) {
+	ret := make([]string, 0, len(aliases))
+	for _, a := range aliases {
+		alias, err := g.hostName(a)
+		if err != nil {
+			return nil, fmt.Errorf("alias: %w", err)
+		}
+		ret = append(ret, alias)
+	}
+	return ret, nil
+}
+
+// candidates returns the normalised names, that the name given by the caller
+// may refer to: the name itself and the name in the domain.  It returns nil
+// if the name is invalid.
+func (g *gateway) candidates(name string) []string {
+	n, err := vhoster.NormalizeName(name)
+	if err != nil {
+		return nil
+	}
+	names := []string{n}
+	if full, err := vhoster.NormalizeName(g.withDomain(n)); err == nil {
+		names = append(names, full)
+	}
+	return names
+}
+
+// isReservedName returns true if the full host name is one of the reserved
+// names in the domain.
+func (g *gateway) isReservedName(name string) bool {
+	if !strings.HasSuffix(name, "."+g.addr) {
+		return false
+	}
+	prefix := strings.TrimSuffix(name, "."+g.addr)
+	if g.reservedNames != nil {
+		return g.reservedNames[prefix]
+	}
+	for _, r := range defaultReservedNames {
+		if prefix == r {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReserved returns the 403 *httpError, if any of the names is reserved
+// and is not registered yet, i.e. the caller is trying to claim it.
+func (g *gateway) checkReserved(names ...string) error {
+	var registered map[string]bool // populated on the first reserved name
+	for _, name := range names {
+		if !g.isReservedName(name) {
+			continue
+		}
+		if registered == nil {
+			registered = make(map[string]bool)
+			for _, h := range g.vg.List() {
+				for _, n := range append([]string{h.Name}, h.Aliases...) {
+					registered[n] = true
+				}
+			}
+		}
+		if !registered[name] {
+			return &httpError{http.StatusForbidden, fmt.Sprintf("%s is a reserved name", name)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+)
+
+func TestHostNames(t *testing.T) {
+	uri := vhoster.Must(vhoster.Parse("http://localhost:8082"))
+	existing := vhoster.Host{Name: "test.example.com", URI: uri}
+	www := vhoster.Host{Name: "www.example.com", URI: uri}
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		opts       []Option
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		wantBody   string
+	}{
+		{
+			name:   "prefix and aliases are normalised",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"Test","target":"http://localhost:8082","aliases":["Old","München","Other.Example.com."]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionAdd, Host: vhoster.Host{
+					Name:    "test.example.com",
+					Aliases: []string{"old.example.com", "xn--mnchen-3ya.example.com", "other.example.com"},
+					URI:     uri,
+				}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "invalid prefix",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"te_st","target":"http://localhost:8082"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			wantBody:   `400 invalid host name "te_st": label "te_st" must contain only letters, digits and hyphens, and must not start or end with a hyphen` + "\n",
+		},
+		{
+			name:       "prefix with dots",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"a.test","target":"http://localhost:8082"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			wantBody:   `400 invalid host name "a.test": host prefix must be a single DNS label` + "\n",
+		},
+		{
+			name:       "empty prefix",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"target":"http://localhost:8082"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid alias",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"test","target":"http://localhost:8082","aliases":["-old"]}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "reserved prefix",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"WWW","target":"http://localhost:8082"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{existing})
+			},
+			statusCode: http.StatusForbidden,
+			wantBody:   "403 www.example.com is a reserved name\n",
+		},
+		{
+			name:   "reserved alias",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://localhost:8082","aliases":["api"]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return(nil)
+			},
+			statusCode: http.StatusForbidden,
+			wantBody:   "403 api.example.com is a reserved name\n",
+		},
+		{
+			name:   "registered reserved host can be replaced",
+			method: http.MethodPatch,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"www","target":"http://localhost:8082"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{www})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionReplace, Host: www, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "configured reserved names",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"www","target":"http://localhost:8082"}`,
+			opts:   []Option{WithReservedNames("status")},
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionAdd, Host: www, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "get in another case",
+			method: http.MethodGet,
+			path:   "/vhost/TEST.example.com.",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return([]vhoster.Host{existing})
+			},
+			statusCode: http.StatusOK,
+			wantBody:   `{"hosts":[{"name":"test.example.com","uri":"http://localhost:8082"}]}` + "\n",
+		},
+		{
+			name:   "remove in another case",
+			method: http.MethodDelete,
+			path:   "/vhost/Test",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Exists("test").Return(false)
+				mc.EXPECT().Exists("test.example.com").Return(true)
+				mc.EXPECT().List().Return([]vhoster.Host{{Name: "test.example.com"}})
+				mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: "test.example.com"}, Actor: "192.0.2.1"}).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "remove invalid name",
+			method:     http.MethodDelete,
+			path:       "/vhost/te_st",
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:   "batch claims reserved name",
+			method: http.MethodPost,
+			path:   "/batch/",
+			body:   `{"ops":[{"action":"add","host":{"name":"Test","target":"http://localhost:8082","aliases":["www.example.com"]}}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return(nil)
+			},
+			statusCode: http.StatusForbidden,
+			wantBody:   "403 op 0: www.example.com is a reserved name\n",
+		},
+		{
+			name:   "sync claims reserved name",
+			method: http.MethodPut,
+			path:   "/vhost/",
+			body:   `{"hosts":[{"name":"API","target":"http://localhost:8082"}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return(nil).Times(2)
+			},
+			statusCode: http.StatusForbidden,
+			wantBody:   "403 host 0: api.example.com is a reserved name\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+			for _, opt := range tc.opts {
+				opt(g)
+			}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
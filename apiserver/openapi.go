@@ -0,0 +1,91 @@
+package apiserver
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// openAPISpec is the OpenAPI 3 specification of the API.  It must be kept in
+// sync with the handlers, which is verified by the tests.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// docsPage is the Swagger UI page that renders the openAPISpec, it is
+// executed with the base URL of the Swagger UI assets.
+//
+//go:embed docs.html
+var docsPage string
+
+var docsTmpl = template.Must(template.New("docs").Parse(docsPage))
+
+//go:embed swagger-ui
+var swaggerFS embed.FS
+
+// swaggerUI contains the Swagger UI assets served on /docs/, see
+// swagger-ui/README.md.  Only the swaggerUIAssets are served from it.
+var swaggerUI = mustSub(swaggerFS, "swagger-ui")
+
+// swaggerUIAssets are the files of swaggerUI, that are served on /docs/, the
+// rest of the directory, i.e. the README, is not exposed.
+var swaggerUIAssets = map[string]bool{
+	"swagger-ui.css":       true,
+	"swagger-ui-bundle.js": true,
+}
+
+const (
+	// swaggerUIBundle is the asset that must be present to serve the Swagger
+	// UI from the binary.
+	swaggerUIBundle = "swagger-ui-bundle.js"
+	// swaggerUICDN is the base URL of the Swagger UI assets, that are used if
+	// they are not embedded.  The version must match the one in the Makefile.
+	swaggerUICDN = "https://unpkg.com/swagger-ui-dist@5.17.14/"
+)
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// OpenAPISpec returns the OpenAPI 3 specification of the API in JSON format.
+func OpenAPISpec() []byte {
+	return append([]byte(nil), openAPISpec...)
+}
+
+func (g *gateway) handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// handleDocs serves the Swagger UI page on /docs/ and its assets under it.
+func (g *gateway) handleDocs(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/docs/")
+	if name != "" {
+		if !swaggerUIAssets[name] {
+			http.NotFound(w, r)
+			return
+		}
+		http.StripPrefix("/docs/", http.FileServer(http.FS(swaggerUI))).ServeHTTP(w, r)
+		return
+	}
+	base := swaggerUICDN
+	if _, err := fs.Stat(swaggerUI, swaggerUIBundle); err == nil {
+		base = "/docs/"
+	}
+	var buf bytes.Buffer
+	if err := docsTmpl.Execute(&buf, base); err != nil {
+		log.Printf("error rendering the docs page: %s", err)
+		httStatus(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
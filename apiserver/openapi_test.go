@@ -0,0 +1,189 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openAPIDoc is the subset of the OpenAPI document used in tests.
+type openAPIDoc struct {
+	OpenAPI string                                `json:"openapi"`
+	Paths   map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Responses   map[string]json.RawMessage `json:"responses"`
+}
+
+// sampleBodies contains a valid request body for every documented operation
+// that requires one.
+var sampleBodies = map[string]string{
+	"addHost":       `{"host_prefix":"test","target":"http://localhost:8082"}`,
+	"replaceHost":   `{"host_prefix":"test","target":"http://localhost:8082"}`,
+	"addRandomHost": `{"target":"http://localhost:8082"}`,
+	"syncHosts":     `{"hosts":[{"name":"test","target":"http://localhost:8082"}]}`,
+	"applyBatch":    `{"ops":[{"action":"remove","host":{"name":"test"}}]}`,
+	"setFallback":   `{"target":"http://localhost:8090"}`,
+	"extendHost":    `{"ttl":"1h"}`,
+}
+
+// pathParams contains the values for the path parameters.
+var pathParams = strings.NewReplacer("{name}", "test", "{revision}", "1", "{lease_id}", "abc")
+
+func loadSpec(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	require.NoError(t, json.Unmarshal(OpenAPISpec(), &doc))
+	require.True(t, strings.HasPrefix(doc.OpenAPI, "3."), "not an OpenAPI 3 document")
+	return doc
+}
+
+func permissiveMock(t *testing.T) *mocks.MockHostManager {
+	ctrl := gomock.NewController(t)
+	mc := mocks.NewMockHostManager(ctrl)
+	mc.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mc.EXPECT().Replace(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mc.EXPECT().Remove(gomock.Any()).Return(nil).AnyTimes()
+	mc.EXPECT().Exists(gomock.Any()).Return(true).AnyTimes()
+	mc.EXPECT().Apply(gomock.Any()).Return(nil).AnyTimes()
+	mc.EXPECT().History().Return(nil).AnyTimes()
+	mc.EXPECT().Rollback(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	mc.EXPECT().SetFallback(gomock.Any()).Return(nil).AnyTimes()
+	mc.EXPECT().Fallback().Return(nil).AnyTimes()
+	mc.EXPECT().Extend(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(name string, ttl time.Duration, actor string) (vhoster.Host, error) {
+		expires := time.Now().Add(ttl)
+		return vhoster.Host{Name: name, URI: vhoster.Must(vhoster.Parse("http://localhost:8082")), Expires: &expires}, nil
+	}).AnyTimes()
+	mc.EXPECT().Renew(gomock.Any()).Return(vhoster.Host{Name: "test.example.com"}, nil).AnyTimes()
+	mc.EXPECT().Revoke(gomock.Any(), gomock.Any()).Return(vhoster.Host{Name: "test.example.com"}, nil).AnyTimes()
+	mc.EXPECT().Revision().Return(int64(0)).AnyTimes()
+	mc.EXPECT().Watch(gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, int64) (<-chan vhoster.Revision, error) {
+		ch := make(chan vhoster.Revision)
+		close(ch)
+		return ch, nil
+	}).AnyTimes()
+	mc.EXPECT().List().Return([]vhoster.Host{
+		{Name: "test.example.com", URI: vhoster.Must(vhoster.Parse("http://localhost:8082"))},
+	}).AnyTimes()
+	return mc
+}
+
+func TestOpenAPISpec_routes(t *testing.T) {
+	doc := loadSpec(t)
+	require.NotEmpty(t, doc.Paths)
+
+	g := &gateway{vg: permissiveMock(t), addr: "example.com", audit: testAuditLog(t), upgrade: func() error { return nil }}
+	mux := g.handler().(*http.ServeMux)
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		for method, raw := range doc.Paths[path] {
+			if method == "parameters" {
+				continue
+			}
+			var op openAPIOperation
+			require.NoError(t, json.Unmarshal(raw, &op), "%s %s", method, path)
+			t.Run(op.OperationID, func(t *testing.T) {
+				var body *strings.Reader
+				if b, ok := sampleBodies[op.OperationID]; ok {
+					body = strings.NewReader(b)
+				} else {
+					body = strings.NewReader("")
+				}
+				req := httptest.NewRequest(strings.ToUpper(method), pathParams.Replace(path), body)
+
+				_, pattern := mux.Handler(req)
+				require.NotEmpty(t, pattern, "no handler registered for %s %s", method, path)
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+				assert.NotEqual(t, http.StatusMethodNotAllowed, rr.Code, "method not allowed")
+				_, documented := op.Responses[strconv.Itoa(rr.Code)]
+				assert.True(t, documented, "undocumented response code %d", rr.Code)
+			})
+		}
+	}
+}
+
+func TestOpenAPISpec_served(t *testing.T) {
+	g := &gateway{}
+	rr := httptest.NewRecorder()
+	g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, string(openAPISpec), rr.Body.String())
+}
+
+func TestWithDocs(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		g := &gateway{}
+		WithDocs(enabled)(g)
+		rr := httptest.NewRecorder()
+		g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+		if enabled {
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), "/openapi.json")
+		} else {
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+		}
+	}
+}
+
+func TestHandleDocs_assets(t *testing.T) {
+	page := func(g *gateway) string {
+		rr := httptest.NewRecorder()
+		g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	g := &gateway{docs: true}
+
+	orig := swaggerUI
+	t.Cleanup(func() { swaggerUI = orig })
+
+	swaggerUI = fstest.MapFS{}
+	assert.Contains(t, page(g), `src="`+swaggerUICDN+`swagger-ui-bundle.js"`, "CDN is used without the embedded assets")
+
+	swaggerUI = fstest.MapFS{
+		"swagger-ui.css":       {Data: []byte("body{}")},
+		"swagger-ui-bundle.js": {Data: []byte("var SwaggerUIBundle;")},
+		"README.md":            {Data: []byte("# Swagger UI assets")},
+	}
+	body := page(g)
+	assert.Contains(t, body, `href="/docs/swagger-ui.css"`)
+	assert.Contains(t, body, `src="/docs/swagger-ui-bundle.js"`)
+	assert.NotContains(t, body, "unpkg.com")
+
+	rr := httptest.NewRecorder()
+	g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/swagger-ui-bundle.js", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "var SwaggerUIBundle;", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/missing.js", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/README.md", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code, "only the assets are served")
+}
@@ -0,0 +1,50 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rusq/vhoster"
+)
+
+// resolveTimeout is the time limit for resolving the target host name, when
+// it's checked against the target policy.
+const resolveTimeout = 2 * time.Second
+
+// WithTargetPolicy sets the policy, that the targets of the hosts and the
+// fallback must comply with.  Targets, that violate it, are rejected with
+// 403.
+func WithTargetPolicy(p *vhoster.TargetPolicy) Option {
+	return func(g *gateway) {
+		g.policy = p
+	}
+}
+
+// checkTarget checks the target against the target policy, and returns the
+// 403 *httpError, if it is rejected.
+func (g *gateway) checkTarget(ctx context.Context, u *url.URL) error {
+	if g.policy == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	if err := g.policy.CheckResolved(ctx, u); err != nil {
+		return &httpError{http.StatusForbidden, err.Error()}
+	}
+	return nil
+}
+
+// checkTargets checks the targets of the hosts against the target policy.
+func (g *gateway) checkTargets(ctx context.Context, hosts ...vhoster.Host) error {
+	for _, h := range hosts {
+		if h.URI == nil {
+			continue
+		}
+		if err := g.checkTarget(ctx, h.URI.URL()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
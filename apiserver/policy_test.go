@@ -0,0 +1,123 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+)
+
+func TestTargetPolicy(t *testing.T) {
+	policy := &vhoster.TargetPolicy{
+		DenyCIDRs: []netip.Prefix{netip.MustParsePrefix("169.254.0.0/16")},
+		Ports:     []vhoster.PortRange{{From: 80, To: 80}, {From: 8000, To: 8999}},
+	}
+	const metadata = "403 target http://169.254.169.254/ is rejected by the deny_cidrs rule: address 169.254.169.254 is in the denied network 169.254.0.0/16\n"
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		wantBody   string
+	}{
+		{
+			name:   "allowed target",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://10.0.0.1:8082"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Apply(gomock.Any()).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "denied address",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"test","target":"http://169.254.169.254/"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusForbidden,
+			wantBody:   metadata,
+		},
+		{
+			name:       "denied port",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"test","target":"http://10.0.0.1:22"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusForbidden,
+			wantBody:   "403 target http://10.0.0.1:22 is rejected by the ports rule: port 22 is not in the allowed ports 80, 8000-8999\n",
+		},
+		{
+			name:       "denied scheme",
+			method:     http.MethodPatch,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"test","target":"file:///etc/passwd"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusForbidden,
+			wantBody:   "403 target file:///etc/passwd is rejected by the schemes rule: scheme \"file\" is not allowed, must be one of: http, https\n",
+		},
+		{
+			name:       "random host",
+			method:     http.MethodPost,
+			path:       "/random/",
+			body:       `{"target":"http://169.254.169.254/"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusForbidden,
+			wantBody:   metadata,
+		},
+		{
+			name:       "batch",
+			method:     http.MethodPost,
+			path:       "/batch/",
+			body:       `{"ops":[{"action":"add","host":{"name":"test","target":"http://169.254.169.254/"}}]}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusForbidden,
+			wantBody:   "403 op 0: " + strings.TrimPrefix(metadata, "403 "),
+		},
+		{
+			name:   "sync",
+			method: http.MethodPut,
+			path:   "/vhost/",
+			body:   `{"hosts":[{"name":"test","target":"http://169.254.169.254/"}]}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return(nil)
+			},
+			statusCode: http.StatusForbidden,
+			wantBody:   metadata,
+		},
+		{
+			name:       "fallback",
+			method:     http.MethodPut,
+			path:       "/fallback/",
+			body:       `{"target":"http://169.254.169.254/"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusForbidden,
+			wantBody:   metadata,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com", policy: policy}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package apiserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/rusq/vhoster"
+)
+
+// Server is the API server.
+type Server struct {
+	gw  *gateway
+	srv *http.Server
+}
+
+// New creates the API server, that listens on apiAddr and manages the hosts
+// of vg in the domain pubAddr.
+func New(vg HostManager, apiAddr, pubAddr string, opts ...Option) *Server {
+	if addr, err := vhoster.NormalizeName(pubAddr); err == nil {
+		pubAddr = addr
+	}
+	gw := &gateway{
+		addr:    pubAddr,
+		vg:      vg,
+		closing: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(gw)
+	}
+	srv := &http.Server{Addr: apiAddr, Handler: gw.handler()}
+	srv.RegisterOnShutdown(func() { close(gw.closing) })
+	return &Server{
+		gw:  gw,
+		srv: srv,
+	}
+}
+
+// ListenAndServe starts the server.  After Shutdown, it returns
+// http.ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+	return s.srv.ListenAndServe()
+}
+
+// Serve starts the server on the existing listener, i.e. the one inherited
+// from the parent process.  After Shutdown, it returns http.ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	return s.srv.Serve(l)
+}
+
+// Drain makes the readiness endpoint report that the gateway is not ready,
+// so that the load balancers stop sending the new requests to it.  The API
+// keeps serving the requests.
+func (s *Server) Drain() {
+	s.gw.draining.Store(true)
+}
+
+// Shutdown drains and gracefully shuts down the server, waiting for the
+// active requests to complete or for the context to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Drain()
+	return s.srv.Shutdown(ctx)
+}
+
+// handleReady reports whether the gateway is ready to serve requests.  It
+// fails with 503 once the gateway starts draining, or while the audit log
+// can't be written.
+func (g *gateway) handleReady(w http.ResponseWriter, _ *http.Request) {
+	if g.draining.Load() || g.auditFailed.Load() {
+		httStatus(w, http.StatusServiceUnavailable)
+		return
+	}
+	httStatus(w, http.StatusOK)
+}
@@ -0,0 +1,58 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ready(t *testing.T) {
+	s := New(mocks.NewMockHostManager(gomock.NewController(t)), "", "example.com")
+	h := s.srv.Handler
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	s.Drain()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "health is not affected by draining")
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	s := New(mocks.NewMockHostManager(gomock.NewController(t)), addr, "example.com")
+	errc := make(chan error, 1)
+	go func() { errc <- s.ListenAndServe() }()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/ready/")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.True(t, errors.Is(<-errc, http.ErrServerClosed))
+	_, err = http.Get("http://" + addr + "/ready/")
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/rusq/vhoster"
+)
+
+// SyncRequest is the desired state of the route table.
+type SyncRequest struct {
+	// Hosts is the full set of desired hosts.
+	Hosts []HostSpec `json:"hosts"`
+}
+
+// SyncResponse is the response for the sync request.
+type SyncResponse struct {
+	// DryRun is true if the changes were only planned, but not applied.
+	DryRun bool `json:"dry_run,omitempty"`
+	// Changes are the changes that were (or would be) applied.
+	Changes vhoster.Changes `json:"changes"`
+}
+
+// HostSpec is the host in the sync and batch requests.  The expiry, the
+// lease and the pinned state of the replaced hosts are kept, and can't be
+// set in the requests.
+type HostSpec struct {
+	// Name is the name of the host, given either as a prefix or as a full
+	// name, the domain name is appended to the prefixes.
+	Name string `json:"name"`
+	// Target is the URI of the target HTTP server.
+	Target string `json:"target,omitempty"`
+	// Aliases are the other names of the host, given either as prefixes or
+	// as full names.
+	Aliases []string `json:"aliases,omitempty"`
+	// Labels are the labels of the host.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are the free-form attributes of the host.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// specHost returns the host described by the spec, that replaces the current
+// host with the same name, if there is one, see buildHost.  The target is not
+// checked against the target policy.
+func (g *gateway) specHost(s HostSpec, current []vhoster.Host) (vhoster.Host, error) {
+	uri, err := parseTarget(s.Target)
+	if err != nil {
+		return vhoster.Host{}, err
+	}
+	name, err := g.hostName(s.Name)
+	if err != nil {
+		log.Print(err)
+		return vhoster.Host{}, &httpError{http.StatusBadRequest, err.Error()}
+	}
+	return g.buildHost(name, uri, &AddRequest{Aliases: s.Aliases, Labels: s.Labels, Annotations: s.Annotations}, hostByName(current, name))
+}
+
+// indexed prefixes the message of the *httpError with the item of the
+// request, that caused it, i.e. "host 2: ...".
+func indexed(err error, item string, i int) error {
+	var he *httpError
+	if errors.As(err, &he) {
+		return &httpError{he.code, fmt.Sprintf("%s %d: %s", item, i, he.msg)}
+	}
+	return err
+}
+
+// handleSync replaces the whole route table with the desired set of hosts.
+// If the "dry_run" query parameter is true, it only returns the planned
+// changes.
+func (g *gateway) handleSync(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	dryRun, err := parseBool(r.URL.Query().Get("dry_run"))
+	if err != nil {
+		log.Print("invalid dry_run parameter:", err)
+		http.Error(w, "400 invalid dry_run parameter", http.StatusBadRequest)
+		return
+	}
+	var req SyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Print("error decoding body:", err)
+		httStatus(w, http.StatusBadRequest)
+		return
+	}
+	current := g.vg.List()
+	desired, err := g.desiredHosts(current, req.Hosts)
+	if err != nil {
+		log.Print("invalid sync request:", err)
+		writeError(w, err)
+		return
+	}
+
+	changes := vhoster.Diff(current, desired)
+	updated := append(append([]vhoster.Host{}, changes.Add...), changes.Replace...)
+	if err := g.checkTargets(r.Context(), updated...); err != nil {
+		log.Print("invalid sync request:", err)
+		writeError(w, err)
+		return
+	}
+	if !dryRun {
+		if err := g.applyChanges(changes, actor(r)); err != nil {
+			log.Print("error applying changes:", err)
+			if errors.Is(err, vhoster.ErrAlreadyExists) || errors.Is(err, vhoster.ErrNotFound) {
+				http.Error(w, "409 hosts were changed concurrently, try again", http.StatusConflict)
+				return
+			}
+			httStatus(w, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("sync: added %d, replaced %d, removed %d hosts", len(changes.Add), len(changes.Replace), len(changes.Remove))
+	}
+	changes.Add, changes.Replace, changes.Remove = withoutLeases(changes.Add), withoutLeases(changes.Replace), withoutLeases(changes.Remove)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SyncResponse{DryRun: dryRun, Changes: changes}); err != nil {
+		log.Print("error encoding sync response:", err)
+	}
+}
+
+// desiredHosts returns the hosts described by the specs, that replace the
+// current hosts with the same names.  The specs are the full desired state,
+// so the omitted aliases, labels and annotations are removed, while the
+// expiry, the lease and the pinned state of the current hosts are kept.  It
+// returns an *httpError if the hosts are invalid or duplicated.
+func (g *gateway) desiredHosts(current []vhoster.Host, specs []HostSpec) ([]vhoster.Host, error) {
+	seen := make(map[string]struct{}, len(specs))
+	ret := make([]vhoster.Host, 0, len(specs))
+	for i, s := range specs {
+		h, err := g.specHost(s, current)
+		if err != nil {
+			return nil, indexed(err, "host", i)
+		}
+		if s.Aliases == nil {
+			h.Aliases = nil
+		}
+		if s.Labels == nil {
+			h.Labels = nil
+		}
+		if s.Annotations == nil {
+			h.Annotations = nil
+		}
+		for _, name := range append([]string{h.Name}, h.Aliases...) {
+			if _, ok := seen[name]; ok {
+				return nil, &httpError{http.StatusBadRequest, fmt.Sprintf("host %d: duplicate host %q", i, name)}
+			}
+			seen[name] = struct{}{}
+		}
+		ret = append(ret, h)
+	}
+	return ret, nil
+}
+
+// applyChanges applies the changes to the host manager on behalf of the
+// actor, all or nothing.
+// Hosts are removed first, so that their names are released before anything
+// is added.
+func (g *gateway) applyChanges(c vhoster.Changes, actor string) error {
+	ops := make([]vhoster.Op, 0, len(c.Remove)+len(c.Replace)+len(c.Add))
+	for _, h := range c.Remove {
+		ops = append(ops, vhoster.Op{Action: vhoster.ActionRemove, Host: h, Actor: actor})
+	}
+	for _, h := range c.Replace {
+		ops = append(ops, vhoster.Op{Action: vhoster.ActionReplace, Host: h, Actor: actor})
+	}
+	for _, h := range c.Add {
+		ops = append(ops, vhoster.Op{Action: vhoster.ActionAdd, Host: h, Actor: actor})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return g.vg.Apply(ops...)
+}
+
+// parseBool parses the boolean query parameter, empty value is false.
+func parseBool(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
@@ -0,0 +1,158 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSync(t *testing.T) {
+	current := []vhoster.Host{
+		{Name: "keep.example.com", URI: vhoster.Must(vhoster.Parse("http://keep:80"))},
+		{Name: "change.example.com", URI: vhoster.Must(vhoster.Parse("http://old:80"))},
+		{Name: "gone.example.com", URI: vhoster.Must(vhoster.Parse("http://gone:80"))},
+	}
+	const body = `{"hosts":[
+		{"name":"keep","target":"http://keep:80"},
+		{"name":"change.example.com","target":"http://new:80"},
+		{"name":"new","target":"http://new:80"}
+	]}`
+
+	testCases := []struct {
+		name       string
+		query      string
+		body       string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		want       *SyncResponse
+	}{
+		{
+			name:  "applies changes",
+			body:  body,
+			query: "",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return(current)
+				mc.EXPECT().Apply(
+					vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: "gone.example.com", URI: vhoster.Must(vhoster.Parse("http://gone:80"))}, Actor: "192.0.2.1"},
+					vhoster.Op{Action: vhoster.ActionReplace, Host: vhoster.Host{Name: "change.example.com", URI: vhoster.Must(vhoster.Parse("http://new:80"))}, Actor: "192.0.2.1"},
+					vhoster.Op{Action: vhoster.ActionAdd, Host: vhoster.Host{Name: "new.example.com", URI: vhoster.Must(vhoster.Parse("http://new:80"))}, Actor: "192.0.2.1"},
+				).Return(nil)
+			},
+			statusCode: http.StatusOK,
+			want: &SyncResponse{
+				Changes: vhoster.Changes{
+					Add:     []vhoster.Host{{Name: "new.example.com", URI: vhoster.Must(vhoster.Parse("http://new:80"))}},
+					Replace: []vhoster.Host{{Name: "change.example.com", URI: vhoster.Must(vhoster.Parse("http://new:80"))}},
+					Remove:  []vhoster.Host{{Name: "gone.example.com", URI: vhoster.Must(vhoster.Parse("http://gone:80"))}},
+				},
+			},
+		},
+		{
+			name:  "dry run",
+			body:  body,
+			query: "?dry_run=true",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().List().Return(current)
+			},
+			statusCode: http.StatusOK,
+			want: &SyncResponse{
+				DryRun: true,
+				Changes: vhoster.Changes{
+					Add:     []vhoster.Host{{Name: "new.example.com", URI: vhoster.Must(vhoster.Parse("http://new:80"))}},
+					Replace: []vhoster.Host{{Name: "change.example.com", URI: vhoster.Must(vhoster.Parse("http://new:80"))}},
+					Remove:  []vhoster.Host{{Name: "gone.example.com", URI: vhoster.Must(vhoster.Parse("http://gone:80"))}},
+				},
+			},
+		},
+		{
+			name:       "duplicate hosts",
+			body:       `{"hosts":[{"name":"a","target":"http://a:80"},{"name":"a.example.com","target":"http://b:80"}]}`,
+			mockFn:     func(mc *mocks.MockHostManager) { mc.EXPECT().List().Return(current) },
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "missing target",
+			body:       `{"hosts":[{"name":"a"}]}`,
+			mockFn:     func(mc *mocks.MockHostManager) { mc.EXPECT().List().Return(current) },
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid dry_run",
+			query:      "?dry_run=maybe",
+			body:       body,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			req := httptest.NewRequest(http.MethodPut, "/vhost/"+tc.query, strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, req)
+
+			require.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if tc.want != nil {
+				var got SyncResponse
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+				assert.Equal(t, *tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleSync_keepsState(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	current := []vhoster.Host{{
+		Name:    "a.example.com",
+		URI:     vhoster.Must(vhoster.Parse("http://old:80")),
+		Labels:  map[string]string{"env": "prod"},
+		Expires: &expires,
+		Lease:   &vhoster.Lease{ID: "abc", Interval: time.Minute},
+		Pinned:  true,
+	}}
+	// the attributes, that are not part of the spec, are ignored.
+	const body = `{"hosts":[{"name":"a","target":"http://new:80","pinned":false,"expires":"2000-01-01T00:00:00Z","lease":{"id":"x","interval":"1s"}}]}`
+
+	testCases := []struct {
+		name       string
+		applyErr   error
+		statusCode int
+	}{
+		{"replaced", nil, http.StatusOK},
+		{"changed concurrently", &vhoster.OpError{Err: vhoster.ErrNotFound}, http.StatusConflict},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			mc.EXPECT().List().Return(current)
+			want := vhoster.Host{
+				Name:    "a.example.com",
+				URI:     vhoster.Must(vhoster.Parse("http://new:80")),
+				Expires: &expires,
+				Lease:   &vhoster.Lease{ID: "abc", Interval: time.Minute},
+				Pinned:  true,
+			}
+			mc.EXPECT().Apply(vhoster.Op{Action: vhoster.ActionReplace, Host: want, Actor: "192.0.2.1"}).Return(tc.applyErr)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/vhost/", strings.NewReader(body)))
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+		})
+	}
+}
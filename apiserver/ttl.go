@@ -0,0 +1,92 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rusq/vhoster"
+)
+
+// Duration is the duration, given either as a string, i.e. "1h30m", or as
+// the number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON parses the duration string or the number of seconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var secs float64
+		if err := json.Unmarshal(b, &secs); err != nil {
+			return fmt.Errorf("invalid duration: %s", b)
+		}
+		*d = Duration(secs * float64(time.Second))
+		return nil
+	}
+	td, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(td)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ExtendRequest is the request to extend the TTL of the host.
+type ExtendRequest struct {
+	// TTL is the new time to live of the host, counted from now.
+	TTL Duration `json:"ttl"`
+}
+
+// ExtendResponse is the response for the extend request.
+type ExtendResponse struct {
+	Hostname string    `json:"hostname"`
+	Expires  time.Time `json:"expires"`
+}
+
+// handleExtend sets the expiry time of the host given in the path to the
+// TTL from now.
+func (g *gateway) handleExtend(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	name := r.URL.Path[len("/extend/"):]
+	if name == "" {
+		http.Error(w, "400 missing host name", http.StatusBadRequest)
+		return
+	}
+	var req ExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Print("error decoding body:", err)
+		httStatus(w, http.StatusBadRequest)
+		return
+	}
+	vhost, err := g.hostName(name)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "404 host does not exist", http.StatusNotFound)
+		return
+	}
+	h, err := g.vg.Extend(vhost, time.Duration(req.TTL), actor(r))
+	if err != nil {
+		log.Printf("error extending host %q: %s", vhost, err)
+		switch {
+		case errors.Is(err, vhoster.ErrInvalidTTL):
+			http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+		case errors.Is(err, vhoster.ErrNotFound):
+			http.Error(w, "404 host does not exist", http.StatusNotFound)
+		default:
+			httStatus(w, http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("host %q extended until %s by %s", h.Name, h.Expires.Format(time.RFC3339), actor(r))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ExtendResponse{Hostname: h.Name, Expires: *h.Expires}); err != nil {
+		log.Printf("error encoding response for vhost %q: %s", vhost, err)
+	}
+}
@@ -0,0 +1,196 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuration_UnmarshalJSON(t *testing.T) {
+	var req ExtendRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"ttl":"1h30m"}`), &req))
+	assert.Equal(t, Duration(90*time.Minute), req.TTL)
+	require.NoError(t, json.Unmarshal([]byte(`{"ttl":90}`), &req))
+	assert.Equal(t, Duration(90*time.Second), req.TTL)
+	assert.Error(t, json.Unmarshal([]byte(`{"ttl":"soon"}`), &req))
+	assert.Error(t, json.Unmarshal([]byte(`{"ttl":true}`), &req))
+}
+
+func TestHandleAdd_ttl(t *testing.T) {
+	target := vhoster.Must(vhoster.Parse("http://localhost:8082"))
+	expires := time.Now().Add(time.Hour).UTC()
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		mockFn     func(mc *mocks.MockHostManager, got *vhoster.Op)
+		statusCode int
+		wantTTL    time.Duration // expected ttl of the applied host, 0 - no expiry
+		wantLease  bool          // the applied host must have the lease
+	}{
+		{
+			name:   "add with ttl",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://localhost:8082","ttl":"1h"}`,
+			mockFn: func(mc *mocks.MockHostManager, got *vhoster.Op) {
+				mc.EXPECT().Apply(gomock.Any()).DoAndReturn(func(ops ...vhoster.Op) error { *got = ops[0]; return nil })
+			},
+			statusCode: http.StatusOK,
+			wantTTL:    time.Hour,
+		},
+		{
+			name:   "random with ttl in seconds",
+			method: http.MethodPost,
+			path:   "/random/",
+			body:   `{"target":"http://localhost:8082","ttl":60}`,
+			mockFn: func(mc *mocks.MockHostManager, got *vhoster.Op) {
+				mc.EXPECT().Apply(gomock.Any()).DoAndReturn(func(ops ...vhoster.Op) error { *got = ops[0]; return nil })
+			},
+			statusCode: http.StatusOK,
+			wantTTL:    time.Minute,
+		},
+		{
+			name:   "add with lease",
+			method: http.MethodPost,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://localhost:8082","lease":"30s"}`,
+			mockFn: func(mc *mocks.MockHostManager, got *vhoster.Op) {
+				mc.EXPECT().Apply(gomock.Any()).DoAndReturn(func(ops ...vhoster.Op) error { *got = ops[0]; return nil })
+			},
+			statusCode: http.StatusOK,
+			wantTTL:    30 * time.Second,
+			wantLease:  true,
+		},
+		{
+			name:       "ttl and lease",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"test","target":"http://localhost:8082","ttl":"1h","lease":"30s"}`,
+			mockFn:     func(mc *mocks.MockHostManager, got *vhoster.Op) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "negative ttl",
+			method:     http.MethodPost,
+			path:       "/vhost/",
+			body:       `{"host_prefix":"test","target":"http://localhost:8082","ttl":"-1h"}`,
+			mockFn:     func(mc *mocks.MockHostManager, got *vhoster.Op) {},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "replace keeps the expiry",
+			method: http.MethodPatch,
+			path:   "/vhost/",
+			body:   `{"host_prefix":"test","target":"http://localhost:8083"}`,
+			mockFn: func(mc *mocks.MockHostManager, got *vhoster.Op) {
+				mc.EXPECT().List().Return([]vhoster.Host{{Name: "test.example.com", URI: target, Expires: &expires}})
+				mc.EXPECT().Apply(gomock.Any()).DoAndReturn(func(ops ...vhoster.Op) error { *got = ops[0]; return nil })
+			},
+			statusCode: http.StatusOK,
+			wantTTL:    time.Hour,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			var got vhoster.Op
+			tc.mockFn(mc, &got)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			require.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if tc.wantTTL == 0 {
+				return
+			}
+			require.NotNil(t, got.Host.Expires)
+			assert.WithinDuration(t, time.Now().Add(tc.wantTTL), *got.Host.Expires, time.Minute)
+			var resp AddResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, got.Host.Expires.Unix(), resp.Expires.Unix())
+			if tc.wantLease {
+				require.NotNil(t, got.Host.Lease)
+				assert.Equal(t, tc.wantTTL, got.Host.Lease.Interval)
+				assert.Equal(t, got.Host.Lease.ID, resp.LeaseID)
+			} else {
+				assert.Empty(t, resp.LeaseID)
+			}
+		})
+	}
+}
+
+func TestHandleExtend(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		name       string
+		path       string
+		body       string
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		want       string
+	}{
+		{
+			name: "success",
+			path: "/extend/test",
+			body: `{"ttl":"2h"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Extend("test.example.com", 2*time.Hour, "192.0.2.1").Return(vhoster.Host{Name: "test.example.com", Expires: &expires}, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `{"hostname":"test.example.com","expires":"2030-01-02T03:04:05Z"}` + "\n",
+		},
+		{
+			name:       "missing name",
+			path:       "/extend/",
+			body:       `{"ttl":"2h"}`,
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			want:       "400 missing host name\n",
+		},
+		{
+			name: "invalid ttl",
+			path: "/extend/test.example.com",
+			body: `{"ttl":0}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Extend("test.example.com", time.Duration(0), "192.0.2.1").Return(vhoster.Host{}, vhoster.ErrInvalidTTL)
+			},
+			statusCode: http.StatusBadRequest,
+			want:       "400 ttl must be positive\n",
+		},
+		{
+			name: "not found",
+			path: "/extend/test",
+			body: `{"ttl":"2h"}`,
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Extend("test.example.com", 2*time.Hour, "192.0.2.1").Return(vhoster.Host{}, vhoster.ErrNotFound)
+			},
+			statusCode: http.StatusNotFound,
+			want:       "404 host does not exist\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+			assert.Equal(t, tc.statusCode, rr.Code)
+			assert.Equal(t, tc.want, rr.Body.String())
+		})
+	}
+}
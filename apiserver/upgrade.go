@@ -0,0 +1,29 @@
+package apiserver
+
+import (
+	"log"
+	"net/http"
+)
+
+// WithUpgrade enables the endpoint that starts the upgrade of the gateway
+// process by calling fn.  fn must not block, the upgrade runs in the
+// background.  If it returns an error, i.e. the upgrade is already in
+// progress, the endpoint responds with 409.
+func WithUpgrade(fn func() error) Option {
+	return func(g *gateway) {
+		g.upgrade = fn
+	}
+}
+
+// handleUpgrade starts the upgrade of the gateway process.
+func (g *gateway) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	if err := g.upgrade(); err != nil {
+		log.Printf("upgrade requested by %s: %s", actor(r), err)
+		http.Error(w, "409 "+err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("upgrade requested by %s", actor(r))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(http.StatusText(http.StatusAccepted) + "\n"))
+}
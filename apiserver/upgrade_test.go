@@ -0,0 +1,36 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_handleUpgrade(t *testing.T) {
+	var calls int
+	g := &gateway{addr: "example.com"}
+	WithUpgrade(func() error {
+		calls++
+		if calls > 1 {
+			return errors.New("upgrade is already in progress")
+		}
+		return nil
+	})(g)
+	h := g.handler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upgrade/", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upgrade/", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "409 upgrade is already in progress\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	(&gateway{}).handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upgrade/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "disabled by default")
+}
@@ -0,0 +1,116 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rusq/vhoster"
+)
+
+// heartbeatInterval is the interval of the keep-alive comments in the event
+// stream, so that the idle connections are not closed by the proxies.
+var heartbeatInterval = 15 * time.Second
+
+// handleWatch streams the changes of the route table as Server-Sent Events.
+// Every event has the revision number as its id, the action as its type, and
+// the revision as data.  The stream starts after the revision given in the
+// "revision" query parameter or in the Last-Event-ID header, and from the
+// current revision if neither is set.  The stream ends, if the client falls
+// behind, it then reconnects with the last received id.
+func (g *gateway) handleWatch(w http.ResponseWriter, r *http.Request) {
+	since, err := g.watchRevision(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		log.Print("streaming is not supported by the response writer")
+		httStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		// the streams are ended on shutdown, otherwise it would wait for
+		// them forever.
+		select {
+		case <-g.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ch, err := g.vg.Watch(ctx, since)
+	if err != nil {
+		log.Printf("watch from revision %d: %s", since, err)
+		switch {
+		case errors.Is(err, vhoster.ErrRevisionNotFound):
+			http.Error(w, fmt.Sprintf("410 revision %d is not in the history, list the hosts and watch again", since), http.StatusGone)
+		case errors.Is(err, vhoster.ErrClosed):
+			httStatus(w, http.StatusServiceUnavailable)
+		default:
+			httStatus(w, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// the initial id lets the client resume from the starting revision, even
+	// if the stream ends before the first event.
+	fmt.Fprintf(w, ": watching from revision %d\nid: %d\n\n", since, since)
+	fl.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rev, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(revisionWithoutLease(rev))
+			if err != nil {
+				log.Printf("error encoding revision %d: %s", rev.ID, err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", rev.ID, rev.Action, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		fl.Flush()
+	}
+}
+
+// watchRevision returns the revision to watch from.
+func (g *gateway) watchRevision(r *http.Request) (int64, error) {
+	s := r.URL.Query().Get("revision")
+	if s == "" {
+		s = r.Header.Get("Last-Event-ID")
+	}
+	if s == "" {
+		return g.vg.Revision(), nil
+	}
+	since, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || since < 0 {
+		log.Printf("invalid revision %q", s)
+		return 0, &httpError{http.StatusBadRequest, "invalid revision"}
+	}
+	return since, nil
+}
@@ -0,0 +1,151 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/mocks"
+)
+
+func TestHandleWatch(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	revs := []vhoster.Revision{
+		// the lease is not published.
+		{ID: 6, Time: ts, Action: vhoster.ActionAdd, Host: vhoster.Host{Name: "a.example.com", URI: vhoster.Must(vhoster.Parse("http://localhost:8082")), Lease: &vhoster.Lease{ID: "secret", Interval: time.Minute}}},
+		{ID: 7, Time: ts, Action: vhoster.ActionExpire, Host: vhoster.Host{Name: "b.example.com"}},
+	}
+	// stream returns the closed channel with the revisions.
+	stream := func() <-chan vhoster.Revision {
+		ch := make(chan vhoster.Revision, len(revs))
+		for _, r := range revs {
+			ch <- r
+		}
+		close(ch)
+		return ch
+	}
+	const events = ": watching from revision 5\nid: 5\n\n" +
+		"id: 6\nevent: add\ndata: {\"revision\":6,\"time\":\"2024-01-02T03:04:05Z\",\"action\":\"add\",\"host\":{\"name\":\"a.example.com\",\"uri\":\"http://localhost:8082\"}}\n\n" +
+		"id: 7\nevent: expire\ndata: {\"revision\":7,\"time\":\"2024-01-02T03:04:05Z\",\"action\":\"expire\",\"host\":{\"name\":\"b.example.com\",\"uri\":null}}\n\n"
+
+	testCases := []struct {
+		name       string
+		path       string
+		header     http.Header
+		mockFn     func(mc *mocks.MockHostManager)
+		statusCode int
+		wantBody   string
+	}{
+		{
+			name: "from the current revision",
+			path: "/watch/",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Revision().Return(int64(5))
+				mc.EXPECT().Watch(gomock.Any(), int64(5)).Return(stream(), nil)
+			},
+			statusCode: http.StatusOK,
+			wantBody:   events,
+		},
+		{
+			name: "from the revision",
+			path: "/watch/?revision=5",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Watch(gomock.Any(), int64(5)).Return(stream(), nil)
+			},
+			statusCode: http.StatusOK,
+			wantBody:   events,
+		},
+		{
+			name:   "from the last event id",
+			path:   "/watch/",
+			header: http.Header{"Last-Event-Id": {"5"}},
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Watch(gomock.Any(), int64(5)).Return(stream(), nil)
+			},
+			statusCode: http.StatusOK,
+			wantBody:   events,
+		},
+		{
+			name:       "invalid revision",
+			path:       "/watch/?revision=abc",
+			mockFn:     func(mc *mocks.MockHostManager) {},
+			statusCode: http.StatusBadRequest,
+			wantBody:   "400 invalid revision\n",
+		},
+		{
+			name: "revision is not in the history",
+			path: "/watch/?revision=1",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Watch(gomock.Any(), int64(1)).Return(nil, vhoster.ErrRevisionNotFound)
+			},
+			statusCode: http.StatusGone,
+			wantBody:   "410 revision 1 is not in the history, list the hosts and watch again\n",
+		},
+		{
+			name: "gateway is closed",
+			path: "/watch/",
+			mockFn: func(mc *mocks.MockHostManager) {
+				mc.EXPECT().Revision().Return(int64(5))
+				mc.EXPECT().Watch(gomock.Any(), int64(5)).Return(nil, vhoster.ErrClosed)
+			},
+			statusCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mc := mocks.NewMockHostManager(ctrl)
+			tc.mockFn(mc)
+			g := &gateway{vg: mc, addr: "example.com"}
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			rr := httptest.NewRecorder()
+			g.handler().ServeHTTP(rr, req)
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			}
+			if tc.statusCode == http.StatusOK {
+				assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestServer_shutdownEndsWatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mc := mocks.NewMockHostManager(ctrl)
+	mc.EXPECT().Revision().Return(int64(0))
+	mc.EXPECT().Watch(gomock.Any(), int64(0)).Return(make(chan vhoster.Revision), nil)
+
+	s := New(mc, "127.0.0.1:0", "example.com")
+	srv := httptest.NewUnstartedServer(s.srv.Handler)
+	srv.Config = s.srv
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/watch/")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown is blocked by the event stream")
+	}
+}
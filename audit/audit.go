@@ -0,0 +1,251 @@
+// Package audit implements the tamper-evident audit log of the changes made
+// through the management API.
+//
+// The log is an append-only file with one JSON entry per line.  Every entry
+// contains the hash of the previous entry, and its own hash, computed over
+// its contents and the previous hash, so that modification, removal or
+// reordering of the entries breaks the chain and is detected by Verify.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrTampered is returned when the hash chain of the log is broken.
+var ErrTampered = errors.New("audit log hash chain is broken")
+
+// Entry is a single audit log record.
+type Entry struct {
+	// Seq is the sequence number of the entry, starting from 1.
+	Seq int64 `json:"seq"`
+	// Time is the time of the request.
+	Time time.Time `json:"time"`
+	// Actor is the identity of the caller: the name claimed by the caller,
+	// followed by "(unverified)", or the IP address of the caller.
+	Actor string `json:"actor"`
+	// SourceIP is the IP address of the caller.
+	SourceIP string `json:"source_ip"`
+	// Method and Path are the method and the path of the request.
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Hosts are the host names affected by the request.
+	Hosts []string `json:"hosts,omitempty"`
+	// Request is the request body.
+	Request json.RawMessage `json:"request,omitempty"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Result is the short description of the result.
+	Result string `json:"result"`
+	// PrevHash is the hash of the previous entry, empty for the first one.
+	PrevHash string `json:"prev_hash"`
+	// Hash is the hash of this entry.
+	Hash string `json:"hash"`
+}
+
+// computeHash returns the hash of the entry, computed over all fields except
+// the Hash itself.
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Filter selects the entries returned by Query.  Zero values match
+// everything.
+type Filter struct {
+	Host  string    // entries that affected this host
+	Since time.Time // entries made at or after this time
+	Until time.Time // entries made before this time
+	Limit int       // return at most this number of the most recent entries
+}
+
+func (f Filter) match(e *Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if f.Host == "" {
+		return true
+	}
+	for _, h := range e.Hosts {
+		if h == f.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// Log is the append-only audit log file.
+type Log struct {
+	path string
+
+	mu       sync.Mutex
+	f        *os.File
+	seq      int64
+	lastHash string
+}
+
+// Open opens the audit log at path, creating it if necessary.  It verifies
+// the hash chain of the existing entries and returns ErrTampered if it is
+// broken.
+func Open(path string) (*Log, error) {
+	l := &Log{path: path}
+	if rf, err := os.Open(path); err == nil {
+		last, err := verify(rf)
+		rf.Close()
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.seq, l.lastHash = last.Seq, last.Hash
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l.f = f
+	return l, nil
+}
+
+// Append assigns the sequence number and the hashes to the entry, writes it
+// to the log and syncs the log to disk.  It returns the written entry.
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return Entry{}, os.ErrClosed
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Seq = l.seq + 1
+	e.PrevHash = l.lastHash
+	h, err := e.computeHash()
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Hash = h
+	b, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return Entry{}, err
+	}
+	if err := l.f.Sync(); err != nil {
+		return Entry{}, err
+	}
+	l.seq, l.lastHash = e.Seq, e.Hash
+	return e, nil
+}
+
+// Query returns the entries matching the filter, the oldest first.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rf, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer rf.Close()
+
+	var ret []Entry
+	err = scan(rf, func(e *Entry) error {
+		if f.match(e) {
+			ret = append(ret, *e)
+			if f.Limit > 0 && len(ret) > f.Limit {
+				ret = ret[1:]
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Verify checks the hash chain of the log read from r.  It returns an error
+// wrapping ErrTampered if the chain is broken.
+func Verify(r io.Reader) error {
+	_, err := verify(r)
+	return err
+}
+
+// verify checks the hash chain and returns the last entry.
+func verify(r io.Reader) (*Entry, error) {
+	var last *Entry
+	err := scan(r, func(e *Entry) error {
+		var (
+			wantSeq  int64 = 1
+			wantPrev string
+		)
+		if last != nil {
+			wantSeq, wantPrev = last.Seq+1, last.Hash
+		}
+		if e.Seq != wantSeq {
+			return fmt.Errorf("%w: entry %d: unexpected sequence number %d", ErrTampered, wantSeq, e.Seq)
+		}
+		if e.PrevHash != wantPrev {
+			return fmt.Errorf("%w: entry %d: previous hash mismatch", ErrTampered, e.Seq)
+		}
+		h, err := e.computeHash()
+		if err != nil {
+			return err
+		}
+		if h != e.Hash {
+			return fmt.Errorf("%w: entry %d: hash mismatch", ErrTampered, e.Seq)
+		}
+		ent := *e
+		last = &ent
+		return nil
+	})
+	return last, err
+}
+
+// scan calls fn for every entry read from r.
+func scan(r io.Reader, fn func(*Entry) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("%w: line %d: %s", ErrTampered, n, err)
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
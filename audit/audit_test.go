@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func writeEntries(t *testing.T, path string) {
+	t.Helper()
+	l, err := Open(path)
+	require.NoError(t, err)
+	defer l.Close()
+	entries := []Entry{
+		{Time: t0, Actor: "alice", Method: "POST", Path: "/vhost/", Hosts: []string{"a.example.com"}, Request: []byte(`{"host_prefix": "a"}`), Status: 200, Result: "ok"},
+		{Time: t0.Add(time.Hour), Actor: "bob", Method: "DELETE", Path: "/vhost/a", Hosts: []string{"a.example.com"}, Status: 200, Result: "ok"},
+		{Time: t0.Add(2 * time.Hour), Actor: "bob", Method: "POST", Path: "/random/", Hosts: []string{"x.example.com"}, Status: 200, Result: "ok"},
+	}
+	for _, e := range entries {
+		_, err := l.Append(e)
+		require.NoError(t, err)
+	}
+}
+
+func TestLog_AppendQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeEntries(t, path)
+
+	// reopen continues the chain.
+	l, err := Open(path)
+	require.NoError(t, err)
+	defer l.Close()
+	e, err := l.Append(Entry{Time: t0.Add(3 * time.Hour), Actor: "carol", Hosts: []string{"a.example.com"}, Status: 409, Result: "host already exists"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), e.Seq)
+	assert.NotEmpty(t, e.PrevHash)
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		wantSeq []int64
+	}{
+		{"all", Filter{}, []int64{1, 2, 3, 4}},
+		{"by host", Filter{Host: "a.example.com"}, []int64{1, 2, 4}},
+		{"time range", Filter{Since: t0.Add(time.Hour), Until: t0.Add(3 * time.Hour)}, []int64{2, 3}},
+		{"limit keeps the most recent", Filter{Host: "a.example.com", Limit: 2}, []int64{2, 4}},
+		{"no match", Filter{Host: "b.example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.Query(tt.filter)
+			require.NoError(t, err)
+			var seqs []int64
+			for _, e := range got {
+				seqs = append(seqs, e.Seq)
+			}
+			assert.Equal(t, tt.wantSeq, seqs)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeEntries(t, path)
+	orig, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, Verify(bytes.NewReader(orig)))
+
+	lines := bytes.SplitAfter(orig, []byte("\n"))
+	tests := []struct {
+		name   string
+		tamper func() []byte
+	}{
+		{"modified entry", func() []byte {
+			return bytes.Replace(orig, []byte(`"actor":"bob"`), []byte(`"actor":"eve"`), 1)
+		}},
+		{"removed entry", func() []byte {
+			return bytes.Join([][]byte{lines[0], lines[2]}, nil)
+		}},
+		{"reordered entries", func() []byte {
+			return bytes.Join([][]byte{lines[1], lines[0], lines[2]}, nil)
+		}},
+		{"garbage", func() []byte {
+			return append(append([]byte{}, orig...), []byte("{not json\n")...)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := tt.tamper()
+			assert.ErrorIs(t, Verify(bytes.NewReader(tampered)), ErrTampered)
+
+			require.NoError(t, os.WriteFile(path, tampered, 0o600))
+			_, err := Open(path)
+			assert.ErrorIs(t, err, ErrTampered, "open must refuse the tampered log")
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package vhoster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrInvalidOp is returned when the batch operation is malformed.
+var ErrInvalidOp = errors.New("invalid operation")
+
+// Action is the type of the operation on the route table.
+type Action string
+
+const (
+	ActionAdd     Action = "add"     // add a new host
+	ActionReplace Action = "replace" // replace or add the host
+	ActionRemove  Action = "remove"  // remove an existing host
+	// ActionExpire is recorded in the history, when the expired host is
+	// removed by the gateway.  It can't be requested in the Op.
+	ActionExpire Action = "expire"
+)
+
+// Op is a single operation on the route table.
+type Op struct {
+	// Action is the operation to perform.
+	Action Action `json:"action"`
+	// Host is the host to operate on.  Only the Name is required for
+	// ActionRemove.
+	Host Host `json:"host"`
+	// Actor is the identity of the one who requested the operation, it is
+	// recorded in the history.
+	Actor string `json:"actor,omitempty"`
+}
+
+// Validate checks that the operation is well-formed.
+func (op Op) Validate() error {
+	switch op.Action {
+	case ActionAdd, ActionReplace:
+		if err := op.Host.Validate(); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidOp, err)
+		}
+	case ActionRemove:
+		if op.Host.Name == "" {
+			return fmt.Errorf("%w: empty host name", ErrInvalidOp)
+		}
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidOp, op.Action)
+	}
+	return nil
+}
+
+// OpError is returned by Apply when one of the operations fails.
+type OpError struct {
+	Index int   // index of the failed operation in the batch
+	Op    Op    // the failed operation
+	Err   error // the underlying error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("operation %d (%s %q): %s", e.Index, e.Op.Action, e.Op.Host.Name, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Apply applies the operations to the route table in order, all or nothing.
+// All operations are validated against the current state of the route table
+// before any of them is applied, and if one of them fails, the ones that were
+// already applied are rolled back.  The returned error is an *OpError.
+// Every applied operation is recorded in the history as a separate revision.
+func (g *Gateway) Apply(ops ...Op) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, err := g.applyOps(ops)
+	return err
+}
+
+// applyOps is concurrently unsafe version of Apply, that returns the recorded
+// revisions.  The caller should take care of locking the mutex.
+func (g *Gateway) applyOps(ops []Op) ([]Revision, error) {
+	ops, err := normalizeOps(ops)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.validateOps(ops); err != nil {
+		return nil, err
+	}
+
+	var (
+		undo    []func() error // inverse operations of the ones applied
+		changes []Revision     // changes to record, if all operations succeed
+	)
+	for i, op := range ops {
+		prev := g.lookup(op.Host.Name)
+		inverse, err := g.apply(op)
+		if err != nil {
+			g.rollback(undo)
+			return nil, &OpError{Index: i, Op: op, Err: err}
+		}
+		undo = append(undo, inverse)
+		h := op.Host
+		if op.Action == ActionRemove {
+			h = Host{Name: h.Name}
+		}
+		changes = append(changes, Revision{Actor: op.Actor, Action: op.Action, Host: h, Previous: prev})
+	}
+	revs := make([]Revision, 0, len(changes))
+	for _, c := range changes {
+		revs = append(revs, g.commit(c))
+	}
+	return revs, nil
+}
+
+// normalizeOps returns the copy of the operations with the normalised host
+// names and aliases.
+func normalizeOps(ops []Op) ([]Op, error) {
+	ret := make([]Op, len(ops))
+	for i, op := range ops {
+		if op.Host.Name != "" {
+			h, err := op.Host.normalize()
+			if err != nil {
+				return nil, &OpError{Index: i, Op: op, Err: fmt.Errorf("%w: %s", ErrInvalidOp, err)}
+			}
+			op.Host = h
+		}
+		ret[i] = op
+	}
+	return ret, nil
+}
+
+// validateOps checks that the operations are well-formed and can be applied
+// in sequence to the current route table.  The caller should take care of
+// locking the mutex.
+func (g *Gateway) validateOps(ops []Op) error {
+	exists := make(map[string]bool, len(ops)) // simulated state of the route table
+	present := func(name string) bool {
+		if v, ok := exists[name]; ok {
+			return v
+		}
+		_, ok := g.pws[name]
+		return ok
+	}
+	for i, op := range ops {
+		if err := op.Validate(); err != nil {
+			return &OpError{Index: i, Op: op, Err: err}
+		}
+		switch op.Action {
+		case ActionAdd:
+			if present(op.Host.Name) {
+				return &OpError{Index: i, Op: op, Err: ErrAlreadyExists}
+			}
+			exists[op.Host.Name] = true
+		case ActionReplace:
+			exists[op.Host.Name] = true
+		case ActionRemove:
+			if !present(op.Host.Name) {
+				return &OpError{Index: i, Op: op, Err: ErrNotFound}
+			}
+			exists[op.Host.Name] = false
+		}
+	}
+	return nil
+}
+
+// apply applies a single operation and returns the function that reverts
+// it.  The caller should take care of locking the mutex.
+func (g *Gateway) apply(op Op) (func() error, error) {
+	name := op.Host.Name
+	prev, existed := g.pws[name]
+	switch op.Action {
+	case ActionAdd:
+		if err := g.add(op.Host); err != nil {
+			return nil, err
+		}
+		return func() error { return g.remove(name) }, nil
+	case ActionReplace:
+		if err := g.replace(op.Host); err != nil {
+			return nil, err
+		}
+		if !existed {
+			return func() error { return g.remove(name) }, nil
+		}
+		return func() error { return g.replace(prev.vhost) }, nil
+	case ActionRemove:
+		if err := g.remove(name); err != nil {
+			return nil, err
+		}
+		return func() error { return g.add(prev.vhost) }, nil
+	}
+	return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidOp, op.Action)
+}
+
+// rollback runs the inverse operations in reverse order.  The caller should
+// take care of locking the mutex.
+func (g *Gateway) rollback(undo []func() error) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		if err := undo[i](); err != nil {
+			log.Printf("rollback error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package vhoster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testGateway(t *testing.T, hosts ...Host) *Gateway {
+	t.Helper()
+	g, err := Listen("127.0.0.1:0", WithHosts(hosts))
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestGateway_Apply(t *testing.T) {
+	t.Run("applies all operations", func(t *testing.T) {
+		g := testGateway(t, testHost("a.example.com", "http://a:80"), testHost("b.example.com", "http://b:80"))
+		err := g.Apply(
+			Op{Action: ActionRemove, Host: Host{Name: "a.example.com"}},
+			Op{Action: ActionAdd, Host: testHost("c.example.com", "http://a:80")},
+			Op{Action: ActionReplace, Host: testHost("b.example.com", "http://bb:80")},
+		)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []Host{
+			testHost("b.example.com", "http://bb:80"),
+			testHost("c.example.com", "http://a:80"),
+		}, g.List())
+	})
+	t.Run("validation failure leaves the table intact", func(t *testing.T) {
+		g := testGateway(t, testHost("a.example.com", "http://a:80"))
+		err := g.Apply(
+			Op{Action: ActionAdd, Host: testHost("b.example.com", "http://b:80")},
+			Op{Action: ActionAdd, Host: testHost("b.example.com", "http://b:80")},
+		)
+		var opErr *OpError
+		require.ErrorAs(t, err, &opErr)
+		assert.Equal(t, 1, opErr.Index)
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		assert.Equal(t, []Host{testHost("a.example.com", "http://a:80")}, g.List())
+	})
+	t.Run("remove of the missing host", func(t *testing.T) {
+		g := testGateway(t)
+		err := g.Apply(
+			Op{Action: ActionAdd, Host: testHost("a.example.com", "http://a:80")},
+			Op{Action: ActionRemove, Host: Host{Name: "a.example.com"}},
+			Op{Action: ActionRemove, Host: Host{Name: "a.example.com"}},
+		)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Empty(t, g.List())
+	})
+	t.Run("invalid operation", func(t *testing.T) {
+		g := testGateway(t)
+		err := g.Apply(Op{Action: "upsert", Host: testHost("a.example.com", "http://a:80")})
+		assert.ErrorIs(t, err, ErrInvalidOp)
+		err = g.Apply(Op{Action: ActionAdd, Host: Host{Name: "a.example.com"}})
+		assert.ErrorIs(t, err, ErrInvalidOp)
+	})
+	t.Run("failure rolls back applied operations", func(t *testing.T) {
+		g := testGateway(t, testHost("a.example.com", "http://a:80"), testHost("b.example.com", "http://b:80"))
+		// bind the name in the muxer behind the gateway's back, so that the
+		// operation passes the validation, but fails when applied.
+		l, err := g.vhm.Listen("c.example.com")
+		require.NoError(t, err)
+		defer l.Close()
+
+		err = g.Apply(
+			Op{Action: ActionRemove, Host: Host{Name: "a.example.com"}},
+			Op{Action: ActionReplace, Host: testHost("b.example.com", "http://bb:80")},
+			Op{Action: ActionAdd, Host: testHost("c.example.com", "http://c:80")},
+		)
+		var opErr *OpError
+		require.True(t, errors.As(err, &opErr))
+		assert.Equal(t, 2, opErr.Index)
+		assert.ElementsMatch(t, []Host{
+			testHost("a.example.com", "http://a:80"),
+			testHost("b.example.com", "http://b:80"),
+		}, g.List())
+	})
+}
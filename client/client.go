@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/rusq/vhoster"
 	"github.com/rusq/vhoster/apiserver"
@@ -17,6 +19,9 @@ var ErrNotFound = fmt.Errorf("not found")
 var (
 	epVhosts = &url.URL{Path: "/vhost/"}
 	epRandom = &url.URL{Path: "/random/"}
+	epBatch  = &url.URL{Path: "/batch/"}
+	epHist   = &url.URL{Path: "/history/"}
+	epFallbk = &url.URL{Path: "/fallback/"}
 )
 
 func rVhostPath(name string) *url.URL {
@@ -24,8 +29,9 @@ func rVhostPath(name string) *url.URL {
 }
 
 type Client struct {
-	base *url.URL
-	cl   *http.Client
+	base  *url.URL
+	cl    *http.Client
+	actor string
 }
 
 type Option func(*Client)
@@ -36,6 +42,14 @@ func WithHTTPClient(cl *http.Client) Option {
 	}
 }
 
+// WithActor sets the identity of the caller, that the server records in the
+// history of changes as unverified.
+func WithActor(name string) Option {
+	return func(c *Client) {
+		c.actor = name
+	}
+}
+
 func New(baseURL string, opts ...Option) (*Client, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
@@ -46,50 +60,135 @@ func New(baseURL string, opts ...Option) (*Client, error) {
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.actor != "" {
+		cl := *c.cl
+		cl.Transport = &actorTransport{actor: c.actor, next: cl.Transport}
+		c.cl = &cl
+	}
 	return c, nil
 }
 
-func (c *Client) Add(hostPrefix, target string) (string, error) {
-	reqBody, err := json.Marshal(apiserver.AddRequest{
+// actorTransport sets the actor header on all requests.
+type actorTransport struct {
+	actor string
+	next  http.RoundTripper
+}
+
+func (t *actorTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(apiserver.ActorHeader, t.actor)
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(r)
+}
+
+// Add adds the host with the optional aliases, given either as prefixes or
+// full names, and returns the full host name.
+func (c *Client) Add(hostPrefix, target string, aliases ...string) (string, error) {
+	return c.add(apiserver.AddRequest{
+		HostPrefix: hostPrefix,
+		Target:     target,
+		Aliases:    aliases,
+	})
+}
+
+// AddWithTTL adds the host, that is removed by the gateway after ttl, unless
+// extended with Extend.  It returns the full host name.
+func (c *Client) AddWithTTL(hostPrefix, target string, ttl time.Duration, aliases ...string) (string, error) {
+	return c.add(apiserver.AddRequest{
 		HostPrefix: hostPrefix,
 		Target:     target,
+		Aliases:    aliases,
+		TTL:        apiserver.Duration(ttl),
 	})
+}
+
+func (c *Client) add(ar apiserver.AddRequest) (string, error) {
+	addResp, err := c.AddHost(ar)
 	if err != nil {
 		return "", err
 	}
+	return addResp.Hostname, nil
+}
+
+// AddHost adds the host described by the request, i.e. with labels and
+// annotations, and returns the response.
+func (c *Client) AddHost(ar apiserver.AddRequest) (*apiserver.AddResponse, error) {
+	reqBody, err := json.Marshal(ar)
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequest(http.MethodPost, c.base.ResolveReference(epVhosts).String(), bytes.NewReader(reqBody))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	var addResp apiserver.AddResponse
 	if err := do(&addResp, c.cl, req); err != nil {
-		return "", err
+		return nil, err
 	}
-	return addResp.Hostname, nil
+	return &addResp, nil
 }
 
 // Random calls the /random endpoint of the server and returns a random
 // hostname.
 func (c *Client) Random(target string) (string, error) {
-	if target == "" {
-		return "", errors.New("empty target")
-	}
-	reqBody, err := json.Marshal(apiserver.RandomRequest{
-		Target: target,
-	})
+	return c.RandomWithTTL(target, 0)
+}
+
+// RandomWithTTL adds the host with a random name, that is removed by the
+// gateway after ttl, and returns the hostname.  Zero ttl means the host
+// never expires.
+func (c *Client) RandomWithTTL(target string, ttl time.Duration) (string, error) {
+	resp, err := c.RandomHost(apiserver.RandomRequest{Target: target, TTL: apiserver.Duration(ttl)})
 	if err != nil {
 		return "", err
 	}
+	return resp.Hostname, nil
+}
+
+// RandomHost adds the host with a random name, generated by the generator
+// given in the request, and returns the response, that includes the name of
+// the generator used.
+func (c *Client) RandomHost(rr apiserver.RandomRequest) (*apiserver.RandomResponse, error) {
+	if rr.Target == "" {
+		return nil, errors.New("empty target")
+	}
+	reqBody, err := json.Marshal(rr)
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequest(http.MethodPost, c.base.ResolveReference(epRandom).String(), bytes.NewReader(reqBody))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	var randomResp apiserver.RandomResponse
 	if err := do(&randomResp, c.cl, req); err != nil {
-		return "", err
+		return nil, err
 	}
-	return randomResp.Hostname, nil
+	return &randomResp, nil
+}
+
+// Extend sets the expiry time of the host to ttl from now, and returns the
+// new expiry time.
+func (c *Client) Extend(hostname string, ttl time.Duration) (time.Time, error) {
+	reqBody, err := json.Marshal(apiserver.ExtendRequest{TTL: apiserver.Duration(ttl)})
+	if err != nil {
+		return time.Time{}, err
+	}
+	ep := &url.URL{Path: "/extend/" + hostname}
+	req, err := http.NewRequest(http.MethodPost, c.base.ResolveReference(ep).String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var extResp apiserver.ExtendResponse
+	if err := do(&extResp, c.cl, req); err != nil {
+		return time.Time{}, err
+	}
+	return extResp.Expires, nil
 }
 
 func (c *Client) Remove(hostname string) error {
@@ -109,16 +208,41 @@ func (c *Client) Remove(hostname string) error {
 	return nil
 }
 
+// List returns all hosts, sorted by name.  The hosts are fetched page by
+// page, use Hosts to iterate over them without loading them all.
 func (c *Client) List() ([]vhoster.Host, error) {
-	req, err := http.NewRequest(http.MethodGet, c.base.ResolveReference(epVhosts).String(), nil)
+	return c.Hosts(ListOptions{}).collect()
+}
+
+// ListSelector returns the hosts, that match the label selector, i.e.
+// "env=preview,team=web".  Empty selector matches all hosts.
+func (c *Client) ListSelector(selector string) ([]vhoster.Host, error) {
+	return c.Hosts(ListOptions{Selector: selector}).collect()
+}
+
+// RemoveSelector removes all hosts, that match the label selector, and
+// returns their names.  The selector must not be empty.
+func (c *Client) RemoveSelector(selector string) ([]string, error) {
+	if selector == "" {
+		return nil, errors.New("empty selector")
+	}
+	req, err := http.NewRequest(http.MethodDelete, c.base.ResolveReference(selectorURL(selector)).String(), nil)
 	if err != nil {
 		return nil, err
 	}
-	var listResp apiserver.ListResponse
-	if err := do(&listResp, c.cl, req); err != nil {
+	var rmResp apiserver.RemoveResponse
+	if err := do(&rmResp, c.cl, req); err != nil {
 		return nil, err
 	}
-	return listResp.Hosts, nil
+	return rmResp.Removed, nil
+}
+
+// selectorURL returns the vhost collection URL with the label selector.
+func selectorURL(selector string) *url.URL {
+	if selector == "" {
+		return epVhosts
+	}
+	return &url.URL{Path: epVhosts.Path, RawQuery: url.Values{"selector": {selector}}.Encode()}
 }
 
 func (c *Client) ListHost(prefix string) (*vhoster.Host, error) {
@@ -145,6 +269,9 @@ func do[T any](ret *T, cl *http.Client, r *http.Request) error {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: unexpected status code: %d", ErrNotFound, resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
@@ -154,22 +281,138 @@ func do[T any](ret *T, cl *http.Client, r *http.Request) error {
 	return nil
 }
 
-func (c *Client) Replace(hostPrefix, target string) (string, error) {
-	reqBody, err := json.Marshal(apiserver.ReplaceRequest{
+// Replace replaces the target of the host.  If aliases are given, they
+// replace the aliases of the host, otherwise the existing aliases are kept.
+func (c *Client) Replace(hostPrefix, target string, aliases ...string) (string, error) {
+	updResp, err := c.ReplaceHost(apiserver.ReplaceRequest{
 		HostPrefix: hostPrefix,
 		Target:     target,
+		Aliases:    aliases,
 	})
 	if err != nil {
 		return "", err
 	}
+	return updResp.Hostname, nil
+}
+
+// ReplaceHost replaces the host described by the request.  The aliases,
+// labels and annotations, that are omitted from the request, are kept.
+func (c *Client) ReplaceHost(rr apiserver.ReplaceRequest) (*apiserver.ReplaceResponse, error) {
+	reqBody, err := json.Marshal(rr)
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequest(http.MethodPatch, c.base.ResolveReference(epVhosts).String(), bytes.NewReader(reqBody))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	var updResp apiserver.ReplaceResponse
 	if err := do(&updResp, c.cl, req); err != nil {
+		return nil, err
+	}
+	return &updResp, nil
+}
+
+// Sync replaces the whole route table of the gateway with the desired set of
+// hosts.  Host names may be prefixes or full host names.  If dryRun is true,
+// the changes are only planned and returned, but not applied.
+func (c *Client) Sync(hosts []apiserver.HostSpec, dryRun bool) (*vhoster.Changes, error) {
+	reqBody, err := json.Marshal(apiserver.SyncRequest{Hosts: hosts})
+	if err != nil {
+		return nil, err
+	}
+	ep := *epVhosts
+	if dryRun {
+		ep.RawQuery = url.Values{"dry_run": []string{"true"}}.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPut, c.base.ResolveReference(&ep).String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var syncResp apiserver.SyncResponse
+	if err := do(&syncResp, c.cl, req); err != nil {
+		return nil, err
+	}
+	return &syncResp.Changes, nil
+}
+
+// Batch applies the operations to the route table of the gateway, all or
+// nothing.
+func (c *Client) Batch(ops ...apiserver.BatchOp) error {
+	reqBody, err := json.Marshal(apiserver.BatchRequest{Ops: ops})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.base.ResolveReference(epBatch).String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var batchResp apiserver.BatchResponse
+	return do(&batchResp, c.cl, req)
+}
+
+// History returns the recorded revisions of the route table, the oldest
+// first.
+func (c *Client) History() ([]vhoster.Revision, error) {
+	req, err := http.NewRequest(http.MethodGet, c.base.ResolveReference(epHist).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var histResp apiserver.HistoryResponse
+	if err := do(&histResp, c.cl, req); err != nil {
+		return nil, err
+	}
+	return histResp.Revisions, nil
+}
+
+// Rollback restores the route table to the given revision, and returns the
+// revisions that reverted the later changes.
+func (c *Client) Rollback(revision int64) ([]vhoster.Revision, error) {
+	ep := &url.URL{Path: "/rollback/" + strconv.FormatInt(revision, 10)}
+	req, err := http.NewRequest(http.MethodPost, c.base.ResolveReference(ep).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var histResp apiserver.HistoryResponse
+	if err := do(&histResp, c.cl, req); err != nil {
+		return nil, err
+	}
+	return histResp.Revisions, nil
+}
+
+// Fallback returns the fallback target, that receives the requests for the
+// unknown hosts, or an empty string, if it's not set.
+func (c *Client) Fallback() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.base.ResolveReference(epFallbk).String(), nil)
+	if err != nil {
 		return "", err
 	}
-	return updResp.Hostname, nil
+	var fbResp apiserver.FallbackResponse
+	if err := do(&fbResp, c.cl, req); err != nil {
+		return "", err
+	}
+	return fbResp.Target, nil
+}
+
+// SetFallback sets the fallback target.  If target is empty, the fallback is
+// removed.
+func (c *Client) SetFallback(target string) error {
+	method, body := http.MethodDelete, []byte(nil)
+	if target != "" {
+		reqBody, err := json.Marshal(apiserver.FallbackRequest{Target: target})
+		if err != nil {
+			return err
+		}
+		method, body = http.MethodPut, reqBody
+	}
+	req, err := http.NewRequest(method, c.base.ResolveReference(epFallbk).String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var fbResp apiserver.FallbackResponse
+	return do(&fbResp, c.cl, req)
 }
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/rusq/vhoster"
 	"github.com/rusq/vhoster/apiserver"
@@ -29,6 +30,9 @@ func TestClient_Add(t *testing.T) {
 		if req.Target != "http://localhost:8080" {
 			t.Errorf("unexpected target: %s", req.Target)
 		}
+		if len(req.Aliases) != 1 || req.Aliases[0] != "www" {
+			t.Errorf("unexpected aliases: %v", req.Aliases)
+		}
 		resp := apiserver.AddResponse{Hostname: "test.endless.lol"}
 		if err := json.NewEncoder(w).Encode(resp); err != nil {
 			t.Errorf("failed to encode response: %v", err)
@@ -43,7 +47,7 @@ func TestClient_Add(t *testing.T) {
 	}
 
 	// Call the Add method with test data
-	hostname, err := client.Add("test", "http://localhost:8080")
+	hostname, err := client.Add("test", "http://localhost:8080", "www")
 	if err != nil {
 		t.Fatalf("Add failed: %v", err)
 	}
@@ -127,3 +131,390 @@ func TestClient_List(t *testing.T) {
 		t.Errorf("unexpected target: %s", hosts[1].URI)
 	}
 }
+
+func TestClient_Sync(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if r.URL.Path != "/vhost/" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("dry_run") != "true" {
+			t.Errorf("unexpected dry_run: %q", r.URL.Query().Get("dry_run"))
+		}
+		var req apiserver.SyncRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		if len(req.Hosts) != 1 || req.Hosts[0].Name != "test" {
+			t.Errorf("unexpected hosts: %v", req.Hosts)
+		}
+		resp := apiserver.SyncResponse{
+			DryRun:  true,
+			Changes: vhoster.Changes{Add: []vhoster.Host{{Name: "test.endless.lol", URI: vhoster.Must(vhoster.Parse(req.Hosts[0].Target))}}},
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	changes, err := client.Sync([]apiserver.HostSpec{
+		{Name: "test", Target: "http://localhost:8080"},
+	}, true)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(changes.Add) != 1 || changes.Add[0].Name != "test.endless.lol" {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+}
+
+func TestClient_Batch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if r.URL.Path != "/batch/" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var req apiserver.BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		if len(req.Ops) != 2 || req.Ops[0].Action != vhoster.ActionRemove || req.Ops[1].Action != vhoster.ActionAdd {
+			t.Errorf("unexpected ops: %v", req.Ops)
+		}
+		if err := json.NewEncoder(w).Encode(apiserver.BatchResponse{Applied: len(req.Ops)}); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	err = client.Batch(
+		apiserver.BatchOp{Action: vhoster.ActionRemove, Host: apiserver.HostSpec{Name: "old"}},
+		apiserver.BatchOp{Action: vhoster.ActionAdd, Host: apiserver.HostSpec{Name: "new", Target: "http://localhost:8080"}},
+	)
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+}
+
+func TestClient_Rollback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if r.URL.Path != "/rollback/42" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if a := r.Header.Get(apiserver.ActorHeader); a != "ci" {
+			t.Errorf("unexpected actor: %q", a)
+		}
+		resp := apiserver.HistoryResponse{Revisions: []vhoster.Revision{{ID: 44, Actor: "ci", Action: vhoster.ActionRemove}}}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL, WithActor("ci"))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	revs, err := client.Rollback(42)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if len(revs) != 1 || revs[0].ID != 44 {
+		t.Errorf("unexpected revisions: %v", revs)
+	}
+}
+
+func TestClient_History(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if r.URL.Path != "/history/" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		resp := apiserver.HistoryResponse{Revisions: []vhoster.Revision{{ID: 1}, {ID: 2}}}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	revs, err := client.History()
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(revs) != 2 || revs[1].ID != 2 {
+		t.Errorf("unexpected revisions: %v", revs)
+	}
+}
+
+func TestClient_SetFallback(t *testing.T) {
+	var target string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fallback/" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodPut:
+			var req apiserver.FallbackRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %v", err)
+			}
+			target = req.Target
+		case http.MethodDelete:
+			target = ""
+		case http.MethodGet:
+		default:
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		json.NewEncoder(w).Encode(apiserver.FallbackResponse{Target: target})
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if err := client.SetFallback("http://localhost:8090"); err != nil {
+		t.Fatalf("SetFallback failed: %v", err)
+	}
+	got, err := client.Fallback()
+	if err != nil {
+		t.Fatalf("Fallback failed: %v", err)
+	}
+	if got != "http://localhost:8090" {
+		t.Errorf("unexpected fallback: %q", got)
+	}
+	if err := client.SetFallback(""); err != nil {
+		t.Fatalf("SetFallback failed: %v", err)
+	}
+	if got, _ := client.Fallback(); got != "" {
+		t.Errorf("fallback is not removed: %q", got)
+	}
+}
+
+func TestClient_RandomWithTTL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/random/" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var req apiserver.RandomRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		if time.Duration(req.TTL) != 10*time.Minute {
+			t.Errorf("unexpected ttl: %s", time.Duration(req.TTL))
+		}
+		resp := apiserver.RandomResponse{AddResponse: apiserver.AddResponse{Hostname: "abc.endless.lol"}}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	hostname, err := client.RandomWithTTL("http://localhost:8080", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("RandomWithTTL failed: %v", err)
+	}
+	if hostname != "abc.endless.lol" {
+		t.Errorf("unexpected hostname: %s", hostname)
+	}
+}
+
+func TestClient_Extend(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if r.URL.Path != "/extend/test.endless.lol" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var req apiserver.ExtendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		if time.Duration(req.TTL) != time.Hour {
+			t.Errorf("unexpected ttl: %s", time.Duration(req.TTL))
+		}
+		resp := apiserver.ExtendResponse{Hostname: "test.endless.lol", Expires: expires}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	got, err := client.Extend("test.endless.lol", time.Hour)
+	if err != nil {
+		t.Fatalf("Extend failed: %v", err)
+	}
+	if !got.Equal(expires) {
+		t.Errorf("unexpected expiry: %s", got)
+	}
+}
+
+func TestClient_RandomHost(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req apiserver.RandomRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		if req.Generator != apiserver.GeneratorWords {
+			t.Errorf("unexpected generator: %s", req.Generator)
+		}
+		resp := apiserver.RandomResponse{AddResponse: apiserver.AddResponse{Hostname: "brave-otter-42.endless.lol"}, Generator: req.Generator}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	resp, err := client.RandomHost(apiserver.RandomRequest{Target: "http://localhost:8080", Generator: apiserver.GeneratorWords})
+	if err != nil {
+		t.Fatalf("RandomHost failed: %v", err)
+	}
+	if resp.Hostname != "brave-otter-42.endless.lol" || resp.Generator != apiserver.GeneratorWords {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if _, err := client.RandomHost(apiserver.RandomRequest{}); err == nil {
+		t.Error("expected an error for the empty target")
+	}
+}
+
+func TestClient_ListSelector(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if got := r.URL.Query().Get("selector"); got != "env=preview,team=web" {
+			t.Errorf("unexpected selector: %q", got)
+		}
+		resp := apiserver.ListResponse{
+			Hosts: []vhoster.Host{
+				{Name: "test1.endless.lol", URI: vhoster.Must(vhoster.Parse("http://localhost:8080")), Labels: map[string]string{"env": "preview", "team": "web"}},
+			},
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	hosts, err := client.ListSelector("env=preview,team=web")
+	if err != nil {
+		t.Fatalf("ListSelector failed: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].Labels["team"] != "web" {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestClient_RemoveSelector(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if r.URL.Path != "/vhost/" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("selector"); got != "env=preview" {
+			t.Errorf("unexpected selector: %q", got)
+		}
+		resp := apiserver.RemoveResponse{Removed: []string{"a.endless.lol", "b.endless.lol"}}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	removed, err := client.RemoveSelector("env=preview")
+	if err != nil {
+		t.Fatalf("RemoveSelector failed: %v", err)
+	}
+	if len(removed) != 2 || removed[0] != "a.endless.lol" {
+		t.Errorf("unexpected removed hosts: %v", removed)
+	}
+	if _, err := client.RemoveSelector(""); err == nil {
+		t.Error("expected an error for the empty selector")
+	}
+}
+
+func TestClient_Hosts(t *testing.T) {
+	pages := map[string]apiserver.ListResponse{
+		"":  {Hosts: []vhoster.Host{{Name: "a.endless.lol"}, {Name: "b.endless.lol"}}, NextCursor: "b"},
+		"b": {Hosts: []vhoster.Host{{Name: "c.endless.lol"}}},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("limit") != "2" || q.Get("name") != "endless" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		resp, ok := pages[q.Get("cursor")]
+		if !ok {
+			t.Errorf("unexpected cursor: %q", q.Get("cursor"))
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	var names []string
+	it := client.Hosts(ListOptions{Name: "endless", PageSize: 2})
+	for it.Next() {
+		names = append(names, it.Host().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Hosts failed: %v", err)
+	}
+	if len(names) != 3 || names[0] != "a.endless.lol" || names[2] != "c.endless.lol" {
+		t.Errorf("unexpected hosts: %v", names)
+	}
+	if it.Next() {
+		t.Error("Next returned true after the last host")
+	}
+}
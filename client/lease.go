@@ -0,0 +1,150 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rusq/vhoster/apiserver"
+)
+
+// ErrLeaseLost is returned by Lease.Err, when the lease has expired or was
+// revoked by someone else, and the host is gone.
+var ErrLeaseLost = errors.New("lease lost")
+
+// Lease is the lease of the host, that is kept alive in the background until
+// Close is called.
+type Lease struct {
+	// ID is the ID of the lease.
+	ID string
+	// Hostname is the full name of the host, that holds the lease.
+	Hostname string
+
+	c        *Client
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// AddWithLease adds the host with the lease, and starts renewing the lease in
+// the background, three times per interval.  If the process dies, the host is
+// removed by the gateway after the interval.  Call Close on the returned
+// Lease to remove the host.
+func (c *Client) AddWithLease(hostPrefix, target string, interval time.Duration, aliases ...string) (*Lease, error) {
+	addResp, err := c.AddHost(apiserver.AddRequest{
+		HostPrefix: hostPrefix,
+		Target:     target,
+		Aliases:    aliases,
+		Lease:      apiserver.Duration(interval),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if addResp.LeaseID == "" {
+		return nil, errors.New("server did not return the lease ID")
+	}
+	l := &Lease{
+		ID:       addResp.LeaseID,
+		Hostname: addResp.Hostname,
+		c:        c,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go l.keepAlive()
+	return l, nil
+}
+
+// keepAlive renews the lease until it is stopped or lost.  Failed renewals
+// are retried on the next tick.
+func (l *Lease) keepAlive() {
+	defer close(l.done)
+	t := time.NewTicker(l.interval / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-t.C:
+			_, err := l.c.Renew(l.ID)
+			if errors.Is(err, ErrNotFound) {
+				l.setErr(ErrLeaseLost)
+				return
+			}
+			l.setErr(err)
+		}
+	}
+}
+
+func (l *Lease) setErr(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+}
+
+// Err returns the error of the last renewal, or ErrLeaseLost if the lease is
+// lost.
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Done returns the channel, that is closed when the lease is no longer
+// renewed, either because it's lost, or after Close.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Close stops renewing the lease and revokes it, removing the host.  Closing
+// the lost lease is not an error.
+func (l *Lease) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+		if errors.Is(l.Err(), ErrLeaseLost) {
+			return
+		}
+		if err = l.c.Revoke(l.ID); errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+	})
+	return err
+}
+
+// Renew renews the lease, and returns the new expiry time of the host.
+func (c *Client) Renew(leaseID string) (time.Time, error) {
+	req, err := http.NewRequest(http.MethodPost, c.base.ResolveReference(rLeasePath(leaseID)).String(), nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var leaseResp apiserver.LeaseResponse
+	if err := do(&leaseResp, c.cl, req); err != nil {
+		return time.Time{}, err
+	}
+	if leaseResp.Expires == nil {
+		return time.Time{}, nil
+	}
+	return *leaseResp.Expires, nil
+}
+
+// Revoke revokes the lease, removing the host, that holds it.
+func (c *Client) Revoke(leaseID string) error {
+	req, err := http.NewRequest(http.MethodDelete, c.base.ResolveReference(rLeasePath(leaseID)).String(), nil)
+	if err != nil {
+		return err
+	}
+	var leaseResp apiserver.LeaseResponse
+	return do(&leaseResp, c.cl, req)
+}
+
+func rLeasePath(id string) *url.URL {
+	return &url.URL{Path: "/lease/" + id}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rusq/vhoster/apiserver"
+)
+
+// leaseServer is the fake API server, that issues the lease "abc" and
+// counts renewals.  If lost is set, renewals fail with 404.
+type leaseServer struct {
+	renewals atomic.Int32
+	revoked  atomic.Bool
+	lost     atomic.Bool
+}
+
+func (s *leaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/vhost/":
+		json.NewEncoder(w).Encode(apiserver.AddResponse{Hostname: "worker.endless.lol", LeaseID: "abc"})
+	case r.Method == http.MethodPost && r.URL.Path == "/lease/abc":
+		if s.lost.Load() {
+			http.NotFound(w, r)
+			return
+		}
+		s.renewals.Add(1)
+		json.NewEncoder(w).Encode(apiserver.LeaseResponse{LeaseID: "abc", Hostname: "worker.endless.lol"})
+	case r.Method == http.MethodDelete && r.URL.Path == "/lease/abc":
+		s.revoked.Store(true)
+		json.NewEncoder(w).Encode(apiserver.LeaseResponse{LeaseID: "abc", Hostname: "worker.endless.lol"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestClient_AddWithLease(t *testing.T) {
+	t.Run("keeps alive and revokes on close", func(t *testing.T) {
+		srv := new(leaseServer)
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+		client, err := New(ts.URL)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		l, err := client.AddWithLease("worker", "http://localhost:8080", 30*time.Millisecond)
+		if err != nil {
+			t.Fatalf("AddWithLease failed: %v", err)
+		}
+		if l.ID != "abc" || l.Hostname != "worker.endless.lol" {
+			t.Errorf("unexpected lease: %s %s", l.ID, l.Hostname)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if n := srv.renewals.Load(); n < 2 {
+			t.Errorf("expected at least 2 renewals, got %d", n)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if !srv.revoked.Load() {
+			t.Error("lease was not revoked")
+		}
+		select {
+		case <-l.Done():
+		default:
+			t.Error("done is not closed")
+		}
+		if err := l.Close(); err != nil {
+			t.Errorf("second Close failed: %v", err)
+		}
+	})
+	t.Run("lost lease", func(t *testing.T) {
+		srv := new(leaseServer)
+		srv.lost.Store(true)
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+		client, err := New(ts.URL)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		l, err := client.AddWithLease("worker", "http://localhost:8080", 30*time.Millisecond)
+		if err != nil {
+			t.Fatalf("AddWithLease failed: %v", err)
+		}
+		select {
+		case <-l.Done():
+		case <-time.After(time.Second):
+			t.Fatal("lost lease is still renewed")
+		}
+		if !errors.Is(l.Err(), ErrLeaseLost) {
+			t.Errorf("unexpected error: %v", l.Err())
+		}
+		if err := l.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+		if srv.revoked.Load() {
+			t.Error("lost lease must not be revoked")
+		}
+	})
+}
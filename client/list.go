@@ -0,0 +1,128 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/apiserver"
+)
+
+// defaultPageSize is the page size used by the iterator, if not set.
+const defaultPageSize = 500
+
+// ListOptions are the filters and the page size of the list request.
+type ListOptions struct {
+	// Selector is the label selector, i.e. "env=preview,team=web".
+	Selector string
+	// Name selects the hosts, whose name or one of the aliases contains it.
+	Name string
+	// Target selects the hosts, whose target contains it.
+	Target string
+	// PageSize is the number of hosts requested at once, zero means the
+	// default, or all hosts for ListPage.
+	PageSize int
+}
+
+// values returns the query parameters for the options.
+func (o ListOptions) values() url.Values {
+	v := url.Values{}
+	for k, s := range map[string]string{"selector": o.Selector, "name": o.Name, "target": o.Target} {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+	if o.PageSize > 0 {
+		v.Set("limit", strconv.Itoa(o.PageSize))
+	}
+	return v
+}
+
+// ListPage returns one page of the hosts, that match the options, starting
+// at the cursor.  Empty cursor means the first page.  The NextCursor of the
+// response is empty on the last page.
+func (c *Client) ListPage(opts ListOptions, cursor string) (*apiserver.ListResponse, error) {
+	v := opts.values()
+	if cursor != "" {
+		v.Set("cursor", cursor)
+	}
+	ep := &url.URL{Path: epVhosts.Path, RawQuery: v.Encode()}
+	req, err := http.NewRequest(http.MethodGet, c.base.ResolveReference(ep).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var listResp apiserver.ListResponse
+	if err := do(&listResp, c.cl, req); err != nil {
+		return nil, err
+	}
+	return &listResp, nil
+}
+
+// HostIterator iterates over the hosts, fetching them page by page.  Use it
+// as:
+//
+//	it := c.Hosts(client.ListOptions{Selector: "env=preview"})
+//	for it.Next() {
+//		h := it.Host()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type HostIterator struct {
+	c      *Client
+	opts   ListOptions
+	cursor string
+	page   []vhoster.Host
+	host   vhoster.Host
+	last   bool // the last page was fetched
+	err    error
+}
+
+// Hosts returns the iterator over the hosts, that match the options, sorted
+// by name.
+func (c *Client) Hosts(opts ListOptions) *HostIterator {
+	if opts.PageSize <= 0 {
+		opts.PageSize = defaultPageSize
+	}
+	return &HostIterator{c: c, opts: opts}
+}
+
+// Next advances the iterator to the next host, fetching the next page if
+// needed.  It returns false, when there are no more hosts or on error.
+func (it *HostIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.last || it.err != nil {
+			return false
+		}
+		resp, err := it.c.ListPage(it.opts, it.cursor)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.cursor = resp.Hosts, resp.NextCursor
+		it.last = resp.NextCursor == ""
+	}
+	it.host, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Host returns the current host.
+func (it *HostIterator) Host() vhoster.Host {
+	return it.host
+}
+
+// Err returns the error, that stopped the iteration, if any.
+func (it *HostIterator) Err() error {
+	return it.err
+}
+
+// collect returns all hosts of the iterator.
+func (it *HostIterator) collect() ([]vhoster.Host, error) {
+	var hosts []vhoster.Host
+	for it.Next() {
+		hosts = append(hosts, it.Host())
+	}
+	return hosts, it.Err()
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rusq/vhoster"
+)
+
+var epWatch = &url.URL{Path: "/watch/"}
+
+// maxRetryDelay is the maximum delay between the reconnection attempts of
+// the watcher.
+const maxRetryDelay = 30 * time.Second
+
+// retryDelay is the initial delay between the reconnection attempts.
+var retryDelay = time.Second
+
+// Watch streams the changes of the route table made from now on.  See
+// WatchFrom.
+func (c *Client) Watch(ctx context.Context) (<-chan vhoster.Revision, error) {
+	return c.WatchFrom(ctx, -1)
+}
+
+// WatchFrom streams the changes of the route table made after the revision
+// since, negative since means from now on.  If the connection is lost, it
+// reconnects and resumes from the last received revision.
+//
+// The channel is closed, when the context is done, or when the stream can't
+// be resumed, because the missed revisions are no longer in the history.
+// In the latter case, List the hosts and Watch again.  The error is returned
+// if the first connection fails.
+func (c *Client) WatchFrom(ctx context.Context, since int64) (<-chan vhoster.Revision, error) {
+	// the stream is long-lived, the client timeout would cut it.
+	cl := *c.cl
+	cl.Timeout = 0
+	w := &watcher{c: c, cl: &cl, last: since}
+	body, err := w.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan vhoster.Revision)
+	go w.run(ctx, body, ch)
+	return ch, nil
+}
+
+// watcher reads the event stream and reconnects, when it ends.
+type watcher struct {
+	c    *Client
+	cl   *http.Client
+	last int64 // last received revision
+}
+
+// connect opens the event stream from the last revision.
+func (w *watcher) connect(ctx context.Context) (io.ReadCloser, error) {
+	ep := *epWatch
+	if w.last >= 0 {
+		ep.RawQuery = url.Values{"revision": {strconv.FormatInt(w.last, 10)}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.c.base.ResolveReference(&ep).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := w.cl.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusGone:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d", vhoster.ErrRevisionNotFound, w.last)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// run reads the events from the stream and sends them to ch, reconnecting
+// until the context is done.  It closes ch on exit.
+func (w *watcher) run(ctx context.Context, body io.ReadCloser, ch chan<- vhoster.Revision) {
+	defer close(ch)
+	delay := retryDelay
+	for {
+		err := w.read(ctx, body, ch)
+		body.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("watch: %s", err)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			body, err = w.connect(ctx)
+			if err == nil {
+				delay = retryDelay
+				break
+			}
+			if ctx.Err() != nil || errors.Is(err, vhoster.ErrRevisionNotFound) {
+				log.Printf("watch: %s", err)
+				return
+			}
+			log.Printf("watch: reconnecting: %s", err)
+			if delay *= 2; delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+		}
+	}
+}
+
+// read reads the Server-Sent Events from the stream, until it ends.
+func (w *watcher) read(ctx context.Context, body io.Reader, ch chan<- vhoster.Revision) error {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var (
+		id   string
+		data strings.Builder
+	)
+	for sc.Scan() {
+		line := sc.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "id":
+				id = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+			continue
+		}
+		// the blank line dispatches the event.
+		if id != "" {
+			n, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid event id %q", id)
+			}
+			w.last = n
+		}
+		if data.Len() > 0 {
+			var rev vhoster.Revision
+			if err := json.Unmarshal([]byte(data.String()), &rev); err != nil {
+				return fmt.Errorf("invalid event data: %w", err)
+			}
+			select {
+			case ch <- rev:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		id = ""
+		data.Reset()
+	}
+	return sc.Err()
+}
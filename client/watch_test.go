@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rusq/vhoster"
+)
+
+func TestClient_Watch(t *testing.T) {
+	retryDelay = 10 * time.Millisecond
+	var conns int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/watch/" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		conns++
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch conns {
+		case 1:
+			if r.URL.Query().Has("revision") {
+				t.Errorf("unexpected revision on the first connection: %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, ": watching from revision 5\nid: 5\n\n")
+			fmt.Fprint(w, "id: 6\nevent: add\ndata: {\"revision\":6,\"action\":\"add\",\"host\":{\"name\":\"a.endless.lol\",\"uri\":\"http://localhost:8080\"}}\n\n")
+			fmt.Fprint(w, ": ping\n\n")
+			fmt.Fprint(w, "id: 7\nevent: remove\ndata: {\"revision\":7,\"action\":\"remove\",\"host\":{\"name\":\"b.endless.lol\"}}\n\n")
+			// the stream ends, the client must resume from 7.
+		case 2:
+			if got := r.URL.Query().Get("revision"); got != "7" {
+				t.Errorf("unexpected revision on reconnect: %q", got)
+			}
+			fmt.Fprint(w, "id: 7\n\nid: 8\nevent: expire\ndata: {\"revision\":8,\"action\":\"expire\",\"host\":{\"name\":\"c.endless.lol\"}}\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			t.Errorf("unexpected connection %d", conns)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := client.Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	for _, want := range []vhoster.Revision{
+		{ID: 6, Action: vhoster.ActionAdd, Host: vhoster.Host{Name: "a.endless.lol", URI: vhoster.Must(vhoster.Parse("http://localhost:8080"))}},
+		{ID: 7, Action: vhoster.ActionRemove, Host: vhoster.Host{Name: "b.endless.lol"}},
+		{ID: 8, Action: vhoster.ActionExpire, Host: vhoster.Host{Name: "c.endless.lol"}},
+	} {
+		select {
+		case got := <-ch:
+			if got.ID != want.ID || got.Action != want.Action || got.Host.Name != want.Host.Name {
+				t.Errorf("unexpected revision: got %+v, want %+v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for revision %d", want.ID)
+		}
+	}
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("unexpected revision after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel is not closed after cancel")
+	}
+}
+
+func TestClient_WatchFrom_gone(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "410 revision 1 is not in the history", http.StatusGone)
+	}))
+	defer ts.Close()
+
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if _, err := client.WatchFrom(context.Background(), 1); !errors.Is(err, vhoster.ErrRevisionNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rusq/osenv/v2"
+	"github.com/rusq/vhoster"
+	"gopkg.in/yaml.v3"
+)
+
+// problem is a single issue found in the config file.
+type problem struct {
+	Line  int    // line number in the config file, 0 if unknown
+	Field string // field path, i.e. "hosts[1].uri"
+	Msg   string
+}
+
+func (p problem) String() string {
+	var buf strings.Builder
+	if p.Line > 0 {
+		buf.WriteString(strconv.Itoa(p.Line) + ": ")
+	}
+	if p.Field != "" {
+		buf.WriteString(p.Field + ": ")
+	}
+	buf.WriteString(p.Msg)
+	return buf.String()
+}
+
+// runCheck runs the "check" command, that validates the config file and
+// prints all found problems.  It returns the process exit code.
+func runCheck(args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	path := fs.String("c", osenv.Value("CONFIG", ""), "path to the config `file` to check")
+	dial := fs.Bool("dial", false, "check that the host targets are reachable")
+	dialTimeout := fs.Duration("dial-timeout", 2*time.Second, "connection `timeout` for -dial")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s check -c config [-dial]\n\nValidates the config file and prints all problems.\n\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" {
+		fmt.Fprintln(stdout, "config file is not set")
+		return 2
+	}
+	var dialTo time.Duration
+	if *dial {
+		dialTo = *dialTimeout
+	}
+	problems, err := checkConfig(*path, dialTo)
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return 2
+	}
+	for _, p := range problems {
+		fmt.Fprintf(stdout, "%s:%s\n", *path, p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(stdout, "%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Fprintln(stdout, "config OK")
+	return 0
+}
+
+// checkConfig loads the config file at path and returns all problems found
+// in it.  If dialTimeout is not zero, the reachability of the host targets is
+// checked as well.  The error is returned only if the file can't be read.
+func checkConfig(path string, dialTimeout time.Duration) ([]problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeMap(path, data)
+	if err != nil {
+		return []problem{{Line: errLine(data, err), Msg: "syntax error: " + err.Error()}}, nil
+	}
+	c := checker{lines: positions(path, data)}
+	if _, err := resolve(m, filepath.Dir(path)); err != nil {
+		c.add("", "%s", err)
+		return c.problems, nil
+	}
+	c.unknownKeys(m, reflect.TypeOf(Config{}), "")
+
+	// decoding is not strict here, unknown keys are already reported.  Hosts
+	// are decoded one by one to report the errors in each of them.
+	hosts, ok := m["hosts"].([]any)
+	if v, exists := m["hosts"]; exists && !ok && v != nil {
+		c.add("hosts", "hosts must be a list")
+	}
+	delete(m, "hosts")
+	var cfg Config
+	if err := c.decode(m, &cfg, ""); err != nil {
+		return c.problems, nil
+	}
+	invalid := make(map[int]bool)
+	cfg.Hosts = make([]vhoster.Host, len(hosts))
+	for i, v := range hosts {
+		if err := c.decode(v, &cfg.Hosts[i], fmt.Sprintf("hosts[%d]", i)); err != nil {
+			invalid[i] = true
+		}
+	}
+	c.config(&cfg, invalid, dialTimeout)
+	sort.SliceStable(c.problems, func(i, j int) bool { return c.problems[i].Line < c.problems[j].Line })
+	return c.problems, nil
+}
+
+// checker accumulates the problems.
+type checker struct {
+	lines    map[string]int // field path to line number
+	problems []problem
+}
+
+func (c *checker) add(field string, format string, a ...any) {
+	c.problems = append(c.problems, problem{Line: c.line(field), Field: field, Msg: fmt.Sprintf(format, a...)})
+}
+
+// line returns the line of the field, or of its closest parent, if the field
+// is not found.
+func (c *checker) line(field string) int {
+	for field != "" {
+		if n, ok := c.lines[field]; ok {
+			return n
+		}
+		if n, ok := c.lines[field+fileSuffix]; ok {
+			return n
+		}
+		i := strings.LastIndexAny(field, ".[")
+		if i < 0 {
+			break
+		}
+		field = field[:i]
+	}
+	return 0
+}
+
+// unknownKeys reports the keys of v, that do not match the JSON fields of the
+// type t.
+func (c *checker) unknownKeys(v any, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		fields := make(map[string]reflect.Type, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for _, k := range sortedKeys(v) {
+			ft, ok := fields[k]
+			if !ok {
+				c.add(join(path, k), "unknown field")
+				continue
+			}
+			c.unknownKeys(v[k], ft, join(path, k))
+		}
+	case []any:
+		if t.Kind() != reflect.Slice {
+			return
+		}
+		for i, val := range v {
+			c.unknownKeys(val, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// decode decodes the value v into ptr, the errors are reported as problems in
+// the field path.
+func (c *checker) decode(v any, ptr any, path string) error {
+	js, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(js, ptr)
+	}
+	if err == nil {
+		return nil
+	}
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &ute) {
+		c.add(join(path, lastField(ute.Field)), "invalid value type %s, expected %s", ute.Value, ute.Type)
+		return err
+	}
+	// errors returned by the custom unmarshalers do not have the field name,
+	// locate the failing fields by decoding them one by one.
+	n := len(c.problems)
+	if m, ok := v.(map[string]any); ok {
+		typ := reflect.TypeOf(ptr).Elem()
+		for _, k := range sortedKeys(m) {
+			js, _ := json.Marshal(map[string]any{k: m[k]})
+			if ferr := json.Unmarshal(js, reflect.New(typ).Interface()); ferr != nil {
+				c.add(join(path, k), "%s", ferr)
+			}
+		}
+	}
+	if len(c.problems) == n {
+		c.add(path, "%s", err)
+	}
+	return err
+}
+
+// lastField returns the last element of the dotted field path.
+func lastField(field string) string {
+	if i := strings.LastIndexByte(field, '.'); i >= 0 {
+		return field[i+1:]
+	}
+	return field
+}
+
+// config checks the values of the config, the hosts with the indexes in
+// invalid failed to decode and are skipped.
+func (c *checker) config(cfg *Config, invalid map[int]bool, dialTimeout time.Duration) {
+	// the settings are validated the same way as by the gateway.
+	for _, e := range cfg.settingErrors() {
+		c.add(e.Field, "%s", e.Msg)
+	}
+	c.address("gateway_address", cfg.GatewayAddress)
+	c.address("api_address", cfg.APIAddress)
+	if cfg.TargetPolicy != nil && cfg.TargetPolicy.Validate() == nil && cfg.Fallback != nil {
+		if err := cfg.TargetPolicy.Check(cfg.Fallback.URL()); err != nil {
+			c.add("fallback", "%s", err)
+		}
+	}
+	if cfg.ErrorPages != "" {
+		if _, err := vhoster.LoadErrorPages(cfg.ErrorPages); err != nil {
+			c.add("error_pages", "invalid error pages: %s", err)
+		}
+	}
+
+	// seen maps the full names to the fields, that define them.
+	seen := make(map[string]string, len(cfg.Hosts))
+	for i, h := range cfg.Hosts {
+		if invalid[i] {
+			continue
+		}
+		field := fmt.Sprintf("hosts[%d]", i)
+		if h.Name == "" {
+			c.add(field+".name", "host name is empty")
+		} else if err := checkDomain(h.Name); err != nil {
+			c.add(field+".name", "invalid host name %q: %s", h.Name, err)
+		} else {
+			// the gateway registers the names in the canonical form.
+			full := canonical(h.Name + "." + cfg.DomainName)
+			if first, ok := seen[full]; ok {
+				c.add(field+".name", "duplicate host name %q, first defined in %s on line %d", full, first, c.line(first))
+			} else {
+				seen[full] = field + ".name"
+			}
+		}
+		for k, a := range h.Aliases {
+			afield := fmt.Sprintf("%s.aliases[%d]", field, k)
+			if err := checkDomain(a); err != nil {
+				c.add(afield, "invalid alias %q: %s", a, err)
+				continue
+			}
+			full := canonical(vhoster.AliasInDomain(a, cfg.DomainName))
+			if first, ok := seen[full]; ok {
+				c.add(afield, "duplicate host name %q, first defined in %s on line %d", full, first, c.line(first))
+			} else {
+				seen[full] = afield
+			}
+		}
+		if err := vhoster.ValidateLabels(h.Labels); err != nil {
+			c.add(field+".labels", "%s", err)
+		}
+		if err := vhoster.ValidateAnnotations(h.Annotations); err != nil {
+			c.add(field+".annotations", "%s", err)
+		}
+		if h.URI == nil {
+			c.add(field+".uri", "target URI is empty")
+			continue
+		}
+		u := h.URI.URL()
+		if u.Scheme != "http" && u.Scheme != "https" {
+			c.add(field+".uri", "unsupported target scheme %q, must be http or https", u.Scheme)
+			continue
+		}
+		if u.Hostname() == "" {
+			c.add(field+".uri", "target URI has no host")
+			continue
+		}
+		if cfg.TargetPolicy != nil && cfg.TargetPolicy.Validate() == nil {
+			if err := cfg.TargetPolicy.Check(u); err != nil {
+				c.add(field+".uri", "%s", err)
+				continue
+			}
+		}
+		if dialTimeout > 0 {
+			port := u.Port()
+			if port == "" {
+				port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+			}
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), dialTimeout)
+			if err != nil {
+				c.add(field+".uri", "target is unreachable: %s", err)
+				continue
+			}
+			conn.Close()
+		}
+	}
+
+	// the hosts are validated the same way as by the gateway as well, to
+	// catch what is not covered above, the reported hosts are skipped.
+	for i, h := range cfg.Hosts {
+		field := fmt.Sprintf("hosts[%d]", i)
+		if invalid[i] || c.reported(field) {
+			continue
+		}
+		err := h.Validate()
+		if err == nil && checkDomain(cfg.DomainName) == nil {
+			_, err = h.InDomain(cfg.DomainName)
+		}
+		if err != nil {
+			c.add(field, "%s", err)
+		}
+	}
+}
+
+// reported returns true if a problem is reported for the field or any of its
+// subfields.
+func (c *checker) reported(field string) bool {
+	for _, p := range c.problems {
+		if p.Field == field || strings.HasPrefix(p.Field, field+".") || strings.HasPrefix(p.Field, field+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// address checks the format of the listen address, the empty one is reported
+// by settingErrors.
+func (c *checker) address(field, addr string) {
+	if addr == "" {
+		return
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		c.add(field, "invalid address %q: %s", addr, err)
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		c.add(field, "invalid port %q", port)
+	}
+	if host != "" && net.ParseIP(host) == nil {
+		if err := checkDomain(host); err != nil {
+			c.add(field, "invalid host %q: %s", host, err)
+		}
+	}
+}
+
+// checkDomain checks that name is a valid domain name with an optional port,
+// using the same rules as the gateway.
+func checkDomain(name string) error {
+	_, err := vhoster.NormalizeName(name)
+	var ne *vhoster.NameError
+	if errors.As(err, &ne) {
+		return errors.New(ne.Reason)
+	}
+	return err
+}
+
+// canonical returns the normalised name, or the lowercased one, if it's
+// invalid, i.e. because of the invalid domain name, reported separately.
+func canonical(name string) string {
+	if n, err := vhoster.NormalizeName(name); err == nil {
+		return n
+	}
+	return strings.ToLower(name)
+}
+
+// positions returns the line numbers of the fields in the config file in the
+// format determined by the path extension.  It is best effort: unknown fields
+// are missing from the map.
+func positions(path string, data []byte) map[string]int {
+	pos := make(map[string]int)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc yaml.Node
+		if yaml.Unmarshal(data, &doc) == nil && len(doc.Content) > 0 {
+			yamlPositions(doc.Content[0], "", pos)
+		}
+	case ".toml":
+		tomlPositions(data, pos)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		jsonPositions(dec, data, "", pos)
+	}
+	return pos
+}
+
+func yamlPositions(n *yaml.Node, path string, pos map[string]int) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := join(path, n.Content[i].Value)
+			pos[key] = n.Content[i].Line
+			yamlPositions(n.Content[i+1], key, pos)
+		}
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			key := fmt.Sprintf("%s[%d]", path, i)
+			pos[key] = item.Line
+			yamlPositions(item, key, pos)
+		}
+	}
+}
+
+// jsonPositions reads the next value from dec, and records the lines of the
+// object keys and array elements.
+func jsonPositions(dec *json.Decoder, data []byte, path string, pos map[string]int) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		if _, ok := pos[path]; !ok {
+			pos[path] = lineAt(data, dec.InputOffset())
+		}
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := join(path, fmt.Sprint(tok))
+			pos[key] = lineAt(data, dec.InputOffset())
+			if err := jsonPositions(dec, data, key, pos); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if err := jsonPositions(dec, data, fmt.Sprintf("%s[%d]", path, i), pos); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	}
+	return err
+}
+
+var (
+	reTOMLArray = regexp.MustCompile(`^\s*\[\[\s*([\w.-]+)\s*\]\]`)
+	reTOMLTable = regexp.MustCompile(`^\s*\[\s*([\w.-]+)\s*\]`)
+	reTOMLKey   = regexp.MustCompile(`^\s*"?([\w.-]+?)"?\s*=`)
+)
+
+// tomlPositions records the lines of the keys and tables.  It understands
+// only the tables and arrays of tables, not the inline ones.
+func tomlPositions(data []byte, pos map[string]int) {
+	var (
+		prefix string
+		counts = make(map[string]int)
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if m := reTOMLArray.FindStringSubmatch(line); m != nil {
+			prefix = fmt.Sprintf("%s[%d]", m[1], counts[m[1]])
+			counts[m[1]]++
+			pos[prefix] = n
+		} else if m := reTOMLTable.FindStringSubmatch(line); m != nil {
+			prefix = m[1]
+			pos[prefix] = n
+		} else if m := reTOMLKey.FindStringSubmatch(line); m != nil {
+			pos[join(prefix, m[1])] = n
+		}
+	}
+}
+
+// errLine returns the line of the parse error, or 0 if it's unknown.
+func errLine(data []byte, err error) int {
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		return lineAt(data, se.Offset)
+	}
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &ute) {
+		return lineAt(data, ute.Offset)
+	}
+	// yaml and toml errors include the line number in the message.
+	if m := reErrLine.FindStringSubmatch(err.Error()); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	return 0
+}
+
+var reErrLine = regexp.MustCompile(`line (\d+)`)
+
+// lineAt returns the line number of the offset in data.
+func lineAt(data []byte, off int64) int {
+	if off > int64(len(data)) {
+		off = int64(len(data))
+	}
+	return bytes.Count(data[:off], []byte("\n")) + 1
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// contains returns true if the list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want []problem
+	}{
+		{
+			"valid json",
+			"config.json",
+			testConfigJSON,
+			nil,
+		},
+		{
+			"json",
+			"config.json",
+			`{
+	"gateway_address": "0.0.0.0:99999",
+	"api_address": "0.0.0.0:8083",
+	"domain_name": "example.com",
+	"hosts": [
+		{"name": "a", "uri": "http://localhost:8081"},
+		{"name": "A", "uri": "ftp://localhost:8081"}
+	]
+}`,
+			[]problem{
+				{Line: 2, Field: "gateway_address", Msg: `invalid port "99999"`},
+				{Line: 7, Field: "hosts[1].name", Msg: `duplicate host name "a.example.com", first defined in hosts[0].name on line 6`},
+				{Line: 7, Field: "hosts[1].uri", Msg: `unsupported target scheme "ftp", must be http or https`},
+			},
+		},
+		{
+			"yaml",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+domain_name: ex_ample.com
+bogus: 1
+hosts:
+  - name: a
+    uri: http://localhost:8081
+  - name: b
+    url: http://localhost:8082
+`,
+			[]problem{
+				{Line: 0, Field: "api_address", Msg: "address is empty"},
+				{Line: 2, Field: "domain_name", Msg: `invalid domain name "ex_ample.com": label "ex_ample" must contain only letters, digits and hyphens, and must not start or end with a hyphen`},
+				{Line: 3, Field: "bogus", Msg: "unknown field"},
+				{Line: 7, Field: "hosts[1].uri", Msg: "target URI is empty"},
+				{Line: 8, Field: "hosts[1].url", Msg: "unknown field"},
+			},
+		},
+		{
+			"toml",
+			"config.toml",
+			`gateway_address = "0.0.0.0:8080"
+api_address = "0.0.0.0:8083"
+domain_name = "example.com"
+timeout = true
+
+[[hosts]]
+name = "a"
+uri = "http://localhost:8081"
+
+[[hosts]]
+name = "-b"
+uri = "http:///path"
+`,
+			[]problem{
+				{Line: 4, Field: "timeout", Msg: "invalid duration: true"},
+			},
+		},
+		{
+			"error pages and fallback",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:8083
+domain_name: example.com
+error_pages: /nonexistent/error-pages
+fallback: ftp://localhost
+`,
+			[]problem{
+				{Line: 4, Field: "error_pages", Msg: "invalid error pages: open /nonexistent/error-pages: no such file or directory"},
+				{Line: 5, Field: "fallback", Msg: `unsupported fallback scheme "ftp", must be http or https`},
+			},
+		},
+		{
+			"idle hosts",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:8083
+domain_name: example.com
+idle_timeout: -1h
+idle_action: sleep
+`,
+			[]problem{
+				{Line: 4, Field: "idle_timeout", Msg: "idle timeout must not be negative"},
+				{Line: 5, Field: "idle_action", Msg: `unknown idle action "sleep", must be "mark" or "remove"`},
+			},
+		},
+		{
+			"gateway validation",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:8083
+domain_name: example.com
+drain_delay: -1s
+state_retention: -1
+target_policy:
+  allow_hosts: ["["]
+hosts:
+  - name: a
+    uri: http://localhost:8081
+    aliases: [b, B]
+  - name: c:8080
+    uri: http://localhost:8082
+`,
+			[]problem{
+				{Line: 4, Field: "drain_delay", Msg: "drain delay must not be negative"},
+				{Line: 5, Field: "state_retention", Msg: "state retention must not be negative"},
+				{Line: 6, Field: "target_policy", Msg: `invalid target policy: invalid host pattern "[": syntax error in pattern`},
+				{Line: 11, Field: "hosts[0].aliases[1]", Msg: `duplicate host name "b.example.com", first defined in hosts[0].aliases[0] on line 11`},
+				{Line: 12, Field: "hosts[1]", Msg: `invalid host name "c:8080.example.com": invalid port "8080.example.com"`},
+			},
+		},
+		{
+			"target policy",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:8083
+domain_name: example.com
+target_policy:
+  deny_cidrs: [169.254.0.0/16]
+  ports: [80, "8000-8999"]
+hosts:
+  - name: meta
+    uri: http://169.254.169.254/
+  - name: ssh
+    uri: http://10.0.0.1:22
+  - name: ok
+    uri: http://10.0.0.1:8080
+`,
+			[]problem{
+				{Line: 9, Field: "hosts[0].uri", Msg: "target http://169.254.169.254/ is rejected by the deny_cidrs rule: address 169.254.169.254 is in the denied network 169.254.0.0/16"},
+				{Line: 11, Field: "hosts[1].uri", Msg: "target http://10.0.0.1:22 is rejected by the ports rule: port 22 is not in the allowed ports 80, 8000-8999"},
+			},
+		},
+		{
+			"labels",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:8083
+domain_name: example.com
+hosts:
+  - name: a
+    uri: http://localhost:8082
+    labels:
+      env: pre view
+      team: web
+    annotations:
+      git-sha: 0123abc
+`,
+			[]problem{
+				{Line: 7, Field: "hosts[0].labels", Msg: `label "env": invalid value "pre view", must be at most 63 letters, digits, ".", "_" and "-"`},
+			},
+		},
+		{
+			"invalid target policy",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:8083
+domain_name: example.com
+target_policy:
+  deny_hosts: ["[a-"]
+`,
+			[]problem{
+				{Line: 4, Field: "target_policy", Msg: `invalid target policy: invalid host pattern "[a-": syntax error in pattern`},
+			},
+		},
+		{
+			"random names",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:8083
+domain_name: example.com
+random_names: uuid
+reserved_words: [admin, ""]
+reserved_names: [www, api.example.com, _acme]
+`,
+			[]problem{
+				{Line: 4, Field: "random_names", Msg: `unknown generator "uuid", must be one of: base32, hex, words`},
+				{Line: 5, Field: "reserved_words[1]", Msg: "empty reserved word"},
+				{Line: 6, Field: "reserved_names[1]", Msg: `reserved name "api.example.com" must be a host prefix, not a full name`},
+				{Line: 6, Field: "reserved_names[2]", Msg: `invalid reserved name "_acme": label "_acme" must contain only letters, digits and hyphens, and must not start or end with a hyphen`},
+			},
+		},
+		{
+			"aliases",
+			"config.yaml",
+			`gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:8083
+domain_name: example.com
+hosts:
+  - name: a
+    aliases: [www, example.com]
+    uri: http://localhost:8081
+  - name: b
+    aliases:
+      - a
+      - bad_alias
+      - WWW
+    uri: http://localhost:8082
+`,
+			[]problem{
+				{Line: 10, Field: "hosts[1].aliases[0]", Msg: `duplicate host name "a.example.com", first defined in hosts[0].name on line 5`},
+				{Line: 11, Field: "hosts[1].aliases[1]", Msg: `invalid alias "bad_alias": label "bad_alias" must contain only letters, digits and hyphens, and must not start or end with a hyphen`},
+				{Line: 12, Field: "hosts[1].aliases[2]", Msg: `duplicate host name "www.example.com", first defined in hosts[0].aliases[0] on line 6`},
+			},
+		},
+		{
+			"syntax error",
+			"config.yaml",
+			"gateway_address: 0.0.0.0:8080\nhosts: [\n",
+			[]problem{{Line: 2, Msg: "syntax error: yaml: line 2: did not find expected node content"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkConfig(writeNamedConfig(t, tt.file, tt.data), 0)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_checkConfigTOMLHosts(t *testing.T) {
+	data := `gateway_address = "0.0.0.0:8080"
+api_address = "0.0.0.0:8083"
+domain_name = "example.com"
+
+[[hosts]]
+name = "a"
+uri = "http://localhost:8081"
+
+[[hosts]]
+name = "-b"
+uri = "http:///path"
+`
+	got, err := checkConfig(writeNamedConfig(t, "config.toml", data), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []problem{
+		{Line: 10, Field: "hosts[1].name", Msg: `invalid host name "-b": label "-b" must contain only letters, digits and hyphens, and must not start or end with a hyphen`},
+		{Line: 11, Field: "hosts[1].uri", Msg: "target URI has no host"},
+	}, got)
+}
+
+func Test_checkConfigDial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	data := `{
+	"gateway_address": "0.0.0.0:8080",
+	"api_address": "0.0.0.0:8083",
+	"domain_name": "example.com",
+	"hosts": [
+		{"name": "up", "uri": "http://` + l.Addr().String() + `"},
+		{"name": "down", "uri": "http://` + closedAddr + `"}
+	]
+}`
+	got, err := checkConfig(writeNamedConfig(t, "config.json", data), time.Second)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, 7, got[0].Line)
+	assert.Equal(t, "hosts[1].uri", got[0].Field)
+	assert.Contains(t, got[0].Msg, "unreachable")
+}
+
+func Test_runCheck(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Equal(t, 0, runCheck([]string{"-c", writeNamedConfig(t, "config.json", testConfigJSON)}, &buf))
+	assert.Equal(t, "config OK\n", buf.String())
+
+	buf.Reset()
+	path := writeNamedConfig(t, "config.json", `{"gateway_address": "x"}`)
+	assert.Equal(t, 1, runCheck([]string{"-c", path}, &buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, path+`:1: gateway_address: invalid address "x": address x: missing port in address`, lines[2])
+	assert.Equal(t, "3 problem(s) found", lines[len(lines)-1])
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// compactInterval is the interval between the compactions of the change log
+// of the state store.
+const compactInterval = time.Hour
+
+// compacter is the store, that keeps the change log, i.e. store.Bolt.
+type compacter interface {
+	Compact(keep uint64) error
+}
+
+// compactLoop compacts the change log of the store on start and then every
+// interval, keeping the last keep changes, until the context is done.  The
+// store released for the upgrade is skipped.
+func compactLoop(ctx context.Context, st compacter, keep uint64, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := st.Compact(keep); err != nil && !errors.Is(err, errStoreReleased) {
+			log.Printf("error compacting the state store: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
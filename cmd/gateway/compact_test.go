@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countCompacter struct {
+	mu    sync.Mutex
+	keeps []uint64
+}
+
+func (c *countCompacter) Compact(keep uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keeps = append(c.keeps, keep)
+	return nil
+}
+
+func (c *countCompacter) calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.keeps)
+}
+
+func Test_compactLoop(t *testing.T) {
+	c := &countCompacter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		compactLoop(ctx, c, 10, time.Millisecond)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return c.calls() >= 3 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, uint64(10), c.keeps[0])
+}
+
+func Test_releasableStore_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.db")
+	rs, err := openReleasable(func() (vhoster.Store, error) {
+		return store.Open(store.BackendBolt, path)
+	})
+	require.NoError(t, err)
+	defer rs.Close()
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		require.NoError(t, rs.Put(host(name, "http://localhost:1")))
+	}
+
+	require.NoError(t, rs.Compact(1))
+	changes, err := rs.st.(*store.Bolt).Changes(0)
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+	hosts, err := rs.Load()
+	require.NoError(t, err)
+	assert.Len(t, hosts, 3)
+
+	require.NoError(t, rs.release())
+	assert.ErrorIs(t, rs.Compact(1), errStoreReleased)
+
+	mem, err := openReleasable(func() (vhoster.Store, error) {
+		return &memStore{hosts: map[string]vhoster.Host{}}, nil
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mem.Compact(1), "stores without the change log are skipped")
+}
@@ -1,34 +1,50 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/apiserver"
+	"github.com/rusq/vhoster/store"
+	"gopkg.in/yaml.v3"
 )
 
 type duration time.Duration
 
 type Config struct {
-	GatewayAddress string         `json:"gateway_address,omitempty"`
-	DomainName     string         `json:"domain_name,omitempty"`
-	APIAddress     string         `json:"api_address,omitempty"`
-	Timeout        duration       `json:"timeout,omitempty"`
-	Hosts          []vhoster.Host `json:"hosts,omitempty"`
+	GatewayAddress string                `json:"gateway_address,omitempty"`
+	DomainName     string                `json:"domain_name,omitempty"`
+	APIAddress     string                `json:"api_address,omitempty"`
+	Timeout        duration              `json:"timeout,omitempty"`
+	StatePath      string                `json:"state_path,omitempty"`
+	StateBackend   string                `json:"state_backend,omitempty"`
+	StateRetention int                   `json:"state_retention,omitempty"`
+	AuditLog       string                `json:"audit_log,omitempty"`
+	DrainDelay     duration              `json:"drain_delay,omitempty"`
+	DrainTimeout   duration              `json:"drain_timeout,omitempty"`
+	ErrorPages     string                `json:"error_pages,omitempty"`
+	Fallback       *vhoster.URI          `json:"fallback,omitempty"`
+	IdleTimeout    duration              `json:"idle_timeout,omitempty"`
+	IdleAction     string                `json:"idle_action,omitempty"`
+	RandomNames    string                `json:"random_names,omitempty"`
+	ReservedWords  []string              `json:"reserved_words,omitempty"`
+	ReservedNames  []string              `json:"reserved_names,omitempty"`
+	TargetPolicy   *vhoster.TargetPolicy `json:"target_policy,omitempty"`
+	Hosts          []vhoster.Host        `json:"hosts,omitempty"`
 }
 
 func (c *Config) validate() error {
-	if c.GatewayAddress == "" {
-		return errors.New("gateway address is empty")
-	}
-	if c.DomainName == "" {
-		return errors.New("domain name is empty")
-	}
-	if c.APIAddress == "" {
-		return errors.New("api address is empty")
+	if errs := c.settingErrors(); len(errs) > 0 {
+		return errs[0]
 	}
 	for i, h := range c.Hosts {
 		if err := h.Validate(); err != nil {
@@ -38,10 +54,104 @@ func (c *Config) validate() error {
 	return nil
 }
 
+// fieldError is the invalid value of the config field.
+type fieldError struct {
+	Field string // field path, i.e. "reserved_names[1]"
+	Msg   string
+}
+
+func (e *fieldError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+// settingErrors returns all invalid settings of the config, the hosts are not
+// checked.  It is used both by the gateway, that refuses to start with any of
+// them, and by the check command.
+func (c *Config) settingErrors() []*fieldError {
+	var errs []*fieldError
+	add := func(field string, format string, a ...any) {
+		errs = append(errs, &fieldError{Field: field, Msg: fmt.Sprintf(format, a...)})
+	}
+	if c.GatewayAddress == "" {
+		add("gateway_address", "address is empty")
+	}
+	if c.APIAddress == "" {
+		add("api_address", "address is empty")
+	}
+	if c.DomainName == "" {
+		add("domain_name", "domain name is empty")
+	} else if err := checkDomain(c.DomainName); err != nil {
+		add("domain_name", "invalid domain name %q: %s", c.DomainName, err)
+	}
+	for _, d := range []struct {
+		field string
+		name  string
+		value duration
+	}{
+		{"timeout", "timeout", c.Timeout},
+		{"drain_delay", "drain delay", c.DrainDelay},
+		{"drain_timeout", "drain timeout", c.DrainTimeout},
+		{"idle_timeout", "idle timeout", c.IdleTimeout},
+	} {
+		if d.value < 0 {
+			add(d.field, "%s must not be negative", d.name)
+		}
+	}
+	if c.StateRetention < 0 {
+		add("state_retention", "state retention must not be negative")
+	}
+	switch c.StateBackend {
+	case "", store.BackendFile, store.BackendBolt:
+	default:
+		add("state_backend", "unknown state backend %q", c.StateBackend)
+	}
+	if c.Fallback != nil {
+		if u := c.Fallback.URL(); u.Scheme != "http" && u.Scheme != "https" {
+			add("fallback", "unsupported fallback scheme %q, must be http or https", u.Scheme)
+		} else if u.Host == "" {
+			add("fallback", "fallback URI has no host")
+		}
+	}
+	if c.IdleAction != "" {
+		if err := vhoster.IdleAction(c.IdleAction).Validate(); err != nil {
+			add("idle_action", "%s", err)
+		}
+	}
+	if c.RandomNames != "" && !contains(apiserver.Generators(), c.RandomNames) {
+		add("random_names", "unknown generator %q, must be one of: %s", c.RandomNames, strings.Join(apiserver.Generators(), ", "))
+	}
+	for i, w := range c.ReservedWords {
+		if w == "" {
+			add(fmt.Sprintf("reserved_words[%d]", i), "empty reserved word")
+		}
+	}
+	for i, name := range c.ReservedNames {
+		field := fmt.Sprintf("reserved_names[%d]", i)
+		if err := checkDomain(name); err != nil {
+			add(field, "invalid reserved name %q: %s", name, err)
+		} else if strings.ContainsAny(name, ".:") {
+			add(field, "reserved name %q must be a host prefix, not a full name", name)
+		}
+	}
+	if c.TargetPolicy != nil {
+		if err := c.TargetPolicy.Validate(); err != nil {
+			add("target_policy", "invalid target policy: %s", err)
+		}
+	}
+	return errs
+}
+
+// UnmarshalJSON parses the duration string, i.e. "5s", or the number of
+// seconds.
 func (d *duration) UnmarshalJSON(b []byte) error {
 	var s string
 	if err := json.Unmarshal(b, &s); err != nil {
-		return err
+		var secs float64
+		if err := json.Unmarshal(b, &secs); err != nil {
+			return fmt.Errorf("invalid duration: %s", b)
+		}
+		*d = duration(secs * float64(time.Second))
+		return nil
 	}
 	td, err := time.ParseDuration(s)
 	if err != nil {
@@ -51,18 +161,176 @@ func (d *duration) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// fileSuffix is the suffix of the config keys, which values are read from
+// the file, i.e. "token_file: /run/secrets/token" sets the "token".
+const fileSuffix = "_file"
+
+// verbatimKeys are the config keys, which values are free-form data of the
+// hosts, that is exposed through the API, and is taken as is: neither the
+// environment variables are expanded in it, nor the files are read.
+var verbatimKeys = map[string]bool{
+	"labels":      true,
+	"annotations": true,
+}
+
+// loadConfig loads the config file into cfg.  The format is detected by the
+// file extension: ".yaml" and ".yml" is YAML, ".toml" is TOML, anything else
+// is JSON.  Environment variable references in the form of ${VAR} and
+// ${VAR:-default} in string values are expanded, and the values of the keys
+// with the "_file" suffix are replaced with the contents of the referenced
+// file.  Unknown keys are rejected in all formats.
 func loadConfig(path string, cfg *Config) error {
-	f, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
+	m, err := decodeMap(path, data)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if _, err := resolve(m, filepath.Dir(path)); err != nil {
+		return fmt.Errorf("error loading %s: %w", path, err)
+	}
+	// the decoded config is converted to JSON, so that all formats share the
+	// field names, the value parsing and the strictness of the JSON decoder.
+	js, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %w", path, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
 	dec.DisallowUnknownFields()
 
 	if err := dec.Decode(cfg); err != nil {
-		return err
+		return fmt.Errorf("error loading %s: %w", path, err)
 	}
 
 	return cfg.validate()
 }
+
+// decodeMap decodes the data in the format determined by the path extension.
+func decodeMap(path string, data []byte) (map[string]any, error) {
+	var m map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		normaliseTables(m)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
+		}
+	}
+	if m == nil {
+		m = map[string]any{}
+	}
+	return m, nil
+}
+
+// normaliseTables converts the arrays of tables, that TOML decodes as
+// []map[string]any, to []any, as they are in other formats.
+func normaliseTables(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			v[k] = normaliseTables(val)
+		}
+	case []map[string]any:
+		arr := make([]any, len(v))
+		for i, val := range v {
+			arr[i] = normaliseTables(val)
+		}
+		return arr
+	case []any:
+		for i, val := range v {
+			v[i] = normaliseTables(val)
+		}
+	}
+	return v
+}
+
+var reEnvVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} with the value of the environment variable VAR,
+// and ${VAR:-default} with the value of VAR, or default, if VAR is unset or
+// empty.
+func expandEnv(s string) string {
+	return reEnvVar.ReplaceAllStringFunc(s, func(ref string) string {
+		sm := reEnvVar.FindStringSubmatch(ref)
+		if v := os.Getenv(sm[1]); v != "" || sm[2] == "" {
+			return v
+		}
+		return sm[3]
+	})
+}
+
+// resolve walks the decoded config value, expands the environment variables
+// in strings and replaces every "key_file": "path" with "key": "contents of
+// the path", trailing newlines are trimmed.  Relative paths are resolved
+// against dir.  The values of the verbatimKeys are left as is.  It returns the
+// resolved value, maps and slices are updated in place.
+func resolve(v any, dir string) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return expandEnv(v), nil
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			if verbatimKeys[k] {
+				continue
+			}
+			val, err := resolve(v[k], dir)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = val
+			if !strings.HasSuffix(k, fileSuffix) {
+				continue
+			}
+			path, ok := val.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a file path", k)
+			}
+			key := strings.TrimSuffix(k, fileSuffix)
+			if _, exists := v[key]; exists {
+				return nil, fmt.Errorf("both %s and %s are set", key, k)
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			delete(v, k)
+			v[key] = strings.TrimRight(string(b), "\r\n")
+		}
+	case []any:
+		for i := range v {
+			val, err := resolve(v[i], dir)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = val
+		}
+	}
+	return v, nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -90,3 +91,163 @@ func Test_loadConfig(t *testing.T) {
 		})
 	}
 }
+
+func writeNamedConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_loadConfigFormats(t *testing.T) {
+	t.Setenv("TEST_API_PORT", "8083")
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr bool
+	}{
+		{
+			"yaml",
+			"config.yaml",
+			`
+gateway_address: 0.0.0.0:8080
+api_address: 0.0.0.0:${TEST_API_PORT}
+domain_name: ${TEST_DOMAIN:-localhost:8080}
+timeout: 100ms
+hosts:
+  - name: vhost
+    uri: http://localhost:8081
+`,
+			false,
+		},
+		{
+			"toml",
+			"config.toml",
+			`
+gateway_address = "0.0.0.0:8080"
+api_address = "0.0.0.0:${TEST_API_PORT}"
+domain_name = "${TEST_DOMAIN:-localhost:8080}"
+timeout = "100ms"
+
+[[hosts]]
+name = "vhost"
+uri = "http://localhost:8081"
+`,
+			false,
+		},
+		{
+			"json with env",
+			"config.json",
+			`{"gateway_address": "0.0.0.0:8080", "api_address": "0.0.0.0:${TEST_API_PORT}", "domain_name": "${TEST_DOMAIN:-localhost:8080}", "timeout": "100ms", "hosts": [{"name": "vhost", "uri": "http://localhost:8081"}]}`,
+			false,
+		},
+		{
+			"unknown field yaml",
+			"config.yml",
+			"gateway_address: 0.0.0.0:8080\napi_address: 0.0.0.0:8083\ndomain_name: localhost\nlisten: 1\n",
+			true,
+		},
+		{
+			"unknown field toml",
+			"config.toml",
+			"gateway_address = \"0.0.0.0:8080\"\napi_address = \"0.0.0.0:8083\"\ndomain_name = \"localhost\"\n[[hosts]]\nname = \"a\"\nurl = \"http://localhost\"\n",
+			true,
+		},
+		{
+			"invalid yaml",
+			"config.yaml",
+			"gateway_address: [",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			err := loadConfig(writeNamedConfig(t, tt.file, tt.data), &cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.Equal(t, testCfg, &cfg)
+			}
+		})
+	}
+}
+
+func Test_loadConfigFileIndirection(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "domain"), []byte("localhost:8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("relative path", func(t *testing.T) {
+		path := filepath.Join(dir, "config.yaml")
+		data := "gateway_address: 0.0.0.0:8080\napi_address: 0.0.0.0:8083\ndomain_name_file: domain\ntimeout: 0.1\nhosts:\n  - name: vhost\n    uri: http://localhost:8081\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var cfg Config
+		if err := loadConfig(path, &cfg); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, testCfg, &cfg)
+	})
+	t.Run("both set", func(t *testing.T) {
+		path := filepath.Join(dir, "both.yaml")
+		data := "gateway_address: 0.0.0.0:8080\napi_address: 0.0.0.0:8083\ndomain_name: x\ndomain_name_file: domain\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		assert.Error(t, loadConfig(path, &Config{}))
+	})
+	t.Run("labels and annotations are verbatim", func(t *testing.T) {
+		t.Setenv("TEST_SECRET", "secret")
+		path := filepath.Join(dir, "labels.yaml")
+		data := "gateway_address: 0.0.0.0:8080\napi_address: 0.0.0.0:8083\ndomain_name_file: domain\ntimeout: 0.1\nhosts:\n  - name: vhost\n    uri: http://localhost:8081\n    labels:\n      token_file: domain\n    annotations:\n      note: ${TEST_SECRET}\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var cfg Config
+		if err := loadConfig(path, &cfg); err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.Hosts) != 1 {
+			t.Fatalf("unexpected hosts: %v", cfg.Hosts)
+		}
+		assert.Equal(t, map[string]string{"token_file": "domain"}, cfg.Hosts[0].Labels)
+		assert.Equal(t, map[string]string{"note": "${TEST_SECRET}"}, cfg.Hosts[0].Annotations)
+	})
+	t.Run("missing file", func(t *testing.T) {
+		path := filepath.Join(dir, "missing.yaml")
+		data := "gateway_address: 0.0.0.0:8080\napi_address: 0.0.0.0:8083\ndomain_name_file: nope\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		assert.Error(t, loadConfig(path, &Config{}))
+	})
+}
+
+func Test_expandEnv(t *testing.T) {
+	t.Setenv("TEST_SET", "value")
+	t.Setenv("TEST_EMPTY", "")
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"${TEST_SET}", "value"},
+		{"x-${TEST_SET}-y", "x-value-y"},
+		{"${TEST_UNSET}", ""},
+		{"${TEST_UNSET:-default}", "default"},
+		{"${TEST_EMPTY:-default}", "default"},
+		{"${TEST_SET:-default}", "value"},
+		{"$TEST_SET", "$TEST_SET"},
+		{"${TEST_UNSET:-}", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.want, expandEnv(tt.in))
+		})
+	}
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/rusq/osenv/v2"
 	"github.com/rusq/vhoster"
 	"github.com/rusq/vhoster/apiserver"
+	"github.com/rusq/vhoster/audit"
+	"github.com/rusq/vhoster/store"
+	"github.com/rusq/vhoster/systemd"
 )
 
 var (
@@ -15,26 +25,324 @@ var (
 	domainName = flag.String("domain", osenv.Value("DOMAIN", ""), "server public domain `name`, it is used as a suffix for all vhosts, e.g. vhost1.public-hostname.com.  It must include custom port, if it uses one.")
 	apiaddr    = flag.String("api", osenv.Value("API_ADDRESS", ""), "address of this api server that controls the gateway")
 	config     = flag.String("c", osenv.Value("CONFIG", ""), "path to the optional config file in JSON format.")
+	statePath  = flag.String("state", osenv.Value("STATE", ""), "`path` to persist the route table in, if empty, the hosts added through the API are lost on restart.")
+	stateBknd  = flag.String("state-backend", osenv.Value("STATE_BACKEND", ""), "state store `backend`: \"file\" (path is a directory) or \"bolt\" (path is a database file), default is \"file\"")
+	stateKeep  = flag.Int("state-retention", osenv.Value("STATE_RETENTION", 0), "`number` of the changes to keep in the change log of the \"bolt\" state store, the older ones are compacted hourly, default is 1000")
+	auditLog   = flag.String("audit", osenv.Value("AUDIT_LOG", ""), "path to the audit log `file` of the changes made through the API, if empty, audit is disabled.")
+	apiDocs    = flag.Bool("api-docs", osenv.Value("API_DOCS", false), "serve the Swagger UI page for the API on /docs/")
+	printCfg   = flag.Bool("print-config", false, "print the effective configuration, merged from the config file, environment and flags, and exit")
+	drainDelay = flag.Duration("drain-delay", osenv.Value("DRAIN_DELAY", time.Duration(0)), "`duration` to keep accepting the new connections on shutdown after the readiness endpoint starts failing, so that the load balancers notice it.")
+	drainTime  = flag.Duration("drain-timeout", osenv.Value("DRAIN_TIMEOUT", time.Duration(0)), "maximum `duration` to wait for the active requests to complete on shutdown, default is 30s")
+	fallbackTo = flag.String("fallback", osenv.Value("FALLBACK", ""), "`URI` of the server, that receives the requests for the unknown hosts, if empty, they fail with 404.")
+	errorPages = flag.String("error-pages", osenv.Value("ERROR_PAGES", ""), "`directory` with the error page templates, if empty, errors are plain text.")
+	idleTime   = flag.Duration("idle-timeout", osenv.Value("IDLE_TIMEOUT", time.Duration(0)), "handle the hosts added through the API, that haven't received requests for the `duration`, according to the idle action, if zero, idle hosts are kept.")
+	idleAction = flag.String("idle-action", osenv.Value("IDLE_ACTION", ""), "what to do with the idle hosts: \"mark\" them as dormant in the list, or \"remove\" them, default is \"mark\"")
+	randomGen  = flag.String("random-names", osenv.Value("RANDOM_NAMES", ""), "default `generator` of the random host names: \"hex\", \"base32\" or \"words\", default is \"hex\"")
+	watchEvery = flag.Duration("watch", osenv.Value("CONFIG_WATCH", time.Duration(0)), "check the config file for changes every `interval` and reload the hosts, if zero, the config is reloaded only on SIGHUP.")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:], os.Stdout))
+	}
 	flag.Parse()
 
+	if *printCfg {
+		cfg, err := mergeConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	cfg, err := parseCmdLine()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	s, err := vhoster.Listen(cfg.GatewayAddress, vhoster.WithHosts(cfg.Hosts), vhoster.WithTimeout(time.Duration(cfg.Timeout)))
+	in, err := inherit()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := []vhoster.Option{vhoster.WithHosts(cfg.Hosts), vhoster.WithTimeout(time.Duration(cfg.Timeout))}
+	var st *releasableStore
+	if cfg.StatePath != "" {
+		st, err = openReleasable(func() (vhoster.Store, error) {
+			return store.Open(cfg.StateBackend, cfg.StatePath)
+		})
+		if err != nil {
+			log.Fatalf("error opening the state store: %s", err)
+		}
+		defer st.Close()
+		opts = append(opts, vhoster.WithStore(st))
+		log.Printf("route table is persisted in %s (%s)", cfg.StatePath, coalesce(cfg.StateBackend, store.BackendFile))
+	}
+	if cfg.Fallback != nil {
+		opts = append(opts, vhoster.WithFallback(cfg.Fallback))
+	}
+	if cfg.IdleTimeout > 0 {
+		opts = append(opts, vhoster.WithIdleTimeout(time.Duration(cfg.IdleTimeout), vhoster.IdleAction(cfg.IdleAction)))
+		log.Printf("hosts without requests for %s are handled with the %q action", time.Duration(cfg.IdleTimeout), cfg.IdleAction)
+	}
+	if cfg.TargetPolicy != nil {
+		opts = append(opts, vhoster.WithTargetPolicy(cfg.TargetPolicy))
+	}
+	if cfg.ErrorPages != "" {
+		pages, err := vhoster.LoadErrorPages(cfg.ErrorPages)
+		if err != nil {
+			log.Fatalf("error loading the error pages: %s", err)
+		}
+		opts = append(opts, vhoster.WithErrorPages(pages))
+		log.Printf("loaded %d error page templates from %s", len(pages.Pages()), cfg.ErrorPages)
+	}
+
+	var gwLn, apiLn net.Listener
+	if in != nil {
+		gwLn, apiLn = in.gwLn, in.apiLn
+		log.Printf("inherited the listeners from the parent process: gateway %s, API %s", gwLn.Addr(), apiLn.Addr())
+		// the watchdog is now the responsibility of this process.
+		os.Unsetenv("WATCHDOG_PID")
+	} else {
+		sdls, err := systemd.Listeners()
+		if err != nil {
+			log.Fatalf("error getting the systemd sockets: %s", err)
+		}
+		if gwLn, apiLn, err = activatedListeners(sdls); err != nil {
+			log.Fatalf("systemd sockets: %s", err)
+		}
+		if gwLn != nil {
+			log.Printf("using the gateway socket passed by systemd: %s", gwLn.Addr())
+		} else if gwLn, err = net.Listen("tcp", cfg.GatewayAddress); err != nil {
+			log.Fatal(err)
+		}
+		if apiLn != nil {
+			log.Printf("using the API socket passed by systemd: %s", apiLn.Addr())
+		} else if apiLn, err = net.Listen("tcp", cfg.APIAddress); err != nil {
+			log.Fatal(err)
+		}
+	}
+	s, err := vhoster.New(gwLn, opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 	go s.Wait()
-	log.Printf("gateway started on %s ; API adddress: %s", cfg.GatewayAddress, cfg.APIAddress)
-	log.Fatal(apiserver.Run(s, cfg.APIAddress, cfg.DomainName))
+	if in != nil {
+		changes, err := adopt(s, in.hosts, cfg.Hosts)
+		if err != nil {
+			log.Printf("error adopting the hosts of the parent process: %s", err)
+		} else {
+			log.Printf("adopted the hosts of the parent process: %d added, %d replaced", len(changes.Add), len(changes.Replace))
+		}
+		// the fallback set through the API is kept, unless it's configured.
+		if cfg.Fallback == nil && in.fallback != nil {
+			if err := s.SetFallback(in.fallback.URL()); err != nil {
+				log.Printf("error adopting the fallback of the parent process: %s", err)
+			}
+		}
+	}
+	log.Printf("gateway started on %s ; API adddress: %s", gwLn.Addr(), apiLn.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if st != nil {
+		go compactLoop(ctx, st, uint64(cfg.StateRetention), compactInterval)
+	}
+
+	rl := newReloader(s, parseCmdLine, cfg.Hosts)
+	go rl.run(ctx, *config, *watchEvery)
+
+	upg := newUpgradeTrigger()
+	if len(upgradeSignals) > 0 {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, upgradeSignals...)
+		go func() {
+			for range sigc {
+				if err := upg.trigger(); err != nil {
+					log.Print(err)
+				}
+			}
+		}()
+	}
+
+	apiOpts := []apiserver.Option{
+		apiserver.WithDocs(*apiDocs),
+		apiserver.WithUpgrade(upg.trigger),
+		apiserver.WithDefaultGenerator(cfg.RandomNames),
+		apiserver.WithReservedWords(cfg.ReservedWords...),
+	}
+	if cfg.ReservedNames != nil {
+		apiOpts = append(apiOpts, apiserver.WithReservedNames(cfg.ReservedNames...))
+	}
+	if cfg.TargetPolicy != nil {
+		apiOpts = append(apiOpts, apiserver.WithTargetPolicy(cfg.TargetPolicy))
+	}
+	if cfg.AuditLog != "" {
+		al, err := audit.Open(cfg.AuditLog)
+		if err != nil {
+			log.Fatalf("error opening the audit log: %s", err)
+		}
+		defer al.Close()
+		apiOpts = append(apiOpts, apiserver.WithAudit(al))
+	}
+	api := apiserver.New(s, cfg.APIAddress, cfg.DomainName, apiOpts...)
+	errc := serveAPI(api, apiLn)
+	if in != nil {
+		if err := in.notifyReady(); err != nil {
+			log.Printf("error notifying the parent process: %s", err)
+		}
+		sdNotify(systemd.MainPID(os.Getpid()), systemd.Ready)
+	} else {
+		sdNotify(systemd.Ready)
+	}
+	// the watchdog is pinged until the shutdown completes, as the drain may
+	// take longer than the watchdog interval.
+	wdCtx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	go runWatchdog(wdCtx)
+
+	// the delay is not needed after the upgrade, as the new process accepts
+	// the connections.
+	drainWait := time.Duration(cfg.DrainDelay)
+loop:
+	for {
+		select {
+		case err := <-errc:
+			log.Printf("API server error: %s", err)
+			break loop
+		case <-ctx.Done():
+			stop()
+			sdNotify(systemd.Stopping)
+			log.Printf("shutting down, waiting up to %s for the active requests to complete", time.Duration(cfg.DrainTimeout))
+			break loop
+		case <-upg.c:
+			log.Print("upgrading: starting the new process")
+			apiFile, err := upgrade(s, api, gwLn, apiLn, st)
+			if err == nil {
+				log.Printf("upgrade: the new process is ready, waiting up to %s for the active requests to complete", time.Duration(cfg.DrainTimeout))
+				drainWait = 0
+				break loop
+			}
+			log.Printf("upgrade failed: %s", err)
+			if apiFile != nil {
+				// the API server was stopped for the handover, resuming it on
+				// the same socket.
+				apiLn, err = net.FileListener(apiFile)
+				apiFile.Close()
+				if err != nil {
+					log.Printf("error resuming the API server: %s", err)
+					break loop
+				}
+				api = apiserver.New(s, cfg.APIAddress, cfg.DomainName, apiOpts...)
+				errc = serveAPI(api, apiLn)
+			}
+			upg.failed()
+		}
+	}
+	if err := shutdown(s, api, drainWait, time.Duration(cfg.DrainTimeout)); err != nil {
+		log.Printf("shutdown: %s", err)
+	}
+}
+
+// serveAPI starts the API server on the listener, the returned channel
+// receives the error when the server stops.
+func serveAPI(api *apiserver.Server, l net.Listener) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- api.Serve(l)
+	}()
+	return errc
+}
+
+// upgrade hands the listeners and the route table over to the new process.
+// The API server is stopped for the time of the handover, so that the route
+// table doesn't change, and the store is released for the new process to
+// open it.  If the upgrade fails after the API server was stopped, the
+// duplicate of the API listener file is returned to resume it.
+func upgrade(gw *vhoster.Gateway, api *apiserver.Server, gwLn, apiLn net.Listener, st *releasableStore) (*os.File, error) {
+	gwFile, err := listenerFile(gwLn)
+	if err != nil {
+		return nil, err
+	}
+	defer gwFile.Close()
+	apiFile, err := listenerFile(apiLn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), upgradeTimeout)
+	defer cancel()
+	if err := api.Shutdown(ctx); err != nil {
+		log.Printf("upgrade: error stopping the API server: %s", err)
+	}
+	if st != nil {
+		if err := st.release(); err != nil {
+			log.Printf("upgrade: error closing the store: %s", err)
+		}
+	}
+	if err := startChild(gwFile, apiFile, handoff{Hosts: gw.List(), Fallback: gw.Fallback()}, upgradeTimeout); err != nil {
+		if st != nil {
+			if rerr := st.reopen(); rerr != nil {
+				log.Printf("upgrade: error reopening the store, changes will not be persisted: %s", rerr)
+			}
+		}
+		return apiFile, err
+	}
+	apiFile.Close()
+	return nil, nil
+}
+
+// shutdown drains the gateway and the API server, waiting up to the timeout
+// for the active requests to complete.  The readiness endpoint reports the
+// failure while the gateway is draining.  The listeners are closed after the
+// delay, so that the load balancers have the time to notice the failure and
+// stop sending the new connections.
+func shutdown(gw *vhoster.Gateway, api *apiserver.Server, delay, timeout time.Duration) error {
+	api.Drain()
+	if delay > 0 {
+		log.Printf("not ready, closing the listeners in %s", delay)
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	gwErr := gw.Shutdown(ctx)
+	if err := api.Shutdown(ctx); err != nil {
+		return fmt.Errorf("API server: %w", err)
+	}
+	if gwErr != nil {
+		return fmt.Errorf("gateway: %w", gwErr)
+	}
+	return nil
 }
 
+// parseCmdLine returns the effective configuration with the domain name
+// appended to the host names, and the names normalised the way the gateway
+// registers them, so that they can be compared with the running hosts.  The
+// configured hosts are pinned, so that they are never removed as idle.
 func parseCmdLine() (*Config, error) {
+	cfg, err := mergeConfig()
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range cfg.Hosts {
+		if cfg.Hosts[i], err = h.InDomain(cfg.DomainName); err != nil {
+			return nil, fmt.Errorf("host %d: %w", i, err)
+		}
+		cfg.Hosts[i].Pinned = true
+	}
+	return cfg, nil
+}
+
+// mergeConfig loads the config file, if it's set, and overrides its values
+// with the command line flags and environment variables.
+func mergeConfig() (*Config, error) {
 	var cfg = Config{}
 	if *config != "" {
 		if err := loadConfig(*config, &cfg); err != nil {
@@ -45,15 +353,46 @@ func parseCmdLine() (*Config, error) {
 	cfg.GatewayAddress = coalesce(*addr, cfg.GatewayAddress)
 	cfg.APIAddress = coalesce(*apiaddr, cfg.APIAddress)
 	cfg.DomainName = coalesce(*domainName, cfg.DomainName)
+	cfg.StatePath = coalesce(*statePath, cfg.StatePath)
+	cfg.StateBackend = coalesce(*stateBknd, cfg.StateBackend)
+	if *stateKeep > 0 {
+		cfg.StateRetention = *stateKeep
+	}
+	if cfg.StateRetention == 0 {
+		cfg.StateRetention = 1000
+	}
+	cfg.AuditLog = coalesce(*auditLog, cfg.AuditLog)
+	cfg.ErrorPages = coalesce(*errorPages, cfg.ErrorPages)
+	cfg.RandomNames = coalesce(*randomGen, cfg.RandomNames)
+	if *fallbackTo != "" {
+		u, err := vhoster.Parse(*fallbackTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback URI: %w", err)
+		}
+		cfg.Fallback = u
+	}
 	if cfg.Timeout == 0 {
 		cfg.Timeout = duration(5 * time.Second)
 	}
+	if *drainDelay > 0 {
+		cfg.DrainDelay = duration(*drainDelay)
+	}
+	if *drainTime > 0 {
+		cfg.DrainTimeout = duration(*drainTime)
+	}
+	if cfg.DrainTimeout == 0 {
+		cfg.DrainTimeout = duration(30 * time.Second)
+	}
+	if *idleTime > 0 {
+		cfg.IdleTimeout = duration(*idleTime)
+	}
+	cfg.IdleAction = coalesce(*idleAction, cfg.IdleAction)
+	if cfg.IdleTimeout > 0 && cfg.IdleAction == "" {
+		cfg.IdleAction = string(vhoster.IdleMark)
+	}
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
-	for i, h := range cfg.Hosts {
-		cfg.Hosts[i].Name = h.Name + "." + cfg.DomainName
-	}
 
 	return &cfg, nil
 }
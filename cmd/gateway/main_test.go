@@ -1,11 +1,15 @@
 package main
 
 import (
+	"net"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/apiserver"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_parseCmdLine(t *testing.T) {
@@ -26,8 +30,10 @@ func Test_parseCmdLine(t *testing.T) {
 				DomainName:     "example.com",
 				APIAddress:     "5.6.7.8:8083",
 				Timeout:        duration(100 * time.Millisecond),
+				DrainTimeout:   duration(30 * time.Second),
+				StateRetention: 1000,
 				Hosts: []vhoster.Host{
-					{Name: "vhost.example.com", URI: mustParse("http://localhost:8081")}, // vhost name should have the updated domain name.
+					{Name: "vhost.example.com", URI: mustParse("http://localhost:8081"), Pinned: true}, // vhost name should have the updated domain name, configured hosts are pinned.
 				},
 			}
 		)
@@ -38,3 +44,38 @@ func Test_parseCmdLine(t *testing.T) {
 func ptr[T any](v T) *T {
 	return &v
 }
+
+func Test_shutdown(t *testing.T) {
+	gwLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	gw, err := vhoster.New(gwLn)
+	require.NoError(t, err)
+	apiLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	api := apiserver.New(gw, apiLn.Addr().String(), "example.com")
+	errc := serveAPI(api, apiLn)
+	readyURL := "http://" + apiLn.Addr().String() + "/ready/"
+
+	ready := func() int {
+		resp, err := http.Get(readyURL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, ready())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- shutdown(gw, api, 300*time.Millisecond, time.Second)
+	}()
+	assert.Eventually(t, func() bool { return ready() == http.StatusServiceUnavailable }, time.Second, 10*time.Millisecond)
+	// the gateway still accepts the connections during the delay.
+	conn, err := net.Dial("tcp", gwLn.Addr().String())
+	require.NoError(t, err, "gateway listener is closed before the delay")
+	conn.Close()
+
+	require.NoError(t, <-done)
+	assert.ErrorIs(t, <-errc, http.ErrServerClosed)
+	_, err = net.Dial("tcp", gwLn.Addr().String())
+	assert.Error(t, err, "gateway listener is open after the shutdown")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rusq/vhoster"
+)
+
+// configActor is the actor that the changes made by the config reload are
+// attributed to.
+const configActor = "config"
+
+// hostApplier is the subset of the gateway used by the reloader.
+type hostApplier interface {
+	List() []vhoster.Host
+	Apply(...vhoster.Op) error
+}
+
+// reloader reconciles the hosts from the config file with the running
+// gateway.  It only touches the hosts that came from the config file, so that
+// the hosts added through the API are left intact.
+type reloader struct {
+	gw   hostApplier
+	load func() (*Config, error) // loads and validates the config
+
+	mu        sync.Mutex
+	fileHosts map[string]struct{} // names of the hosts from the last loaded config
+}
+
+func newReloader(gw hostApplier, load func() (*Config, error), initial []vhoster.Host) *reloader {
+	r := &reloader{gw: gw, load: load}
+	r.fileHosts = hostNames(initial)
+	return r
+}
+
+// reload loads the config and applies the changes in its hosts to the
+// gateway.  It returns the applied changes.
+func (r *reloader) reload() (vhoster.Changes, error) {
+	cfg, err := r.load()
+	if err != nil {
+		return vhoster.Changes{}, err
+	}
+	return r.reconcile(cfg.Hosts)
+}
+
+// reconcile applies the difference between the previous and the new set of
+// hosts from the config file to the gateway, all or nothing.  Hosts from the
+// new config replace the existing hosts with the same name, even if they were
+// added through the API, as they do when the gateway starts.
+func (r *reloader) reconcile(hosts []vhoster.Host) (vhoster.Changes, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	desired := hostNames(hosts)
+	var current []vhoster.Host // existing hosts managed by the config file
+	for _, h := range r.gw.List() {
+		_, wasInFile := r.fileHosts[h.Name]
+		_, isInFile := desired[h.Name]
+		if wasInFile || isInFile {
+			current = append(current, h)
+		}
+	}
+	changes := vhoster.Diff(current, hosts)
+
+	var ops []vhoster.Op
+	for _, h := range changes.Remove {
+		ops = append(ops, vhoster.Op{Action: vhoster.ActionRemove, Host: vhoster.Host{Name: h.Name}, Actor: configActor})
+	}
+	for _, h := range changes.Replace {
+		ops = append(ops, vhoster.Op{Action: vhoster.ActionReplace, Host: h, Actor: configActor})
+	}
+	for _, h := range changes.Add {
+		ops = append(ops, vhoster.Op{Action: vhoster.ActionAdd, Host: h, Actor: configActor})
+	}
+	if len(ops) > 0 {
+		if err := r.gw.Apply(ops...); err != nil {
+			return vhoster.Changes{}, err
+		}
+	}
+	r.fileHosts = desired
+	return changes, nil
+}
+
+// run reloads the config on SIGHUP, and if interval is not zero, when the
+// modification time of the config file changes.  It returns when the context
+// is cancelled.
+func (r *reloader) run(ctx context.Context, path string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 && path != "" {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	lastMod := modTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Print("got SIGHUP, reloading the config")
+		case <-tick:
+			mod := modTime(path)
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			log.Print("config file changed, reloading")
+		}
+		changes, err := r.reload()
+		if err != nil {
+			log.Printf("config reload failed, keeping the current hosts: %s", err)
+			continue
+		}
+		log.Printf("config reloaded: %d added, %d replaced, %d removed", len(changes.Add), len(changes.Replace), len(changes.Remove))
+	}
+}
+
+func hostNames(hosts []vhoster.Host) map[string]struct{} {
+	m := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		m[h.Name] = struct{}{}
+	}
+	return m
+}
+
+// modTime returns the modification time of the file or zero time if it can't
+// be determined.
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
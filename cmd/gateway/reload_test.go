@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/rusq/vhoster"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func host(name, uri string) vhoster.Host {
+	return vhoster.Host{Name: name, URI: mustParse(uri)}
+}
+
+func TestReloader_reload(t *testing.T) {
+	fileHosts := []vhoster.Host{
+		host("a.example.com", "http://localhost:8081"),
+		host("b.example.com", "http://localhost:8082"),
+	}
+	g, err := vhoster.Listen("127.0.0.1:0", vhoster.WithHosts(fileHosts))
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+	// host added through the API must survive the reload.
+	require.NoError(t, g.Add("api.example.com", mustParse("http://localhost:9000").URL()))
+
+	newCfg := &Config{Hosts: []vhoster.Host{
+		host("a.example.com", "http://localhost:9091"), // changed
+		host("c.example.com", "http://localhost:8083"), // added, b is removed
+	}}
+	var loadErr error
+	rl := newReloader(g, func() (*Config, error) { return newCfg, loadErr }, fileHosts)
+
+	changes, err := rl.reload()
+	require.NoError(t, err)
+	assert.Equal(t, vhoster.Changes{
+		Add:     []vhoster.Host{host("c.example.com", "http://localhost:8083")},
+		Replace: []vhoster.Host{host("a.example.com", "http://localhost:9091")},
+		Remove:  []vhoster.Host{host("b.example.com", "http://localhost:8082")},
+	}, changes)
+	assert.Equal(t, []string{
+		"a.example.com http://localhost:9091",
+		"api.example.com http://localhost:9000",
+		"c.example.com http://localhost:8083",
+	}, listed(g))
+	hist := g.History()
+	for _, rev := range hist[len(hist)-3:] {
+		assert.Equal(t, configActor, rev.Actor)
+	}
+
+	t.Run("unchanged config is a no-op", func(t *testing.T) {
+		changes, err := rl.reload()
+		require.NoError(t, err)
+		assert.True(t, changes.Empty())
+	})
+	t.Run("invalid config keeps the hosts", func(t *testing.T) {
+		loadErr = errors.New("invalid config")
+		_, err := rl.reload()
+		assert.Error(t, err)
+		assert.Len(t, g.List(), 3)
+		loadErr = nil
+	})
+	t.Run("removing a host from the file does not touch the API hosts", func(t *testing.T) {
+		newCfg = &Config{}
+		changes, err := rl.reload()
+		require.NoError(t, err)
+		assert.Len(t, changes.Remove, 2)
+		assert.Equal(t, []string{"api.example.com http://localhost:9000"}, listed(g))
+	})
+}
+
+func listed(g *vhoster.Gateway) []string {
+	var ret []string
+	for _, h := range g.List() {
+		ret = append(ret, h.Name+" "+h.URI.String())
+	}
+	sort.Strings(ret)
+	return ret
+}
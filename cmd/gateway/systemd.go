@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/rusq/vhoster/systemd"
+)
+
+// Names of the sockets in the systemd socket units (FileDescriptorName=).
+const (
+	sdGateway = "gateway"
+	sdAPI     = "api"
+)
+
+// activatedListeners returns the gateway and API listeners passed by systemd.
+// The sockets are matched by name, if they are not named, the first one is
+// the gateway and the second one is the API.  Any of the returned listeners
+// may be nil, if it was not passed.
+func activatedListeners(ls []systemd.Listener) (gw, api net.Listener, err error) {
+	unnamed := true
+	for _, l := range ls {
+		if l.Name != systemd.UnknownName {
+			unnamed = false
+		}
+	}
+	if unnamed {
+		if len(ls) > 2 {
+			return nil, nil, fmt.Errorf("expected at most 2 unnamed sockets, got %d", len(ls))
+		}
+		if len(ls) > 0 {
+			gw = ls[0].Listener
+		}
+		if len(ls) > 1 {
+			api = ls[1].Listener
+		}
+		return gw, api, nil
+	}
+	for _, l := range ls {
+		switch l.Name {
+		case sdGateway:
+			gw = l.Listener
+		case sdAPI:
+			api = l.Listener
+		default:
+			return nil, nil, fmt.Errorf("unexpected socket name %q, expected %q or %q", l.Name, sdGateway, sdAPI)
+		}
+	}
+	return gw, api, nil
+}
+
+// sdNotify sends the notification to systemd, the errors are logged.
+func sdNotify(state ...string) {
+	if _, err := systemd.Notify(state...); err != nil {
+		log.Printf("systemd notification error: %s", err)
+	}
+}
+
+// runWatchdog pings the systemd watchdog, if it's enabled, until the context
+// is cancelled.
+func runWatchdog(ctx context.Context) {
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Printf("systemd watchdog: %s", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			sdNotify(systemd.Watchdog)
+		}
+	}
+}
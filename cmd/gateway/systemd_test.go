@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/rusq/vhoster/systemd"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeListener struct {
+	net.Listener
+	id string
+}
+
+func sdl(name, id string) systemd.Listener {
+	return systemd.Listener{Listener: fakeListener{id: id}, Name: name}
+}
+
+func Test_activatedListeners(t *testing.T) {
+	tests := []struct {
+		name    string
+		ls      []systemd.Listener
+		wantGW  string
+		wantAPI string
+		wantErr bool
+	}{
+		{"none", nil, "", "", false},
+		{"named", []systemd.Listener{sdl(sdAPI, "1"), sdl(sdGateway, "2")}, "2", "1", false},
+		{"named gateway only", []systemd.Listener{sdl(sdGateway, "1")}, "1", "", false},
+		{"unnamed", []systemd.Listener{sdl(systemd.UnknownName, "1"), sdl(systemd.UnknownName, "2")}, "1", "2", false},
+		{"unnamed single", []systemd.Listener{sdl(systemd.UnknownName, "1")}, "1", "", false},
+		{"too many unnamed", []systemd.Listener{sdl(systemd.UnknownName, "1"), sdl(systemd.UnknownName, "2"), sdl(systemd.UnknownName, "3")}, "", "", true},
+		{"unexpected name", []systemd.Listener{sdl(sdGateway, "1"), sdl("metrics", "2")}, "", "", true},
+	}
+	id := func(l net.Listener) string {
+		if l == nil {
+			return ""
+		}
+		return l.(fakeListener).id
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw, api, err := activatedListeners(tt.ls)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("activatedListeners() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantGW, id(gw))
+			assert.Equal(t, tt.wantAPI, id(api))
+		})
+	}
+}
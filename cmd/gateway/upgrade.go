@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rusq/vhoster"
+)
+
+// Zero-downtime upgrade.
+//
+// The running process starts the new executable, passing it the listening
+// sockets and the current route table, waits for it to become ready, then
+// drains the active connections and exits.  The file descriptors passed to
+// the new process are:
+//
+//	3 - gateway listener
+//	4 - API listener
+//	5 - route table, read end of the pipe
+//	6 - readiness notification, write end of the pipe
+const (
+	// envUpgrade is set in the environment of the new process.
+	envUpgrade = "VHOSTER_UPGRADE"
+	// upgradeActor is the actor that the hosts inherited from the parent
+	// process are attributed to.
+	upgradeActor = "upgrade"
+	// upgradeTimeout is how long to wait for the new process to become
+	// ready.
+	upgradeTimeout = 30 * time.Second
+)
+
+const (
+	fdGateway = 3 + iota
+	fdAPI
+	fdState
+	fdReady
+)
+
+var errUpgradeInProgress = errors.New("upgrade is already in progress")
+
+// handoff is the state passed to the new process.
+type handoff struct {
+	Hosts    []vhoster.Host `json:"hosts"`
+	Fallback *vhoster.URI   `json:"fallback,omitempty"`
+}
+
+// inheritance is what the new process got from the parent.
+type inheritance struct {
+	gwLn     net.Listener
+	apiLn    net.Listener
+	hosts    []vhoster.Host
+	fallback *vhoster.URI
+	ready    *os.File
+}
+
+// inherit returns the listeners and the route table inherited from the
+// parent process, or nil, if the process was not started by the upgrade.
+func inherit() (*inheritance, error) {
+	if os.Getenv(envUpgrade) == "" {
+		return nil, nil
+	}
+	os.Unsetenv(envUpgrade)
+
+	gwLn, err := fileListener(fdGateway, "gateway")
+	if err != nil {
+		return nil, err
+	}
+	apiLn, err := fileListener(fdAPI, "api")
+	if err != nil {
+		gwLn.Close()
+		return nil, err
+	}
+	in := &inheritance{gwLn: gwLn, apiLn: apiLn, ready: os.NewFile(fdReady, "ready")}
+
+	sf := os.NewFile(fdState, "state")
+	defer sf.Close()
+	var st handoff
+	if err := json.NewDecoder(bufio.NewReader(sf)).Decode(&st); err != nil {
+		gwLn.Close()
+		apiLn.Close()
+		return nil, fmt.Errorf("error reading the route table: %w", err)
+	}
+	in.hosts = st.Hosts
+	in.fallback = st.Fallback
+	return in, nil
+}
+
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid %s listener descriptor", name)
+	}
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("error inheriting the %s listener: %w", name, err)
+	}
+	return l, nil
+}
+
+// notifyReady tells the parent process that the new process is serving.
+func (in *inheritance) notifyReady() error {
+	defer in.ready.Close()
+	_, err := in.ready.Write([]byte("ready\n"))
+	return err
+}
+
+// adopt adds the hosts inherited from the parent process to the gateway,
+// except the ones defined in the config, that take precedence, as they do
+// on restart.
+func adopt(g hostApplier, inherited, cfgHosts []vhoster.Host) (vhoster.Changes, error) {
+	skip := hostNames(cfgHosts)
+	var desired []vhoster.Host
+	for _, h := range inherited {
+		if _, ok := skip[h.Name]; !ok {
+			desired = append(desired, h)
+		}
+	}
+	names := hostNames(desired)
+	var current []vhoster.Host
+	for _, h := range g.List() {
+		if _, ok := names[h.Name]; ok {
+			current = append(current, h)
+		}
+	}
+	changes := vhoster.Diff(current, desired)
+	var ops []vhoster.Op
+	for _, h := range changes.Replace {
+		ops = append(ops, vhoster.Op{Action: vhoster.ActionReplace, Host: h, Actor: upgradeActor})
+	}
+	for _, h := range changes.Add {
+		ops = append(ops, vhoster.Op{Action: vhoster.ActionAdd, Host: h, Actor: upgradeActor})
+	}
+	if len(ops) > 0 {
+		if err := g.Apply(ops...); err != nil {
+			return vhoster.Changes{}, err
+		}
+	}
+	return changes, nil
+}
+
+// startChild starts the new process from the current executable with the
+// same arguments, hands over the listener files and the state, and waits up
+// to timeout for it to become ready.  If it doesn't, the process is killed.
+func startChild(gwFile, apiFile *os.File, st handoff, timeout time.Duration) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	stateR, stateW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer stateW.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		stateR.Close()
+		return err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), envUpgrade+"=1")
+	cmd.ExtraFiles = []*os.File{gwFile, apiFile, stateR, readyW}
+	err = cmd.Start()
+	// the child has its own copies now.
+	stateR.Close()
+	readyW.Close()
+	if err != nil {
+		return fmt.Errorf("error starting the new process: %w", err)
+	}
+	fail := func(err error) error {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	if err := json.NewEncoder(stateW).Encode(st); err != nil {
+		return fail(fmt.Errorf("error sending the route table: %w", err))
+	}
+	stateW.Close()
+
+	readyc := make(chan error, 1)
+	go func() {
+		line, err := bufio.NewReader(readyR).ReadString('\n')
+		if line == "" && err != nil {
+			err = errors.New("new process exited before becoming ready")
+		} else {
+			err = nil
+		}
+		readyc <- err
+	}()
+	select {
+	case err := <-readyc:
+		if err != nil {
+			return fail(err)
+		}
+	case <-time.After(timeout):
+		return fail(fmt.Errorf("new process did not become ready in %s", timeout))
+	}
+	return cmd.Process.Release()
+}
+
+// listenerFile returns the duplicate of the listener file descriptor.
+func listenerFile(l net.Listener) (*os.File, error) {
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener %T can't be handed over", l)
+	}
+	return fl.File()
+}
+
+// upgradeTrigger allows only one upgrade at a time.
+type upgradeTrigger struct {
+	running atomic.Bool
+	c       chan struct{}
+}
+
+func newUpgradeTrigger() *upgradeTrigger {
+	return &upgradeTrigger{c: make(chan struct{}, 1)}
+}
+
+// trigger requests the upgrade, it returns errUpgradeInProgress if the
+// upgrade is already running.
+func (t *upgradeTrigger) trigger() error {
+	if !t.running.CompareAndSwap(false, true) {
+		return errUpgradeInProgress
+	}
+	t.c <- struct{}{}
+	return nil
+}
+
+// failed allows to trigger the upgrade again.
+func (t *upgradeTrigger) failed() {
+	t.running.Store(false)
+}
+
+var errStoreReleased = errors.New("store is released for the upgrade")
+
+// releasableStore is the store that can be closed for the time of the
+// upgrade, so that the new process can open it, and reopened, if the upgrade
+// fails.
+type releasableStore struct {
+	open func() (vhoster.Store, error)
+
+	mu sync.Mutex
+	st vhoster.Store
+}
+
+func openReleasable(open func() (vhoster.Store, error)) (*releasableStore, error) {
+	st, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &releasableStore{open: open, st: st}, nil
+}
+
+func (s *releasableStore) Load() ([]vhoster.Host, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st == nil {
+		return nil, errStoreReleased
+	}
+	return s.st.Load()
+}
+
+func (s *releasableStore) Put(h vhoster.Host) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st == nil {
+		return errStoreReleased
+	}
+	return s.st.Put(h)
+}
+
+func (s *releasableStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st == nil {
+		return errStoreReleased
+	}
+	return s.st.Delete(name)
+}
+
+// Compact trims the change log of the store to the last keep changes, it is
+// a no-op if the store doesn't keep the change log.
+func (s *releasableStore) Compact(keep uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st == nil {
+		return errStoreReleased
+	}
+	c, ok := s.st.(compacter)
+	if !ok {
+		return nil
+	}
+	return c.Compact(keep)
+}
+
+// Close closes the store, it is a no-op if the store is released.
+func (s *releasableStore) Close() error {
+	return s.release()
+}
+
+// release closes the underlying store.
+func (s *releasableStore) release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st == nil {
+		return nil
+	}
+	err := s.st.Close()
+	s.st = nil
+	return err
+}
+
+// reopen opens the released store again.
+func (s *releasableStore) reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st != nil {
+		return nil
+	}
+	st, err := s.open()
+	if err != nil {
+		return err
+	}
+	s.st = st
+	return nil
+}
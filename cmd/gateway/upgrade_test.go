@@ -0,0 +1,185 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/vhoster"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// envTestChild selects the behaviour of the test binary started as the new
+// process by startChild.
+const envTestChild = "VHOSTER_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envUpgrade) != "" {
+		os.Exit(testChild())
+	}
+	os.Exit(m.Run())
+}
+
+// testChild is run in the new process.  It inherits the state, reports
+// ready, and answers a single request on the gateway listener with the names
+// of the inherited hosts.
+func testChild() int {
+	in, err := inherit()
+	if err != nil {
+		return 1
+	}
+	if os.Getenv(envTestChild) == "fail" {
+		return 1
+	}
+	if err := in.notifyReady(); err != nil {
+		return 1
+	}
+	in.gwLn.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+	conn, err := in.gwLn.Accept()
+	if err != nil {
+		return 1
+	}
+	defer conn.Close()
+	if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+		return 1
+	}
+	var names []string
+	for _, h := range in.hosts {
+		names = append(names, h.Name)
+	}
+	resp := http.Response{
+		StatusCode: http.StatusOK,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Body:       io.NopCloser(strings.NewReader(strings.Join(names, ","))),
+		Close:      true,
+	}
+	resp.Write(conn)
+	return 0
+}
+
+func testListenerFiles(t *testing.T) (gwLn net.Listener, gwFile, apiFile *os.File) {
+	t.Helper()
+	gwLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	apiLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { gwLn.Close(); apiLn.Close() })
+	gwFile, err = listenerFile(gwLn)
+	require.NoError(t, err)
+	apiFile, err = listenerFile(apiLn)
+	require.NoError(t, err)
+	t.Cleanup(func() { gwFile.Close(); apiFile.Close() })
+	return gwLn, gwFile, apiFile
+}
+
+func Test_startChild(t *testing.T) {
+	t.Run("new process takes over the listener", func(t *testing.T) {
+		gwLn, gwFile, apiFile := testListenerFiles(t)
+		hosts := []vhoster.Host{
+			host("a.example.com", "http://localhost:8081"),
+			host("b.example.com", "http://localhost:8082"),
+		}
+		require.NoError(t, startChild(gwFile, apiFile, handoff{Hosts: hosts}, 10*time.Second))
+
+		// the parent stops listening, the socket stays open in the child.
+		addr := gwLn.Addr().String()
+		gwLn.Close()
+		gwFile.Close()
+
+		resp, err := http.Get("http://" + addr + "/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "a.example.com,b.example.com", string(body))
+	})
+	t.Run("new process fails", func(t *testing.T) {
+		t.Setenv(envTestChild, "fail")
+		_, gwFile, apiFile := testListenerFiles(t)
+		err := startChild(gwFile, apiFile, handoff{}, 10*time.Second)
+		assert.ErrorContains(t, err, "exited before becoming ready")
+	})
+}
+
+func Test_adopt(t *testing.T) {
+	g, err := vhoster.Listen("127.0.0.1:0", vhoster.WithHosts([]vhoster.Host{
+		host("cfg.example.com", "http://localhost:9001"),
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+	require.NoError(t, g.Add("stored.example.com", mustParse("http://localhost:9002").URL()))
+
+	changes, err := adopt(g, []vhoster.Host{
+		host("cfg.example.com", "http://localhost:8001"),    // config takes precedence
+		host("stored.example.com", "http://localhost:8002"), // replaced
+		host("api.example.com", "http://localhost:8003"),    // added
+	}, []vhoster.Host{host("cfg.example.com", "http://localhost:9001")})
+	require.NoError(t, err)
+	assert.Len(t, changes.Add, 1)
+	assert.Len(t, changes.Replace, 1)
+	assert.Empty(t, changes.Remove)
+	assert.Equal(t, []string{
+		"api.example.com http://localhost:8003",
+		"cfg.example.com http://localhost:9001",
+		"stored.example.com http://localhost:8002",
+	}, listed(g))
+}
+
+func Test_upgradeTrigger(t *testing.T) {
+	upg := newUpgradeTrigger()
+	require.NoError(t, upg.trigger())
+	assert.ErrorIs(t, upg.trigger(), errUpgradeInProgress)
+	<-upg.c
+	assert.ErrorIs(t, upg.trigger(), errUpgradeInProgress, "still running")
+	upg.failed()
+	assert.NoError(t, upg.trigger())
+}
+
+type memStore struct {
+	hosts  map[string]vhoster.Host
+	closed bool
+}
+
+func (m *memStore) Load() ([]vhoster.Host, error) {
+	var ret []vhoster.Host
+	for _, h := range m.hosts {
+		ret = append(ret, h)
+	}
+	return ret, nil
+}
+func (m *memStore) Put(h vhoster.Host) error { m.hosts[h.Name] = h; return nil }
+func (m *memStore) Delete(name string) error { delete(m.hosts, name); return nil }
+func (m *memStore) Close() error             { m.closed = true; return nil }
+
+func Test_releasableStore(t *testing.T) {
+	var opened []*memStore
+	rs, err := openReleasable(func() (vhoster.Store, error) {
+		m := &memStore{hosts: map[string]vhoster.Host{}}
+		opened = append(opened, m)
+		return m, nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, rs.Put(host("a.example.com", "http://localhost:1")))
+
+	require.NoError(t, rs.release())
+	assert.True(t, opened[0].closed)
+	assert.True(t, errors.Is(rs.Put(host("b.example.com", "http://localhost:2")), errStoreReleased))
+	_, err = rs.Load()
+	assert.ErrorIs(t, err, errStoreReleased)
+
+	require.NoError(t, rs.reopen())
+	assert.Len(t, opened, 2)
+	assert.NoError(t, rs.Delete("a.example.com"))
+	require.NoError(t, rs.Close())
+	assert.NoError(t, rs.Close(), "close is idempotent")
+}
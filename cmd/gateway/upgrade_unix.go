@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals are the signals that start the upgrade.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
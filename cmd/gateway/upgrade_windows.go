@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// upgradeSignals are the signals that start the upgrade, there are none on
+// Windows, where the upgrade is not supported.
+var upgradeSignals []os.Signal
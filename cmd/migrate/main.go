@@ -0,0 +1,91 @@
+// Command migrate imports the hosts from the gateway configuration file into
+// the route table store, so that they can be managed through the API.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/rusq/osenv/v2"
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/store"
+)
+
+var (
+	config     = flag.String("c", osenv.Value("CONFIG", ""), "path to the gateway config file in JSON format.")
+	domainName = flag.String("domain", osenv.Value("DOMAIN", ""), "domain `name` to append to the host names, overrides the domain name from the config file.")
+	statePath  = flag.String("state", osenv.Value("STATE", ""), "`path` of the route table store.")
+	stateBknd  = flag.String("state-backend", osenv.Value("STATE_BACKEND", store.BackendBolt), "state store `backend`: \"file\" or \"bolt\"")
+)
+
+func main() {
+	flag.Parse()
+	if *config == "" || *statePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	st, err := store.Open(*stateBknd, *statePath)
+	if err != nil {
+		log.Fatalf("error opening the state store: %s", err)
+	}
+	n, err := importHosts(st, f, *domainName)
+	if cerr := st.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("imported %d hosts into %s", n, *statePath)
+}
+
+// hostsConfig is the subset of the gateway configuration used by the import.
+type hostsConfig struct {
+	DomainName string         `json:"domain_name,omitempty"`
+	Hosts      []vhoster.Host `json:"hosts,omitempty"`
+}
+
+// importHosts reads the gateway configuration from r and puts its hosts into
+// the store.  The host names and aliases are qualified with the domain name
+// and normalised in the same way as the gateway does it, so that the stored
+// hosts have the same names as the configured ones.  If domain is empty, the
+// domain name from the configuration is used.  It returns the number of
+// imported hosts.
+func importHosts(st vhoster.Store, r io.Reader, domain string) (int, error) {
+	var cfg hostsConfig
+	if err := json.NewDecoder(r).Decode(&cfg); err != nil {
+		return 0, fmt.Errorf("error decoding the config: %w", err)
+	}
+	if domain == "" {
+		domain = cfg.DomainName
+	}
+	if domain == "" {
+		return 0, fmt.Errorf("domain name is empty")
+	}
+	hosts := make([]vhoster.Host, len(cfg.Hosts))
+	for i, h := range cfg.Hosts {
+		if err := h.Validate(); err != nil {
+			return 0, fmt.Errorf("error validating configuration host %d: %w", i, err)
+		}
+		var err error
+		if hosts[i], err = h.InDomain(domain); err != nil {
+			return 0, fmt.Errorf("configuration host %d: %w", i, err)
+		}
+	}
+	for i, h := range hosts {
+		if err := st.Put(h); err != nil {
+			return i, fmt.Errorf("error storing host %q: %w", h.Name, err)
+		}
+	}
+	return len(cfg.Hosts), nil
+}
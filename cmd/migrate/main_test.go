@@ -0,0 +1,102 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rusq/vhoster"
+	"github.com/rusq/vhoster/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigJSON = `
+{
+	"gateway_address": "0.0.0.0:8080",
+	"api_address": "0.0.0.0:8083",
+	"domain_name": "localhost:8080",
+	"timeout": "100ms",
+	"hosts": [
+		{
+			"name": "vhost",
+			"uri": "http://localhost:8081"
+		},
+		{
+			"name": "Other",
+			"uri": "http://localhost:8082",
+			"aliases": ["www", "Old.localhost:8080"]
+		}
+	]
+}
+`
+
+func Test_importHosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		domain  string
+		want    []vhoster.Host
+		wantErr bool
+	}{
+		{
+			"domain from the config",
+			testConfigJSON,
+			"",
+			[]vhoster.Host{
+				{Name: "other.localhost:8080", URI: vhoster.Must(vhoster.Parse("http://localhost:8082")), Aliases: []string{"www.localhost:8080", "old.localhost:8080"}},
+				{Name: "vhost.localhost:8080", URI: vhoster.Must(vhoster.Parse("http://localhost:8081"))},
+			},
+			false,
+		},
+		{
+			"domain override",
+			`{"hosts":[{"name":"vhost","uri":"http://localhost:8081"}]}`,
+			"example.com",
+			[]vhoster.Host{
+				{Name: "vhost.example.com", URI: vhoster.Must(vhoster.Parse("http://localhost:8081"))},
+			},
+			false,
+		},
+		{
+			"no domain",
+			`{"hosts":[{"name":"vhost","uri":"http://localhost:8081"}]}`,
+			"",
+			nil,
+			true,
+		},
+		{
+			"invalid alias",
+			`{"domain_name":"example.com","hosts":[{"name":"vhost","uri":"http://localhost:8081","aliases":["-bad"]}]}`,
+			"",
+			nil,
+			true,
+		},
+		{
+			"invalid host",
+			`{"domain_name":"example.com","hosts":[{"name":"vhost"}]}`,
+			"",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := store.OpenBolt(filepath.Join(t.TempDir(), "routes.db"))
+			require.NoError(t, err)
+			defer st.Close()
+
+			n, err := importHosts(st, strings.NewReader(tt.config), tt.domain)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("importHosts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, len(tt.want), n)
+			got, err := st.Load()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
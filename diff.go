@@ -0,0 +1,82 @@
+package vhoster
+
+import "sort"
+
+// Changes is a set of changes that transforms one set of hosts into another.
+type Changes struct {
+	// Add contains hosts that do not exist and should be added.
+	Add []Host `json:"add,omitempty"`
+	// Replace contains hosts that exist, but point to a different target, or
+	// have different aliases, labels or annotations.
+	Replace []Host `json:"replace,omitempty"`
+	// Remove contains hosts that exist, but are not desired.
+	Remove []Host `json:"remove,omitempty"`
+}
+
+// Empty returns true if there are no changes.
+func (c Changes) Empty() bool {
+	return len(c.Add) == 0 && len(c.Replace) == 0 && len(c.Remove) == 0
+}
+
+// Diff computes the changes required to transform the current set of hosts
+// into the desired one.  Hosts are matched by name, and the resulting lists
+// are sorted by name.
+func Diff(current, desired []Host) Changes {
+	cur := make(map[string]Host, len(current))
+	for _, h := range current {
+		cur[h.Name] = h
+	}
+	want := make(map[string]struct{}, len(desired))
+
+	var c Changes
+	for _, h := range desired {
+		want[h.Name] = struct{}{}
+		existing, ok := cur[h.Name]
+		if !ok {
+			c.Add = append(c.Add, h)
+			continue
+		}
+		if !sameTarget(existing, h) || !sameAliases(existing, h) ||
+			!sameMap(existing.Labels, h.Labels) || !sameMap(existing.Annotations, h.Annotations) {
+			c.Replace = append(c.Replace, h)
+		}
+	}
+	for _, h := range current {
+		if _, ok := want[h.Name]; !ok {
+			c.Remove = append(c.Remove, h)
+		}
+	}
+	sortHosts(c.Add)
+	sortHosts(c.Replace)
+	sortHosts(c.Remove)
+	return c
+}
+
+// sameTarget returns true if both hosts point to the same target.
+func sameTarget(a, b Host) bool {
+	if a.URI == nil || b.URI == nil {
+		return a.URI == b.URI
+	}
+	return a.URI.String() == b.URI.String()
+}
+
+// sameAliases returns true if both hosts have the same set of aliases.
+func sameAliases(a, b Host) bool {
+	if len(a.Aliases) != len(b.Aliases) {
+		return false
+	}
+	set := make(map[string]struct{}, len(a.Aliases))
+	for _, name := range a.Aliases {
+		set[name] = struct{}{}
+	}
+	for _, name := range b.Aliases {
+		if _, ok := set[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func sortHosts(hs []Host) {
+	sort.Slice(hs, func(i, j int) bool { return hs[i].Name < hs[j].Name })
+}
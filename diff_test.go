@@ -0,0 +1,101 @@
+package vhoster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testHost(name, uri string) Host {
+	return Host{Name: name, URI: Must(Parse(uri))}
+}
+
+func withAliases(h Host, aliases ...string) Host {
+	h.Aliases = aliases
+	return h
+}
+
+func withLabels(h Host, labels map[string]string) Host {
+	h.Labels = labels
+	return h
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []Host
+		desired []Host
+		want    Changes
+	}{
+		{
+			"no changes",
+			[]Host{testHost("a.example.com", "http://a:80")},
+			[]Host{testHost("a.example.com", "http://a:80")},
+			Changes{},
+		},
+		{
+			"empty desired removes everything",
+			[]Host{testHost("b.example.com", "http://b:80"), testHost("a.example.com", "http://a:80")},
+			nil,
+			Changes{Remove: []Host{testHost("a.example.com", "http://a:80"), testHost("b.example.com", "http://b:80")}},
+		},
+		{
+			"add, replace and remove",
+			[]Host{
+				testHost("keep.example.com", "http://keep:80"),
+				testHost("change.example.com", "http://old:80"),
+				testHost("gone.example.com", "http://gone:80"),
+			},
+			[]Host{
+				testHost("new.example.com", "http://new:80"),
+				testHost("change.example.com", "http://new:80"),
+				testHost("keep.example.com", "http://keep:80"),
+			},
+			Changes{
+				Add:     []Host{testHost("new.example.com", "http://new:80")},
+				Replace: []Host{testHost("change.example.com", "http://new:80")},
+				Remove:  []Host{testHost("gone.example.com", "http://gone:80")},
+			},
+		},
+		{
+			"changed aliases",
+			[]Host{
+				withAliases(testHost("a.example.com", "http://a:80"), "www.example.com", "old.example.com"),
+				withAliases(testHost("b.example.com", "http://b:80"), "x.example.com", "y.example.com"),
+			},
+			[]Host{
+				withAliases(testHost("a.example.com", "http://a:80"), "www.example.com"),
+				withAliases(testHost("b.example.com", "http://b:80"), "y.example.com", "x.example.com"),
+			},
+			Changes{
+				Replace: []Host{withAliases(testHost("a.example.com", "http://a:80"), "www.example.com")},
+			},
+		},
+		{
+			"changed labels and annotations",
+			[]Host{
+				withLabels(testHost("a.example.com", "http://a:80"), map[string]string{"env": "preview"}),
+				testHost("b.example.com", "http://b:80"),
+				withLabels(testHost("c.example.com", "http://c:80"), map[string]string{}),
+			},
+			[]Host{
+				withLabels(testHost("a.example.com", "http://a:80"), map[string]string{"env": "prod"}),
+				{Name: "b.example.com", URI: Must(Parse("http://b:80")), Annotations: map[string]string{"git-sha": "abc"}},
+				testHost("c.example.com", "http://c:80"),
+			},
+			Changes{
+				Replace: []Host{
+					withLabels(testHost("a.example.com", "http://a:80"), map[string]string{"env": "prod"}),
+					{Name: "b.example.com", URI: Must(Parse("http://b:80")), Annotations: map[string]string{"git-sha": "abc"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(tt.current, tt.desired)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want.Empty(), got.Empty())
+		})
+	}
+}
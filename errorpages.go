@@ -0,0 +1,342 @@
+package vhoster
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	texttemplate "text/template"
+)
+
+// RequestIDHeader is the header that carries the request ID.  If the
+// incoming request does not have it, the gateway generates one and passes it
+// to the target server.
+const RequestIDHeader = "X-Request-Id"
+
+// ErrorData is the data available to the error page templates.
+type ErrorData struct {
+	Status     int    // HTTP status code, i.e. 404
+	StatusText string // HTTP status text, i.e. "Not Found"
+	Host       string // requested host name
+	RequestID  string // request ID
+	Message    string // short description of the error
+}
+
+// error page formats.
+const (
+	formatHTML = "html"
+	formatJSON = "json"
+)
+
+// defaultPage is the name of the template used for the statuses that do not
+// have their own template.
+const defaultPage = "default"
+
+// ErrorPages is the set of error page templates.  Templates are loaded from
+// the directory, where each file is named after the status code and the
+// format, i.e. "404.html" or "502.json", "default.html" and "default.json"
+// are used for the statuses without their own template.  Templates in the
+// subdirectory named after the virtual host, i.e. "test.example.com/404.html"
+// override the ones in the root for that host.  Missing templates fall back
+// to the built-in ones.
+//
+// HTML templates use html/template, JSON templates use text/template with
+// the "json" function, that encodes the value as JSON.  The templates are
+// executed with ErrorData.
+type ErrorPages struct {
+	// pages maps "host/name.format" (host is empty for the root) to the
+	// template.
+	pages map[string]errorTemplate
+}
+
+type errorTemplate interface {
+	Execute(io.Writer, any) error
+}
+
+var jsonFuncs = texttemplate.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+var builtinPages = map[string]errorTemplate{
+	defaultPage + "." + formatHTML: htmltemplate.Must(htmltemplate.New("").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Message}}</p>
+<hr>
+<p><small>{{.Host}}{{if .RequestID}} &middot; request ID {{.RequestID}}{{end}}</small></p>
+</body>
+</html>
+`)),
+	defaultPage + "." + formatJSON: texttemplate.Must(texttemplate.New("").Funcs(jsonFuncs).Parse(
+		`{"status":{{.Status}},"error":{{json .StatusText}},"message":{{json .Message}},"host":{{json .Host}},"request_id":{{json .RequestID}}}` + "\n",
+	)),
+}
+
+// LoadErrorPages loads the error page templates from the directory.
+func LoadErrorPages(dir string) (*ErrorPages, error) {
+	p := &ErrorPages{pages: make(map[string]errorTemplate)}
+	if err := p.loadDir(dir, ""); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			if err := p.loadDir(filepath.Join(dir, e.Name()), strings.ToLower(e.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, nil
+}
+
+// loadDir loads the templates from the directory for the host.
+func (p *ErrorPages) loadDir(dir string, host string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name, format, ok := parsePageName(e.Name())
+		if !ok {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var t errorTemplate
+		switch format {
+		case formatHTML:
+			t, err = htmltemplate.New(e.Name()).Parse(string(b))
+		case formatJSON:
+			t, err = texttemplate.New(e.Name()).Funcs(jsonFuncs).Parse(string(b))
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing error page %s: %w", path, err)
+		}
+		p.pages[host+"/"+name+"."+format] = t
+	}
+	return nil
+}
+
+// parsePageName parses the template file name, i.e. "404.html".
+func parsePageName(filename string) (name, format string, ok bool) {
+	ext := filepath.Ext(filename)
+	format = strings.TrimPrefix(ext, ".")
+	if format != formatHTML && format != formatJSON {
+		return "", "", false
+	}
+	name = strings.TrimSuffix(filename, ext)
+	if name == defaultPage {
+		return name, format, true
+	}
+	if code, err := strconv.Atoi(name); err != nil || code < 100 || code > 599 {
+		return "", "", false
+	}
+	return name, format, true
+}
+
+// Pages returns the names of the loaded templates, i.e. "404.html" or
+// "test.example.com/404.html", sorted.
+func (p *ErrorPages) Pages() []string {
+	names := make([]string, 0, len(p.pages))
+	for k := range p.pages {
+		names = append(names, strings.TrimPrefix(k, "/"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// template returns the most specific template for the host, status and
+// format.
+func (p *ErrorPages) template(host string, status int, format string) errorTemplate {
+	host = strings.ToLower(hostOnly(host))
+	code := strconv.Itoa(status)
+	for _, key := range []string{
+		host + "/" + code + "." + format,
+		host + "/" + defaultPage + "." + format,
+		"/" + code + "." + format,
+		"/" + defaultPage + "." + format,
+	} {
+		if t, ok := p.pages[key]; ok {
+			return t
+		}
+	}
+	return builtinPages[defaultPage+"."+format]
+}
+
+// Render renders the error page in the format, preferred by the accept
+// header value.  It returns the content type and the body.
+func (p *ErrorPages) Render(accept string, d ErrorData) (contentType string, body []byte) {
+	if d.StatusText == "" {
+		d.StatusText = http.StatusText(d.Status)
+	}
+	format, contentType := formatHTML, "text/html; charset=utf-8"
+	if prefersJSON(accept) {
+		format, contentType = formatJSON, "application/json"
+	}
+	var buf bytes.Buffer
+	if err := p.template(d.Host, d.Status, format).Execute(&buf, d); err != nil {
+		log.Printf("error rendering the error page for %s: %s", d.Host, err)
+		buf.Reset()
+		builtinPages[defaultPage+"."+format].Execute(&buf, d)
+	}
+	return contentType, buf.Bytes()
+}
+
+// messages are the descriptions of the errors, generated by the gateway.
+var messages = map[int]string{
+	http.StatusBadRequest:         "The request could not be understood.",
+	http.StatusNotFound:           "There is no site configured at this address.",
+	http.StatusBadGateway:         "The upstream server returned an invalid response.",
+	http.StatusServiceUnavailable: "The upstream server is not available.",
+	http.StatusGatewayTimeout:     "The upstream server did not respond in time.",
+}
+
+// render renders the error page for the request, sets the headers in h and
+// returns the body.  The request may be nil, if the request could not be
+// parsed.
+func (p *ErrorPages) render(h http.Header, r *http.Request, status int, msg string) []byte {
+	d := ErrorData{Status: status, Message: msg}
+	var accept string
+	if r != nil {
+		d.Host = r.Host
+		d.RequestID = ensureRequestID(r.Header)
+		accept = r.Header.Get("Accept")
+	} else {
+		d.RequestID = newRequestID()
+	}
+	if m, ok := messages[status]; ok {
+		d.Message = m
+	}
+	ct, body := p.Render(accept, d)
+	h.Set("Content-Type", ct)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set(RequestIDHeader, d.RequestID)
+	return body
+}
+
+// renderConn renders the error page for the connection, that was rejected
+// by the muxer.
+func (p *ErrorPages) renderConn(h http.Header, r *http.Request, status int, err error) []byte {
+	return p.render(h, r, status, err.Error())
+}
+
+// proxyErrorHandler returns the reverse proxy error handler, that responds
+// with 504 on timeouts, 503 if the upstream server refuses connections and
+// 502 on other upstream errors.
+func (p *ErrorPages) proxyErrorHandler(lg *log.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		lg.Printf("upstream error: %s", err)
+		status := upstreamStatus(err)
+		msg := err.Error()
+		var pe *PolicyError
+		if errors.As(err, &pe) {
+			msg = pe.Error()
+		}
+		body := p.render(w.Header(), r, status, msg)
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+}
+
+// upstreamStatus returns the status code for the upstream error.
+func upstreamStatus(err error) int {
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrTargetDenied):
+		return http.StatusForbidden
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// prefersJSON returns true if the accept header value prefers JSON to HTML.
+func prefersJSON(accept string) bool {
+	var qHTML, qJSON float64 = -1, -1
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		switch mt {
+		case "application/json":
+			qJSON = maxf(qJSON, q)
+		case "text/html":
+			qHTML = maxf(qHTML, q)
+		}
+	}
+	return qJSON > 0 && qJSON > qHTML
+}
+
+func maxf(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// hostOnly strips the port from the host.
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// newRequestID returns the random request ID.
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// ensureRequestID sets the request ID header, if it's missing, and returns
+// it.
+func ensureRequestID(h http.Header) string {
+	id := h.Get(RequestIDHeader)
+	if id == "" {
+		id = newRequestID()
+		h.Set(RequestIDHeader, id)
+	}
+	return id
+}
@@ -0,0 +1,166 @@
+package vhoster
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePages creates the error pages directory with the files.
+func writePages(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestLoadErrorPages(t *testing.T) {
+	t.Run("loads the pages and the host overrides", func(t *testing.T) {
+		dir := writePages(t, map[string]string{
+			"404.html":                      "root 404 {{.Host}}",
+			"default.json":                  `{"code":{{.Status}}}`,
+			"Test.Example.com/404.html":     "host 404 {{.Host}}",
+			"test.example.com/default.html": "host default {{.Status}}",
+			"README.md":                     "ignored",
+			"999.html":                      "ignored",
+		})
+		p, err := LoadErrorPages(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"404.html",
+			"default.json",
+			"test.example.com/404.html",
+			"test.example.com/default.html",
+		}, p.Pages())
+
+		tests := []struct {
+			name   string
+			accept string
+			d      ErrorData
+			wantCT string
+			want   string
+		}{
+			{"root status page", "", ErrorData{Status: 404, Host: "other.example.com"}, "text/html; charset=utf-8", "root 404 other.example.com"},
+			{"host status page", "text/html", ErrorData{Status: 404, Host: "test.example.com:8080"}, "text/html; charset=utf-8", "host 404 test.example.com:8080"},
+			{"host default page", "", ErrorData{Status: 502, Host: "TEST.example.com"}, "text/html; charset=utf-8", "host default 502"},
+			{"root default json", "application/json", ErrorData{Status: 502, Host: "test.example.com"}, "application/json", `{"code":502}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ct, body := p.Render(tt.accept, tt.d)
+				assert.Equal(t, tt.wantCT, ct)
+				assert.Equal(t, tt.want, string(body))
+			})
+		}
+	})
+	t.Run("invalid template", func(t *testing.T) {
+		dir := writePages(t, map[string]string{"404.html": "{{.Host"})
+		_, err := LoadErrorPages(dir)
+		assert.ErrorContains(t, err, "404.html")
+	})
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := LoadErrorPages(filepath.Join(t.TempDir(), "missing"))
+		assert.Error(t, err)
+	})
+}
+
+func TestErrorPages_Render_builtin(t *testing.T) {
+	p := &ErrorPages{}
+	ct, body := p.Render("application/json", ErrorData{Status: 503, Host: "a.example.com", RequestID: "42", Message: `"quoted"`})
+	assert.Equal(t, "application/json", ct)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, map[string]any{
+		"status":     float64(503),
+		"error":      "Service Unavailable",
+		"message":    `"quoted"`,
+		"host":       "a.example.com",
+		"request_id": "42",
+	}, got)
+
+	_, body = p.Render("", ErrorData{Status: 404, Host: "<script>"})
+	assert.Contains(t, string(body), "404 Not Found")
+	assert.Contains(t, string(body), "&lt;script&gt;")
+}
+
+func Test_prefersJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", true},
+		{"text/html,application/json", false},
+		{"text/html;q=0.5, application/json", true},
+		{"application/json;q=0, text/plain", false},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, prefersJSON(tt.accept), tt.accept)
+	}
+}
+
+func TestGateway_errorPages(t *testing.T) {
+	dir := writePages(t, map[string]string{
+		"404.html":                  "not found: {{.Host}} {{.RequestID}}",
+		"down.example.com/503.json": `{"status":{{.Status}},"id":{{json .RequestID}}}`,
+	})
+	pages, err := LoadErrorPages(dir)
+	require.NoError(t, err)
+
+	// a closed port for the target, that is down.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	downURL := "http://" + l.Addr().String()
+	l.Close()
+
+	g, err := Listen("127.0.0.1:0", WithErrorPages(pages), WithHosts([]Host{testHost("down.example.com", downURL)}))
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+
+	t.Run("unknown host", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "http://"+g.ln.Addr().String()+"/", nil)
+		require.NoError(t, err)
+		req.Host = "unknown.example.com"
+		req.Header.Set(RequestIDHeader, "req-1")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "req-1", resp.Header.Get(RequestIDHeader))
+		assert.Equal(t, "not found: unknown.example.com req-1", string(body))
+	})
+	t.Run("target is down", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "http://"+g.ln.Addr().String()+"/", nil)
+		require.NoError(t, err)
+		req.Host = "down.example.com"
+		req.Header.Set("Accept", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var got struct {
+			Status int    `json:"status"`
+			ID     string `json:"id"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, http.StatusServiceUnavailable, got.Status)
+		assert.NotEmpty(t, got.ID, "request ID is generated")
+		assert.Equal(t, got.ID, resp.Header.Get(RequestIDHeader))
+	})
+}
@@ -0,0 +1,101 @@
+package vhoster
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned by Watch and the changes of the route table, when the
+// gateway is shut down.
+var ErrClosed = errors.New("gateway is closed")
+
+// watchBuffer is the number of revisions buffered for the watcher.  The
+// watcher, that falls further behind, is dropped.
+const watchBuffer = 256
+
+// watchers is the set of subscribers to the changes of the route table.  It
+// is protected by the gateway mutex.
+type watchers map[chan Revision]struct{}
+
+// publish sends the revision to all watchers.  The watchers, that can't
+// keep up, are dropped by closing their channels.
+func (w watchers) publish(r Revision) {
+	for ch := range w {
+		select {
+		case ch <- r:
+		default:
+			delete(w, ch)
+			close(ch)
+		}
+	}
+}
+
+// closeAll drops all watchers.
+func (w watchers) closeAll() {
+	for ch := range w {
+		delete(w, ch)
+		close(ch)
+	}
+}
+
+// Revision returns the number of the last revision of the route table.  If
+// there were no changes, it is the starting number, see Revision.ID.
+func (g *Gateway) Revision() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.hist.last
+}
+
+// Watch returns the channel, that receives the changes of the route table
+// made after the revision since, starting with the ones still in the
+// history.  Pass the result of Revision to receive only the new changes.
+//
+// The channel is closed, when the context is done, the gateway is shut down,
+// or the receiver falls behind by more than 256 revisions.  The receiver can
+// resume with another Watch from the last received revision.  If the
+// revisions after since are no longer in the history, ErrRevisionNotFound is
+// returned, and the receiver should List the hosts again.
+func (g *Gateway) Watch(ctx context.Context, since int64) (<-chan Revision, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.done:
+		return nil, ErrClosed
+	default:
+	}
+	revs, err := g.hist.since(since)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Revision, len(revs)+watchBuffer)
+	for _, r := range revs {
+		ch <- r
+	}
+	if g.watchers == nil {
+		g.watchers = make(watchers)
+	}
+	g.watchers[ch] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-g.done:
+			return // closed by Shutdown
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if _, ok := g.watchers[ch]; ok {
+			delete(g.watchers, ch)
+			close(ch)
+		}
+	}()
+	return ch, nil
+}
+
+// commit records the revision in the history and publishes it to the
+// watchers.  The caller should take care of locking the mutex.
+func (g *Gateway) commit(r Revision) Revision {
+	r = g.hist.record(r)
+	g.watchers.publish(r)
+	return r
+}
@@ -0,0 +1,134 @@
+package vhoster
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextRevision returns the next revision from the channel, failing the test
+// on timeout.
+func nextRevision(t *testing.T, ch <-chan Revision) Revision {
+	t.Helper()
+	select {
+	case r, ok := <-ch:
+		require.True(t, ok, "channel closed")
+		return r
+	case <-time.After(time.Second):
+		require.Fail(t, "timeout waiting for the revision")
+	}
+	return Revision{}
+}
+
+// waitClosed fails the test, if the channel is not closed in time.
+func waitClosed(t *testing.T, ch <-chan Revision) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			require.Fail(t, "channel is not closed")
+		}
+	}
+}
+
+func TestGateway_Watch(t *testing.T) {
+	u, _ := url.Parse("http://localhost:8082")
+
+	t.Run("publishes changes", func(t *testing.T) {
+		g := testGateway(t)
+		base := g.Revision()
+		ch, err := g.Watch(context.Background(), base)
+		require.NoError(t, err)
+
+		require.NoError(t, g.Add("a.example.com", u))
+		require.NoError(t, g.Replace("a.example.com", u))
+		require.NoError(t, g.Apply(Op{Action: ActionAdd, Host: withExpiry(testHost("b.example.com", "http://b:80"), time.Now().Add(-time.Second))}))
+		require.NoError(t, g.Remove("a.example.com"))
+		g.reap(time.Now())
+
+		for i, want := range []Action{ActionAdd, ActionReplace, ActionAdd, ActionRemove, ActionExpire} {
+			r := nextRevision(t, ch)
+			assert.Equal(t, want, r.Action)
+			assert.Equal(t, base+int64(i+1), r.ID)
+		}
+		assert.Equal(t, base+5, g.Revision())
+	})
+	t.Run("resumes from the revision", func(t *testing.T) {
+		g := testGateway(t)
+		base := g.Revision()
+		require.NoError(t, g.Add("a.example.com", u))
+		require.NoError(t, g.Add("b.example.com", u))
+
+		ch, err := g.Watch(context.Background(), base+1)
+		require.NoError(t, err)
+		require.NoError(t, g.Add("c.example.com", u))
+		assert.Equal(t, "b.example.com", nextRevision(t, ch).Host.Name)
+		assert.Equal(t, "c.example.com", nextRevision(t, ch).Host.Name)
+
+		_, err = g.Watch(context.Background(), base+10)
+		assert.ErrorIs(t, err, ErrRevisionNotFound)
+	})
+	t.Run("revisions of another process", func(t *testing.T) {
+		old := testGateway(t)
+		require.NoError(t, old.Add("a.example.com", u))
+		last := old.Revision()
+
+		g := testGateway(t)
+		assert.Greater(t, g.Revision(), last, "numbering starts past the previous process")
+		require.NoError(t, g.Add("b.example.com", u))
+		_, err := g.Watch(context.Background(), last)
+		assert.ErrorIs(t, err, ErrRevisionNotFound, "revisions of another process are not resumed")
+	})
+	t.Run("evicted revisions", func(t *testing.T) {
+		g, err := Listen("127.0.0.1:0", WithHistory(1))
+		require.NoError(t, err)
+		t.Cleanup(func() { g.Close() })
+		base := g.Revision()
+		require.NoError(t, g.Add("a.example.com", u))
+		require.NoError(t, g.Add("b.example.com", u))
+
+		_, err = g.Watch(context.Background(), base)
+		assert.ErrorIs(t, err, ErrRevisionNotFound)
+	})
+	t.Run("context cancelled", func(t *testing.T) {
+		g := testGateway(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := g.Watch(ctx, g.Revision())
+		require.NoError(t, err)
+		cancel()
+		waitClosed(t, ch)
+		require.NoError(t, g.Add("a.example.com", u), "publishing after the watcher is gone")
+	})
+	t.Run("slow watcher is dropped", func(t *testing.T) {
+		g := testGateway(t)
+		slow, err := g.Watch(context.Background(), g.Revision())
+		require.NoError(t, err)
+		for i := 0; i <= watchBuffer; i++ {
+			require.NoError(t, g.Apply(Op{Action: ActionReplace, Host: testHost("a.example.com", "http://a:80")}))
+		}
+		var n int
+		for range slow {
+			n++
+		}
+		assert.Equal(t, watchBuffer, n)
+	})
+	t.Run("shutdown", func(t *testing.T) {
+		g, err := Listen("127.0.0.1:0")
+		require.NoError(t, err)
+		ch, err := g.Watch(context.Background(), g.Revision())
+		require.NoError(t, err)
+		require.NoError(t, g.Close())
+		waitClosed(t, ch)
+		_, err = g.Watch(context.Background(), 0)
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
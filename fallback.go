@@ -0,0 +1,209 @@
+package vhoster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// ForwardedHostHeader is the header that carries the originally requested
+// host name to the fallback target.
+const ForwardedHostHeader = "X-Forwarded-Host"
+
+// WithFallback sets the fallback target, that receives the requests for the
+// unknown hosts.
+func WithFallback(u *URI) Option {
+	return func(o *options) {
+		o.fallback = u
+	}
+}
+
+// SetFallback sets the target that receives the requests for the hosts that
+// are not registered, instead of responding with 404.  The requested host is
+// passed to the target in the ForwardedHostHeader.  If uri is nil, the
+// fallback is removed.
+func (g *Gateway) SetFallback(uri *url.URL) error {
+	if uri == nil {
+		g.fb.set(nil)
+		log.Print("fallback target removed")
+		return nil
+	}
+	if err := validateFallback(uri); err != nil {
+		return err
+	}
+	g.fb.set(ToURI(uri))
+	log.Printf("fallback target set to %s", uri)
+	return nil
+}
+
+// Fallback returns the fallback target or nil, if it's not set.
+func (g *Gateway) Fallback() *URI {
+	t := g.fb.target.Load()
+	if t == nil {
+		return nil
+	}
+	return t.uri
+}
+
+func validateFallback(uri *url.URL) error {
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return fmt.Errorf("unsupported fallback scheme %q, must be http or https", uri.Scheme)
+	}
+	if uri.Host == "" {
+		return errors.New("fallback URI has no host")
+	}
+	return nil
+}
+
+// fallback serves the connections for the unknown hosts.
+type fallback struct {
+	target    atomic.Pointer[fallbackTarget]
+	pages     *ErrorPages       // optional error pages
+	transport http.RoundTripper // optional transport, that enforces the target policy
+	l         *connListener
+	srv       *http.Server
+	wg        sync.WaitGroup
+}
+
+type fallbackTarget struct {
+	uri     *URI
+	handler http.Handler
+}
+
+// newFallback starts the fallback server.  The server is idle until the
+// target is set.
+func newFallback(addr net.Addr, pages *ErrorPages, transport http.RoundTripper) *fallback {
+	f := &fallback{
+		pages:     pages,
+		transport: transport,
+		l:         newConnListener(addr),
+	}
+	f.srv = &http.Server{Handler: http.HandlerFunc(f.serveHTTP)}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if err := f.srv.Serve(f.l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("fallback: error: %v", err)
+		}
+	}()
+	return f
+}
+
+func (f *fallback) set(uri *URI) {
+	if uri == nil {
+		f.target.Store(nil)
+		return
+	}
+	lg := log.New(log.Default().Writer(), "fallback: ", log.Default().Flags())
+	target := uri.URL()
+	rp := httputil.NewSingleHostReverseProxy(target)
+	director := rp.Director
+	rp.Director = func(r *http.Request) {
+		host := r.Host
+		director(r)
+		r.Host = target.Host
+		r.Header.Set(ForwardedHostHeader, host)
+	}
+	if f.transport != nil {
+		rp.Transport = f.transport
+		rp.ErrorHandler = policyErrorHandler(lg)
+	}
+	if f.pages != nil {
+		rp.ErrorHandler = f.pages.proxyErrorHandler(lg)
+	}
+	f.target.Store(&fallbackTarget{uri: uri, handler: rp})
+}
+
+// serve passes the connection to the fallback server.  It returns false if
+// the fallback target is not set.
+func (f *fallback) serve(conn net.Conn) bool {
+	if f.target.Load() == nil {
+		return false
+	}
+	return f.l.push(conn)
+}
+
+func (f *fallback) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	t := f.target.Load()
+	if t != nil {
+		if f.pages != nil {
+			ensureRequestID(r.Header)
+		}
+		t.handler.ServeHTTP(w, r)
+		return
+	}
+	// the fallback was removed while the connection was open.
+	if f.pages != nil {
+		body := f.pages.render(w.Header(), r, http.StatusNotFound, ErrNotFound.Error())
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(body)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	io.WriteString(w, ErrNotFound.Error())
+}
+
+// Shutdown gracefully shuts down the fallback server.
+func (f *fallback) Shutdown(ctx context.Context) error {
+	err := f.srv.Shutdown(ctx)
+	if err != nil {
+		f.srv.Close()
+	}
+	f.l.Close()
+	f.wg.Wait()
+	return err
+}
+
+// connListener is the listener that accepts the connections pushed to it.
+type connListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// push passes the connection to Accept, it returns false if the listener is
+// closed.
+func (l *connListener) push(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,64 @@
+package vhoster
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGateway_SetFallback(t *testing.T) {
+	var gotHost, gotForwarded string
+	landing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost, gotForwarded = r.Host, r.Header.Get(ForwardedHostHeader)
+		io.WriteString(w, "claim this subdomain")
+	}))
+	t.Cleanup(landing.Close)
+
+	g, err := Listen("127.0.0.1:0", WithFallback(Must(Parse(landing.URL))))
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+	assert.Equal(t, landing.URL, g.Fallback().String())
+
+	t.Run("unknown host goes to the fallback", func(t *testing.T) {
+		resp, err := get(g, "unknown.example.com")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "claim this subdomain", string(body))
+		assert.Equal(t, "unknown.example.com", gotForwarded)
+		assert.Equal(t, landing.Listener.Addr().String(), gotHost)
+	})
+	t.Run("registered host is not affected", func(t *testing.T) {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "backend")
+		}))
+		t.Cleanup(backend.Close)
+		require.NoError(t, g.Add("known.example.com", Must(Parse(backend.URL)).URL()))
+
+		resp, err := get(g, "known.example.com")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "backend", string(body))
+	})
+	t.Run("removed fallback", func(t *testing.T) {
+		require.NoError(t, g.SetFallback(nil))
+		assert.Nil(t, g.Fallback())
+		resp, err := get(g, "unknown.example.com")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	t.Run("invalid target", func(t *testing.T) {
+		assert.Error(t, g.SetFallback(Must(Parse("ftp://example.com")).URL()))
+		assert.Error(t, g.SetFallback(Must(Parse("http:///path")).URL()))
+		assert.Nil(t, g.Fallback())
+	})
+}
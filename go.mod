@@ -3,14 +3,19 @@ module github.com/rusq/vhoster
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/golang/mock v1.6.0
 	github.com/inconshreveable/go-vhost v1.0.0
 	github.com/rusq/osenv/v2 v2.0.1
 	github.com/stretchr/testify v1.8.4
+	go.etcd.io/bbolt v1.3.9
+	golang.org/x/net v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
 )
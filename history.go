@@ -0,0 +1,174 @@
+package vhoster
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultHistorySize is the default number of revisions kept in the history.
+const DefaultHistorySize = 100
+
+// ErrRevisionNotFound is returned when the revision is not in the history.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is a single change of the route table.
+type Revision struct {
+	// ID is the revision number, it increases with every change.  The numbers
+	// start from the start time of the gateway in microseconds.
+	ID int64 `json:"revision"`
+	// Time is the time of the change.
+	Time time.Time `json:"time"`
+	// Actor is the identity of the one who made the change.
+	Actor string `json:"actor,omitempty"`
+	// Action is the type of the change.
+	Action Action `json:"action"`
+	// Host is the host after the change, for ActionRemove and ActionExpire
+	// only the Name is set.
+	Host Host `json:"host"`
+	// Previous is the host before the change, it is nil if the host did not
+	// exist.
+	Previous *Host `json:"previous,omitempty"`
+}
+
+// inverse returns the operation that reverts the revision at now.
+func (r Revision) inverse(actor string, now time.Time) Op {
+	if r.Previous == nil {
+		return Op{Action: ActionRemove, Host: Host{Name: r.Host.Name}, Actor: actor}
+	}
+	if r.Action == ActionRemove || r.Action == ActionExpire {
+		return Op{Action: ActionAdd, Host: r.restored(now, nil), Actor: actor}
+	}
+	return Op{Action: ActionReplace, Host: r.restored(now, r.Host.Expires), Actor: actor}
+}
+
+// restored returns the previous host to restore at now.  The expiry time,
+// that has already passed, is never restored, otherwise the reaper would
+// remove the host right away: the host with the lease gets the lease interval
+// from now to renew it, others keep the current expiry time, if it is still
+// ahead, or get none.
+func (r Revision) restored(now time.Time, current *time.Time) Host {
+	h := *r.Previous
+	if !h.Expired(now) {
+		return h
+	}
+	switch {
+	case h.Lease != nil:
+		expires := now.Add(h.Lease.Interval).UTC()
+		h.Expires = &expires
+	case current != nil && now.Before(*current):
+		h.Expires = current
+	default:
+		h.Expires = nil
+	}
+	return h
+}
+
+// history is a bounded history of the route table revisions.
+type history struct {
+	max  int        // maximum number of revisions to keep
+	last int64      // last revision number
+	revs []Revision // revisions in order, the oldest first
+}
+
+// newHistory returns the history, that keeps max revisions.  The revisions are
+// numbered from the start time in microseconds, so that the numbers given out
+// by another process, i.e. before a restart or an upgrade, are below the
+// current ones, and are reported as not found, instead of being mistaken for
+// the revisions of this one.
+func newHistory(max int, start time.Time) history {
+	return history{max: max, last: start.UnixMicro()}
+}
+
+// record assigns the next revision number to r and adds it to the history,
+// evicting the oldest revisions if necessary.
+func (h *history) record(r Revision) Revision {
+	h.last++
+	r.ID = h.last
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	if h.max <= 0 {
+		return r
+	}
+	h.revs = append(h.revs, r)
+	if over := len(h.revs) - h.max; over > 0 {
+		h.revs = append(h.revs[:0:0], h.revs[over:]...)
+	}
+	return r
+}
+
+// list returns a copy of all revisions in the history.
+func (h *history) list() []Revision {
+	return append([]Revision(nil), h.revs...)
+}
+
+// since returns the revisions made after the revision id.  It returns
+// ErrRevisionNotFound if id is unknown, or if some of the revisions after it
+// were evicted from the history.
+func (h *history) since(id int64) ([]Revision, error) {
+	if id < 0 || id > h.last {
+		return nil, ErrRevisionNotFound
+	}
+	if id == h.last {
+		return nil, nil
+	}
+	if len(h.revs) == 0 || h.revs[0].ID > id+1 {
+		return nil, ErrRevisionNotFound
+	}
+	return append([]Revision(nil), h.revs[id+1-h.revs[0].ID:]...), nil
+}
+
+// WithHistory sets the number of route table revisions kept in the history,
+// zero disables the history.
+func WithHistory(n int) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.historySize = n
+		}
+	}
+}
+
+// History returns the recorded revisions of the route table, the oldest
+// first.
+func (g *Gateway) History() []Revision {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.hist.list()
+}
+
+// Rollback restores the route table to the state it had at the revision id,
+// by reverting all changes made after it, all or nothing.  The reverting
+// changes are recorded as new revisions attributed to actor, and returned.
+// Rolling back to the current revision is a no-op.
+func (g *Gateway) Rollback(id int64, actor string) ([]Revision, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	revs, err := g.hist.since(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	ops := make([]Op, 0, len(revs))
+	for i := len(revs) - 1; i >= 0; i-- {
+		ops = append(ops, revs[i].inverse(actor, now))
+	}
+	return g.applyOps(ops)
+}
+
+// record records the change in the history and publishes it to the
+// watchers.  The caller should take care of locking the mutex.
+func (g *Gateway) record(actor string, action Action, h Host, prev *Host) Revision {
+	return g.commit(Revision{Actor: actor, Action: action, Host: h, Previous: prev})
+}
+
+// lookup returns the copy of the registered host or nil if it does not exist.
+// The caller should take care of locking the mutex.
+func (g *Gateway) lookup(name string) *Host {
+	pw, ok := g.pws[name]
+	if !ok {
+		return nil
+	}
+	h := pw.vhost
+	return &h
+}
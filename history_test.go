@@ -0,0 +1,124 @@
+package vhoster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_history(t *testing.T) {
+	h := history{max: 3}
+	for i := 0; i < 5; i++ {
+		h.record(Revision{Action: ActionAdd, Host: Host{Name: "a"}})
+	}
+	revs := h.list()
+	require.Len(t, revs, 3)
+	assert.Equal(t, []int64{3, 4, 5}, []int64{revs[0].ID, revs[1].ID, revs[2].ID})
+
+	tests := []struct {
+		name    string
+		id      int64
+		wantIDs []int64
+		wantErr error
+	}{
+		{"current", 5, nil, nil},
+		{"last two", 3, []int64{4, 5}, nil},
+		{"oldest kept", 2, []int64{3, 4, 5}, nil},
+		{"evicted", 1, nil, ErrRevisionNotFound},
+		{"future", 6, nil, ErrRevisionNotFound},
+		{"negative", -1, nil, ErrRevisionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.since(tt.id)
+			assert.ErrorIs(t, err, tt.wantErr)
+			var ids []int64
+			for _, r := range got {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestGateway_Rollback(t *testing.T) {
+	g := testGateway(t, testHost("a.example.com", "http://a:80"))
+	base := g.History()
+	require.Len(t, base, 1)
+	baseRev := base[0].ID
+
+	require.NoError(t, g.Replace("a.example.com", Must(Parse("http://aa:80")).URL()))
+	require.NoError(t, g.Apply(
+		Op{Action: ActionAdd, Host: testHost("b.example.com", "http://b:80"), Actor: "alice"},
+		Op{Action: ActionRemove, Host: Host{Name: "a.example.com"}, Actor: "alice"},
+	))
+	require.NoError(t, g.Add("c.example.com", Must(Parse("http://c:80")).URL()))
+
+	hist := g.History()
+	require.Len(t, hist, 5)
+	assert.Equal(t, "alice", hist[3].Actor)
+	assert.Equal(t, ActionRemove, hist[3].Action)
+	require.NotNil(t, hist[3].Previous)
+	assert.Equal(t, testHost("a.example.com", "http://aa:80"), *hist[3].Previous)
+
+	revs, err := g.Rollback(baseRev, "bob")
+	require.NoError(t, err)
+	assert.Len(t, revs, 4)
+	for _, r := range revs {
+		assert.Equal(t, "bob", r.Actor)
+	}
+	assert.Equal(t, []Host{testHost("a.example.com", "http://a:80")}, g.List())
+
+	// rolling back to the current revision is a no-op.
+	revs, err = g.Rollback(g.History()[len(g.History())-1].ID, "bob")
+	require.NoError(t, err)
+	assert.Empty(t, revs)
+
+	_, err = g.Rollback(1000, "bob")
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+}
+
+func TestWithHistory(t *testing.T) {
+	g, err := Listen("127.0.0.1:0", WithHistory(0), WithHosts([]Host{testHost("a.example.com", "http://a:80")}))
+	require.NoError(t, err)
+	defer g.Close()
+	assert.Empty(t, g.History())
+	_, err = g.Rollback(0, "")
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+}
+
+func TestRevision_inverse(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	past, future, later := now.Add(-time.Minute), now.Add(time.Hour), now.Add(2*time.Hour)
+	host := testHost("a.example.com", "http://a:80")
+	leased := withExpiry(host, past)
+	leased.Lease = &Lease{ID: "abc", Interval: 30 * time.Second}
+
+	tests := []struct {
+		name        string
+		rev         Revision
+		wantAction  Action
+		wantExpires *time.Time
+	}{
+		{"expiry ahead is restored", Revision{Action: ActionReplace, Host: withExpiry(host, later), Previous: ptr(withExpiry(host, future))}, ActionReplace, &future},
+		{"passed expiry keeps the current one", Revision{Action: ActionReplace, Host: withExpiry(host, future), Previous: ptr(withExpiry(host, past))}, ActionReplace, &future},
+		{"passed expiry without the current one", Revision{Action: ActionReplace, Host: host, Previous: ptr(withExpiry(host, past))}, ActionReplace, nil},
+		{"expired host is restored without expiry", Revision{Action: ActionExpire, Host: Host{Name: host.Name}, Previous: ptr(withExpiry(host, past))}, ActionAdd, nil},
+		{"leased host gets the lease interval", Revision{Action: ActionExpire, Host: Host{Name: host.Name}, Previous: &leased}, ActionAdd, ptr(now.Add(30 * time.Second))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := tt.rev.inverse("alice", now)
+			assert.Equal(t, tt.wantAction, op.Action)
+			assert.Equal(t, tt.wantExpires, op.Host.Expires)
+			assert.False(t, op.Host.Expired(now), "restored host must not expire right away")
+		})
+	}
+	assert.Equal(t, &past, leased.Expires, "the revision is not modified")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
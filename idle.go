@@ -0,0 +1,82 @@
+package vhoster
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// IdleAction is what the gateway does with the hosts, that haven't received
+// requests for the idle timeout.
+type IdleAction string
+
+const (
+	IdleMark   IdleAction = "mark"   // mark the host as dormant in the list
+	IdleRemove IdleAction = "remove" // remove the host
+)
+
+// Validate checks that the action is known.
+func (a IdleAction) Validate() error {
+	switch a {
+	case IdleMark, IdleRemove:
+		return nil
+	}
+	return fmt.Errorf("unknown idle action %q, must be %q or %q", a, IdleMark, IdleRemove)
+}
+
+// WithIdleTimeout enables the handling of the hosts, that haven't received
+// requests for the timeout d: they are either marked as dormant, or removed,
+// depending on the action.  Pinned hosts are never idle.
+func WithIdleTimeout(d time.Duration, action IdleAction) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.idleTimeout = d
+			o.idleAction = action
+		}
+	}
+}
+
+// activity tracks the requests to the host.
+type activity struct {
+	since time.Time    // the time the host was registered
+	seen  atomic.Int64 // unix time of the last request in nanoseconds, 0 if none
+}
+
+func newActivity() *activity {
+	return &activity{since: time.Now()}
+}
+
+// track wraps the handler and records the time of every request.
+func (a *activity) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.seen.Store(time.Now().UnixNano())
+		h.ServeHTTP(w, r)
+	})
+}
+
+// lastSeen returns the time of the last request, or nil if there were none.
+func (a *activity) lastSeen() *time.Time {
+	ns := a.seen.Load()
+	if ns == 0 {
+		return nil
+	}
+	t := time.Unix(0, ns).UTC()
+	return &t
+}
+
+// idle returns true if there were no requests for d by now, counting from
+// the registration of the host.
+func (a *activity) idle(now time.Time, d time.Duration) bool {
+	last := a.since
+	if t := a.lastSeen(); t != nil {
+		last = *t
+	}
+	return now.Sub(last) >= d
+}
+
+// isIdle returns true if the host is not pinned and idle by now.  The caller
+// should take care of locking the mutex.
+func (g *Gateway) isIdle(pw proxyWrapper, now time.Time) bool {
+	return g.idleTimeout > 0 && !pw.vhost.Pinned && pw.act.idle(now, g.idleTimeout)
+}
@@ -0,0 +1,85 @@
+package vhoster
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hostByName returns the host from the list or fails the test.
+func hostByName(t *testing.T, hosts []Host, name string) Host {
+	t.Helper()
+	for _, h := range hosts {
+		if h.Name == name {
+			return h
+		}
+	}
+	t.Fatalf("host %q is not in the list", name)
+	return Host{}
+}
+
+func TestGateway_idleMark(t *testing.T) {
+	srv := backend(t, "ok")
+	pinned := testHost("static.example.com", srv.URL)
+	pinned.Pinned = true
+	g, err := Listen("127.0.0.1:0", WithHosts([]Host{pinned}), WithIdleTimeout(50*time.Millisecond, IdleMark))
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+	require.NoError(t, g.Add("busy.example.com", Must(Parse(srv.URL)).URL()))
+	require.NoError(t, g.Add("quiet.example.com", Must(Parse(srv.URL)).URL()))
+
+	hosts := g.List()
+	assert.Nil(t, hostByName(t, hosts, "busy.example.com").LastSeen)
+	assert.False(t, hostByName(t, hosts, "quiet.example.com").Dormant)
+
+	time.Sleep(60 * time.Millisecond)
+	before := time.Now()
+	code, _ := getBody(t, g, "busy.example.com")
+	require.Equal(t, http.StatusOK, code)
+
+	hosts = g.List()
+	busy := hostByName(t, hosts, "busy.example.com")
+	require.NotNil(t, busy.LastSeen)
+	assert.WithinDuration(t, before, *busy.LastSeen, time.Second)
+	assert.False(t, busy.Dormant)
+	assert.True(t, hostByName(t, hosts, "quiet.example.com").Dormant)
+	assert.False(t, hostByName(t, hosts, "static.example.com").Dormant, "pinned hosts are never dormant")
+
+	assert.Empty(t, g.reap(time.Now()), "dormant hosts are not removed")
+
+	t.Run("replace keeps the last seen time", func(t *testing.T) {
+		require.NoError(t, g.Replace("busy.example.com", Must(Parse(srv.URL)).URL()))
+		assert.Equal(t, busy.LastSeen, hostByName(t, g.List(), "busy.example.com").LastSeen)
+	})
+}
+
+func TestGateway_idleRemove(t *testing.T) {
+	pinned := testHost("static.example.com", "http://a:80")
+	pinned.Pinned = true
+	g, err := Listen("127.0.0.1:0", WithHosts([]Host{pinned}), WithIdleTimeout(time.Hour, IdleRemove))
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+	require.NoError(t, g.Add("quiet.example.com", Must(Parse("http://b:80")).URL()))
+
+	assert.Empty(t, g.reap(time.Now()))
+	assert.Equal(t, []string{"quiet.example.com"}, g.reap(time.Now().Add(2*time.Hour)))
+	assert.True(t, g.Exists("static.example.com"))
+
+	hist := g.History()
+	assert.Equal(t, ActionExpire, hist[len(hist)-1].Action)
+
+	t.Run("replaced config host stays pinned", func(t *testing.T) {
+		require.NoError(t, g.Replace("static.example.com", Must(Parse("http://c:80")).URL()))
+		assert.True(t, hostByName(t, g.List(), "static.example.com").Pinned)
+		assert.Empty(t, g.reap(time.Now().Add(2*time.Hour)))
+		assert.True(t, g.Exists("static.example.com"))
+	})
+}
+
+func TestWithIdleTimeout_invalid(t *testing.T) {
+	_, err := Listen("127.0.0.1:0", WithIdleTimeout(time.Hour, "sleep"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,228 @@
+package vhoster
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidSelector is returned when the label selector can't be parsed.
+var ErrInvalidSelector = errors.New("invalid selector")
+
+var (
+	// reLabelKey matches the label and annotation keys, i.e. "team" or
+	// "example.com/git-sha".
+	reLabelKey = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	// reLabelValue matches the label values, that may be empty.
+	reLabelValue = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+)
+
+const (
+	maxLabelKeyLen   = 253
+	maxLabelValueLen = 63
+)
+
+// ValidateLabels checks that the label keys and values are valid.  Keys
+// consist of letters, digits, ".", "_", "-" and "/", values are at most 63
+// characters long and can't contain "/", so that they can be used in the
+// selectors.
+func ValidateLabels(labels map[string]string) error {
+	for _, k := range sortedKeys(labels) {
+		if err := validateKey(k); err != nil {
+			return fmt.Errorf("label %w", err)
+		}
+		v := labels[k]
+		if len(v) > maxLabelValueLen || !reLabelValue.MatchString(v) {
+			return fmt.Errorf("label %q: invalid value %q, must be at most %d letters, digits, \".\", \"_\" and \"-\"", k, v, maxLabelValueLen)
+		}
+	}
+	return nil
+}
+
+// ValidateAnnotations checks that the annotation keys are valid, the values
+// are free-form.
+func ValidateAnnotations(annotations map[string]string) error {
+	for _, k := range sortedKeys(annotations) {
+		if err := validateKey(k); err != nil {
+			return fmt.Errorf("annotation %w", err)
+		}
+	}
+	return nil
+}
+
+func validateKey(k string) error {
+	if len(k) > maxLabelKeyLen || !reLabelKey.MatchString(k) {
+		return fmt.Errorf("key %q is invalid, must be 1 to %d letters, digits, \".\", \"_\", \"-\" and \"/\"", k, maxLabelKeyLen)
+	}
+	return nil
+}
+
+// selectorOp is the operator of the selector requirement.
+type selectorOp int
+
+const (
+	opEquals selectorOp = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+// requirement is a single requirement of the selector, i.e. "env=preview".
+type requirement struct {
+	key   string
+	op    selectorOp
+	value string
+}
+
+func (r requirement) String() string {
+	switch r.op {
+	case opNotEquals:
+		return r.key + "!=" + r.value
+	case opExists:
+		return r.key
+	case opNotExists:
+		return "!" + r.key
+	default:
+		return r.key + "=" + r.value
+	}
+}
+
+// matches returns true if the labels satisfy the requirement.
+func (r requirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+	switch r.op {
+	case opNotEquals:
+		return !ok || v != r.value
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	default:
+		return ok && v == r.value
+	}
+}
+
+// Selector selects the hosts by their labels.  All requirements must be
+// satisfied for the host to match.  Empty selector matches all hosts.
+type Selector []requirement
+
+// ParseSelector parses the comma-separated list of requirements, each of
+// them is one of:
+//
+//   - "key=value" or "key==value": the label is set to the value;
+//   - "key!=value": the label is not set, or is set to another value;
+//   - "key": the label is set;
+//   - "!key": the label is not set.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		r, err := parseRequirement(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %s", ErrInvalidSelector, s, err)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+func parseRequirement(s string) (requirement, error) {
+	var r requirement
+	switch {
+	case s == "":
+		return r, errors.New("empty requirement")
+	case strings.HasPrefix(s, "!") && !strings.Contains(s, "="):
+		r.key, r.op = s[1:], opNotExists
+	case strings.Contains(s, "!="):
+		r.key, r.value, _ = strings.Cut(s, "!=")
+		r.op = opNotEquals
+	case strings.Contains(s, "=="):
+		r.key, r.value, _ = strings.Cut(s, "==")
+	case strings.Contains(s, "="):
+		r.key, r.value, _ = strings.Cut(s, "=")
+	default:
+		r.key, r.op = s, opExists
+	}
+	r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+	if err := validateKey(r.key); err != nil {
+		return r, err
+	}
+	if !reLabelValue.MatchString(r.value) {
+		return r, fmt.Errorf("invalid value %q", r.value)
+	}
+	return r, nil
+}
+
+// Empty returns true if the selector matches all hosts.
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+// Matches returns true if the labels satisfy all requirements of the
+// selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Select returns the hosts, that match the selector.
+func Select(hosts []Host, sel Selector) []Host {
+	var ret []Host
+	for _, h := range hosts {
+		if sel.Matches(h.Labels) {
+			ret = append(ret, h)
+		}
+	}
+	return ret
+}
+
+// sameMap returns true if both maps have the same keys and values, nil and
+// empty maps are considered equal.
+func sameMap(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// copyMap returns a copy of the map, or nil if it is nil.
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package vhoster
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelector(t *testing.T) {
+	labels := map[string]string{"env": "preview", "team": "web", "example.com/tier": ""}
+	tests := []struct {
+		selector string
+		want     string
+		matches  bool
+		wantErr  bool
+	}{
+		{"", "", true, false},
+		{"env=preview", "env=preview", true, false},
+		{" env == preview , team=web", "env=preview,team=web", true, false},
+		{"env=preview,team=api", "env=preview,team=api", false, false},
+		{"env!=prod", "env!=prod", true, false},
+		{"env!=preview", "env!=preview", false, false},
+		{"owner!=bob", "owner!=bob", true, false},
+		{"team", "team", true, false},
+		{"owner", "owner", false, false},
+		{"!owner", "!owner", true, false},
+		{"!env", "!env", false, false},
+		{"example.com/tier=", "example.com/tier=", true, false},
+		{"env=preview,", "", false, true},
+		{"=preview", "", false, true},
+		{"env=pre view", "", false, true},
+		{"!", "", false, true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.selector)
+		if tt.wantErr {
+			assert.ErrorIs(t, err, ErrInvalidSelector, tt.selector)
+			continue
+		}
+		require.NoError(t, err, tt.selector)
+		assert.Equal(t, tt.want, sel.String(), tt.selector)
+		assert.Equal(t, tt.matches, sel.Matches(labels), tt.selector)
+	}
+}
+
+func TestHost_ValidateLabels(t *testing.T) {
+	h := testHost("test.example.com", "http://localhost:8082")
+	h.Labels = map[string]string{"env": "preview", "example.com/team": "web", "empty": ""}
+	h.Annotations = map[string]string{"git-sha": "0123abc", "description": "free, form = text"}
+	assert.NoError(t, h.Validate())
+
+	h.Labels = map[string]string{"env": "pre view"}
+	assert.EqualError(t, h.Validate(), `label "env": invalid value "pre view", must be at most 63 letters, digits, ".", "_" and "-"`)
+	h.Labels = map[string]string{"-env": "preview"}
+	assert.Error(t, h.Validate())
+	h.Labels = nil
+	h.Annotations = map[string]string{"": "x"}
+	assert.Error(t, h.Validate())
+}
+
+func TestGateway_labels(t *testing.T) {
+	srv := backend(t, "ok")
+	u, _ := url.Parse(srv.URL)
+	g := testGateway(t)
+
+	h := withLabels(testHost("test.example.com", srv.URL), map[string]string{"env": "preview"})
+	h.Annotations = map[string]string{"git-sha": "abc"}
+	require.NoError(t, g.Apply(Op{Action: ActionAdd, Host: h}))
+	h.Labels["env"] = "prod" // the gateway keeps its own copy
+	require.NoError(t, g.Apply(Op{Action: ActionAdd, Host: testHost("other.example.com", srv.URL)}))
+
+	sel, err := ParseSelector("env=preview")
+	require.NoError(t, err)
+	got := Select(g.List(), sel)
+	require.Len(t, got, 1)
+	assert.Equal(t, "test.example.com", got[0].Name)
+	assert.Equal(t, map[string]string{"git-sha": "abc"}, got[0].Annotations)
+
+	// Replace keeps the labels and annotations.
+	require.NoError(t, g.Replace("test.example.com", u))
+	got = Select(g.List(), sel)
+	require.Len(t, got, 1)
+	assert.Equal(t, map[string]string{"git-sha": "abc"}, got[0].Annotations)
+	code, _ := getBody(t, g, "test.example.com")
+	assert.Equal(t, http.StatusOK, code)
+
+	assert.ErrorIs(t, g.Apply(Op{Action: ActionAdd, Host: withLabels(testHost("bad.example.com", srv.URL), map[string]string{"a b": "c"})}), ErrInvalidOp)
+}
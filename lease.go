@@ -0,0 +1,102 @@
+package vhoster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLeaseNotFound is returned when no host holds the lease.
+var ErrLeaseNotFound = errors.New("lease not found")
+
+// Lease is the lease of the host.  The host with the lease expires, unless
+// the lease is renewed within the interval.
+type Lease struct {
+	// ID is the random identifier of the lease.
+	ID string
+	// Interval is the time to live of the host after each renewal.
+	Interval time.Duration
+}
+
+// NewLease returns the lease with a new random ID.
+func NewLease(interval time.Duration) (*Lease, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidTTL
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("error generating the lease ID: %w", err)
+	}
+	return &Lease{ID: hex.EncodeToString(b[:]), Interval: interval}, nil
+}
+
+// leaseJSON is the JSON representation of the Lease, with the interval as a
+// duration string.
+type leaseJSON struct {
+	ID       string `json:"id"`
+	Interval string `json:"interval"`
+}
+
+func (l Lease) MarshalJSON() ([]byte, error) {
+	return json.Marshal(leaseJSON{ID: l.ID, Interval: l.Interval.String()})
+}
+
+func (l *Lease) UnmarshalJSON(b []byte) error {
+	var lj leaseJSON
+	if err := json.Unmarshal(b, &lj); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(lj.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid lease interval: %w", err)
+	}
+	*l = Lease{ID: lj.ID, Interval: d}
+	return nil
+}
+
+// Renew extends the expiry time of the host holding the lease by the lease
+// interval from now, and returns the updated host.  Like Extend, it does not
+// restart the proxy, but the renewal is not recorded in the history, as the
+// clients renew the leases every few seconds.
+func (g *Gateway) Renew(leaseID string) (Host, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	name, ok := g.leaseHolder(leaseID)
+	if !ok {
+		return Host{}, ErrLeaseNotFound
+	}
+	return g.extend(name, g.pws[name].vhost.Lease.Interval)
+}
+
+// Revoke removes the host holding the lease, records the removal in the
+// history on behalf of actor, and returns the removed host.
+func (g *Gateway) Revoke(leaseID string, actor string) (Host, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	name, ok := g.leaseHolder(leaseID)
+	if !ok {
+		return Host{}, ErrLeaseNotFound
+	}
+	h := g.pws[name].vhost
+	if err := g.removeAndRecord(actor, name); err != nil {
+		return Host{}, err
+	}
+	return h, nil
+}
+
+// leaseHolder returns the name of the host, that holds the lease.  The caller
+// should take care of locking the mutex.
+func (g *Gateway) leaseHolder(leaseID string) (string, bool) {
+	if leaseID == "" {
+		return "", false
+	}
+	for name, pw := range g.pws {
+		if pw.vhost.Lease != nil && pw.vhost.Lease.ID == leaseID {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,79 @@
+package vhoster
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLease_JSON(t *testing.T) {
+	l, err := NewLease(30 * time.Second)
+	require.NoError(t, err)
+	assert.Len(t, l.ID, 32)
+
+	b, err := json.Marshal(l)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"`+l.ID+`","interval":"30s"}`, string(b))
+	var got Lease
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, *l, got)
+
+	_, err = NewLease(0)
+	assert.ErrorIs(t, err, ErrInvalidTTL)
+}
+
+func TestGateway_Renew(t *testing.T) {
+	g := testGateway(t)
+	l, err := NewLease(time.Minute)
+	require.NoError(t, err)
+	h := testHost("worker.example.com", "http://a:80")
+	h.Lease = l
+	h = withExpiry(h, time.Now().Add(time.Second))
+	require.NoError(t, g.Apply(Op{Action: ActionAdd, Host: h}))
+	rev := g.Revision()
+
+	renewed, err := g.Renew(l.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *renewed.Expires, 5*time.Second)
+	assert.Equal(t, rev, g.Revision(), "renewals are not recorded")
+	assert.Empty(t, g.reap(time.Now().Add(30*time.Second)), "renewed host must not expire")
+	assert.Equal(t, []string{"worker.example.com"}, g.reap(time.Now().Add(2*time.Minute)), "lease not renewed in time")
+
+	_, err = g.Renew(l.ID)
+	assert.ErrorIs(t, err, ErrLeaseNotFound)
+	_, err = g.Renew("")
+	assert.ErrorIs(t, err, ErrLeaseNotFound)
+}
+
+func TestGateway_Revoke(t *testing.T) {
+	g := testGateway(t, testHost("static.example.com", "http://a:80"))
+	l, err := NewLease(time.Minute)
+	require.NoError(t, err)
+	h := withExpiry(testHost("worker.example.com", "http://a:80"), time.Now().Add(time.Minute))
+	h.Lease = l
+	require.NoError(t, g.Apply(Op{Action: ActionAdd, Host: h}))
+
+	_, err = g.Revoke("unknown", "worker")
+	assert.ErrorIs(t, err, ErrLeaseNotFound)
+	revoked, err := g.Revoke(l.ID, "worker")
+	require.NoError(t, err)
+	assert.Equal(t, h, revoked)
+	assert.False(t, g.Exists("worker.example.com"))
+	assert.True(t, g.Exists("static.example.com"))
+	hist := g.History()
+	assert.Equal(t, ActionRemove, hist[len(hist)-1].Action)
+	assert.Equal(t, "worker", hist[len(hist)-1].Actor)
+}
+
+func TestHost_Validate_lease(t *testing.T) {
+	h := testHost("a.example.com", "http://a")
+	h.Lease = &Lease{ID: "abc"}
+	assert.Error(t, h.Validate())
+	h.Lease = &Lease{Interval: time.Second}
+	assert.Error(t, h.Validate())
+	h.Lease = &Lease{ID: "abc", Interval: time.Second}
+	assert.NoError(t, h.Validate())
+}
@@ -5,8 +5,10 @@
 package mocks
 
 import (
+	context "context"
 	url "net/url"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	vhoster "github.com/rusq/vhoster"
@@ -49,6 +51,24 @@ func (mr *MockHostManagerMockRecorder) Add(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockHostManager)(nil).Add), arg0, arg1)
 }
 
+// Apply mocks base method.
+func (m *MockHostManager) Apply(arg0 ...vhoster.Op) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Apply", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Apply indicates an expected call of Apply.
+func (mr *MockHostManagerMockRecorder) Apply(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Apply", reflect.TypeOf((*MockHostManager)(nil).Apply), arg0...)
+}
+
 // Exists mocks base method.
 func (m *MockHostManager) Exists(arg0 string) bool {
 	m.ctrl.T.Helper()
@@ -63,6 +83,49 @@ func (mr *MockHostManagerMockRecorder) Exists(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockHostManager)(nil).Exists), arg0)
 }
 
+// Extend mocks base method.
+func (m *MockHostManager) Extend(arg0 string, arg1 time.Duration, arg2 string) (vhoster.Host, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Extend", arg0, arg1, arg2)
+	ret0, _ := ret[0].(vhoster.Host)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Extend indicates an expected call of Extend.
+func (mr *MockHostManagerMockRecorder) Extend(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Extend", reflect.TypeOf((*MockHostManager)(nil).Extend), arg0, arg1, arg2)
+}
+
+// Fallback mocks base method.
+func (m *MockHostManager) Fallback() *vhoster.URI {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fallback")
+	ret0, _ := ret[0].(*vhoster.URI)
+	return ret0
+}
+
+// Fallback indicates an expected call of Fallback.
+func (mr *MockHostManagerMockRecorder) Fallback() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fallback", reflect.TypeOf((*MockHostManager)(nil).Fallback))
+}
+
+// History mocks base method.
+func (m *MockHostManager) History() []vhoster.Revision {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History")
+	ret0, _ := ret[0].([]vhoster.Revision)
+	return ret0
+}
+
+// History indicates an expected call of History.
+func (mr *MockHostManagerMockRecorder) History() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockHostManager)(nil).History))
+}
+
 // List mocks base method.
 func (m *MockHostManager) List() []vhoster.Host {
 	m.ctrl.T.Helper()
@@ -91,6 +154,21 @@ func (mr *MockHostManagerMockRecorder) Remove(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockHostManager)(nil).Remove), arg0)
 }
 
+// Renew mocks base method.
+func (m *MockHostManager) Renew(arg0 string) (vhoster.Host, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Renew", arg0)
+	ret0, _ := ret[0].(vhoster.Host)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Renew indicates an expected call of Renew.
+func (mr *MockHostManagerMockRecorder) Renew(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Renew", reflect.TypeOf((*MockHostManager)(nil).Renew), arg0)
+}
+
 // Replace mocks base method.
 func (m *MockHostManager) Replace(arg0 string, arg1 *url.URL) error {
 	m.ctrl.T.Helper()
@@ -104,3 +182,76 @@ func (mr *MockHostManagerMockRecorder) Replace(arg0, arg1 interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replace", reflect.TypeOf((*MockHostManager)(nil).Replace), arg0, arg1)
 }
+
+// Revision mocks base method.
+func (m *MockHostManager) Revision() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revision")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// Revision indicates an expected call of Revision.
+func (mr *MockHostManagerMockRecorder) Revision() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revision", reflect.TypeOf((*MockHostManager)(nil).Revision))
+}
+
+// Revoke mocks base method.
+func (m *MockHostManager) Revoke(arg0, arg1 string) (vhoster.Host, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", arg0, arg1)
+	ret0, _ := ret[0].(vhoster.Host)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockHostManagerMockRecorder) Revoke(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockHostManager)(nil).Revoke), arg0, arg1)
+}
+
+// Rollback mocks base method.
+func (m *MockHostManager) Rollback(arg0 int64, arg1 string) ([]vhoster.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rollback", arg0, arg1)
+	ret0, _ := ret[0].([]vhoster.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Rollback indicates an expected call of Rollback.
+func (mr *MockHostManagerMockRecorder) Rollback(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*MockHostManager)(nil).Rollback), arg0, arg1)
+}
+
+// SetFallback mocks base method.
+func (m *MockHostManager) SetFallback(arg0 *url.URL) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFallback", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFallback indicates an expected call of SetFallback.
+func (mr *MockHostManagerMockRecorder) SetFallback(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFallback", reflect.TypeOf((*MockHostManager)(nil).SetFallback), arg0)
+}
+
+// Watch mocks base method.
+func (m *MockHostManager) Watch(arg0 context.Context, arg1 int64) (<-chan vhoster.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Watch", arg0, arg1)
+	ret0, _ := ret[0].(<-chan vhoster.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Watch indicates an expected call of Watch.
+func (mr *MockHostManagerMockRecorder) Watch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watch", reflect.TypeOf((*MockHostManager)(nil).Watch), arg0, arg1)
+}
@@ -0,0 +1,149 @@
+package vhoster
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidName is returned when the host name is not a valid DNS name.
+var ErrInvalidName = errors.New("invalid host name")
+
+// maxNameLen is the maximum length of the DNS name without the trailing dot.
+const maxNameLen = 253
+
+// defaultPorts are dropped from the host names, as browsers don't send them
+// in the Host header.
+var defaultPorts = map[string]bool{"80": true, "443": true}
+
+var reLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// NameError is returned by NormalizeName, it wraps ErrInvalidName.
+type NameError struct {
+	Name   string // the invalid name
+	Reason string // why the name is invalid
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("%s %q: %s", ErrInvalidName, e.Name, e.Reason)
+}
+
+func (e *NameError) Unwrap() error {
+	return ErrInvalidName
+}
+
+// NormalizeName returns the canonical form of the host name, as it is
+// registered in the gateway:
+//   - the name is lowercased;
+//   - the trailing dot is removed;
+//   - internationalised labels are converted to punycode;
+//   - the default ports 80 and 443 are removed.
+//
+// Every label must be 1 to 63 characters long, contain only letters, digits
+// and hyphens, and must not start or end with a hyphen.  The leftmost label
+// may be a wildcard "*".  The returned error is a *NameError.
+func NormalizeName(name string) (string, error) {
+	invalid := func(format string, a ...any) error {
+		return &NameError{Name: name, Reason: fmt.Sprintf(format, a...)}
+	}
+	host, port := name, ""
+	if strings.Contains(name, ":") {
+		var err error
+		if host, port, err = net.SplitHostPort(name); err != nil {
+			var ae *net.AddrError
+			if errors.As(err, &ae) {
+				return "", invalid("%s", ae.Err)
+			}
+			return "", invalid("%s", err)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", invalid("invalid port %q", port)
+		}
+		if defaultPorts[port] {
+			port = ""
+		}
+	}
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", invalid("empty name")
+	}
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if i == 0 && label == "*" && len(labels) > 1 {
+			continue
+		}
+		ascii, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			ascii = label // reported below
+		}
+		ascii = strings.ToLower(ascii)
+		if len(ascii) == 0 || len(ascii) > 63 {
+			return "", invalid("label %q must be 1 to 63 characters long", label)
+		}
+		if !reLabel.MatchString(ascii) {
+			return "", invalid("label %q must contain only letters, digits and hyphens, and must not start or end with a hyphen", label)
+		}
+		labels[i] = ascii
+	}
+	host = strings.Join(labels, ".")
+	if len(host) > maxNameLen {
+		return "", invalid("name is longer than %d characters", maxNameLen)
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	return host, nil
+}
+
+// normalize returns the copy of the host with the normalised name and
+// aliases.
+func (h Host) normalize() (Host, error) {
+	name, err := NormalizeName(h.Name)
+	if err != nil {
+		return Host{}, err
+	}
+	h.Name = name
+	if h.Aliases != nil {
+		aliases := make([]string, len(h.Aliases))
+		for i, a := range h.Aliases {
+			if aliases[i], err = NormalizeName(a); err != nil {
+				return Host{}, fmt.Errorf("alias: %w", err)
+			}
+		}
+		h.Aliases = aliases
+	}
+	h.Labels = copyMap(h.Labels)
+	h.Annotations = copyMap(h.Annotations)
+	return h, nil
+}
+
+// InDomain returns the copy of the host, as it is configured in the domain:
+// the domain name is appended to the host name and to the aliases, unless the
+// alias is the domain name itself or already ends with it, and the names are
+// normalised.  The gateway and the migrate command use it for the hosts from
+// the config file.
+func (h Host) InDomain(domain string) (Host, error) {
+	h.Name = h.Name + "." + domain
+	if h.Aliases != nil {
+		aliases := make([]string, len(h.Aliases))
+		for i, a := range h.Aliases {
+			aliases[i] = AliasInDomain(a, domain)
+		}
+		h.Aliases = aliases
+	}
+	return h.normalize()
+}
+
+// AliasInDomain appends the domain name to the alias, unless it is the domain
+// name itself or already ends with it.  The result is not normalised.
+func AliasInDomain(alias, domain string) string {
+	if strings.EqualFold(alias, domain) || strings.HasSuffix(strings.ToLower(alias), "."+strings.ToLower(domain)) {
+		return alias
+	}
+	return alias + "." + domain
+}
@@ -0,0 +1,98 @@
+package vhoster
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{"example.com", "example.com", ""},
+		{"Test.Example.COM", "test.example.com", ""},
+		{"test.example.com.", "test.example.com", ""},
+		{"test.example.com:8080", "test.example.com:8080", ""},
+		{"test.example.com:80", "test.example.com", ""},
+		{"test.example.com.:443", "test.example.com", ""},
+		{"münchen.example.com", "xn--mnchen-3ya.example.com", ""},
+		{"*.Example.com", "*.example.com", ""},
+		{"localhost", "localhost", ""},
+		{"", "", `invalid host name "": empty name`},
+		{"te_st.example.com", "", `invalid host name "te_st.example.com": label "te_st" must contain only letters, digits and hyphens, and must not start or end with a hyphen`},
+		{"-test.example.com", "", `invalid host name "-test.example.com": label "-test" must contain only letters, digits and hyphens, and must not start or end with a hyphen`},
+		{"test..example.com", "", `invalid host name "test..example.com": label "" must be 1 to 63 characters long`},
+		{"a.*.example.com", "", `invalid host name "a.*.example.com": label "*" must contain only letters, digits and hyphens, and must not start or end with a hyphen`},
+		{"example.com:http", "", `invalid host name "example.com:http": invalid port "http"`},
+		{"example.com:70000", "", `invalid host name "example.com:70000": invalid port "70000"`},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeName(tt.name)
+		if tt.wantErr != "" {
+			assert.EqualError(t, err, tt.wantErr, tt.name)
+			assert.ErrorIs(t, err, ErrInvalidName, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestGateway_normalisedNames(t *testing.T) {
+	srv := backend(t, "ok")
+	u, _ := url.Parse(srv.URL)
+	g := testGateway(t)
+
+	require.NoError(t, g.Add("Test.Example.com.", u))
+	assert.Equal(t, "test.example.com", g.List()[0].Name)
+	assert.True(t, g.Exists("TEST.example.com"))
+	assert.False(t, g.Exists("te_st.example.com"))
+	code, body := getBody(t, g, "test.example.com")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body)
+
+	assert.ErrorIs(t, g.Add("test.example.com", u), ErrAlreadyExists, "same name in another case")
+	assert.ErrorIs(t, g.Add("te_st.example.com", u), ErrInvalidName)
+	err := g.Apply(Op{Action: ActionAdd, Host: withAliases(testHost("other.example.com", srv.URL), "Www.Example.com")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"www.example.com"}, hostByName(t, g.List(), "other.example.com").Aliases)
+
+	assert.ErrorIs(t, g.Apply(Op{Action: ActionAdd, Host: testHost("bad_name.example.com", srv.URL)}), ErrInvalidOp)
+	assert.NoError(t, g.Remove("Test.Example.com:80"))
+	assert.False(t, g.Exists("test.example.com"))
+}
+
+func TestHost_InDomain(t *testing.T) {
+	h := Host{Name: "Vhost", Aliases: []string{"www", "Old.Example.com", "example.com", "old.example.org"}}
+	got, err := h.InDomain("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "vhost.example.com", got.Name)
+	assert.Equal(t, []string{"www.example.com", "old.example.com", "example.com", "old.example.org.example.com"}, got.Aliases)
+	assert.Equal(t, "Vhost", h.Name, "original is not modified")
+	assert.Equal(t, "www", h.Aliases[0], "original aliases are not modified")
+
+	_, err = Host{Name: "vhost", Aliases: []string{"-bad"}}.InDomain("example.com")
+	assert.ErrorIs(t, err, ErrInvalidName)
+}
+
+func TestAliasInDomain(t *testing.T) {
+	tests := []struct {
+		alias string
+		want  string
+	}{
+		{"www", "www.example.com"},
+		{"www.example.com", "www.example.com"},
+		{"example.com", "example.com"},
+		{"Example.COM", "Example.COM"},
+		{"old.example.org", "old.example.org.example.com"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, AliasInDomain(tt.alias, "example.com"), tt.alias)
+	}
+}
@@ -0,0 +1,338 @@
+package vhoster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrTargetDenied is returned when the target is rejected by the target
+// policy.
+var ErrTargetDenied = errors.New("target denied")
+
+// defaultSchemes are the allowed target schemes, if the policy does not list
+// any.
+var defaultSchemes = []string{"http", "https"}
+
+// TargetPolicy restricts the targets of the hosts, so that the gateway can't
+// be used to reach the internal services, i.e. the cloud metadata endpoint.
+// The policy is checked when the target is set, and when the gateway dials
+// the target, so that a host name, that resolves to a denied address later,
+// can't bypass it.  Zero value allows any http and https target.
+type TargetPolicy struct {
+	// Schemes are the allowed schemes, http and https if empty.
+	Schemes []string `json:"schemes,omitempty"`
+	// AllowCIDRs, if set, are the networks, that the target addresses must
+	// belong to.
+	AllowCIDRs []netip.Prefix `json:"allow_cidrs,omitempty"`
+	// DenyCIDRs are the networks, that the target addresses must not belong
+	// to.  They take precedence over AllowCIDRs.
+	DenyCIDRs []netip.Prefix `json:"deny_cidrs,omitempty"`
+	// AllowHosts, if set, are the patterns, that the target host must
+	// match, i.e. "*.svc.cluster.local".  See path.Match for the syntax.
+	AllowHosts []string `json:"allow_hosts,omitempty"`
+	// DenyHosts are the patterns, that the target host must not match.  They
+	// take precedence over AllowHosts.
+	DenyHosts []string `json:"deny_hosts,omitempty"`
+	// Ports, if set, are the allowed target ports.
+	Ports []PortRange `json:"ports,omitempty"`
+}
+
+// PolicyError is returned when the target is rejected by the policy, it
+// wraps ErrTargetDenied.
+type PolicyError struct {
+	Target string // the rejected target, URL or address
+	Rule   string // the rule, that rejected the target, i.e. "deny_cidrs"
+	Reason string // why the target was rejected
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("target %s is rejected by the %s rule: %s", e.Target, e.Rule, e.Reason)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrTargetDenied
+}
+
+// PortRange is the inclusive range of ports.  In JSON, it is either a number
+// or a string, i.e. 80, "80" or "8000-8999".
+type PortRange struct {
+	From uint16
+	To   uint16
+}
+
+// ParsePortRange parses the port or the range of ports, i.e. "80" or
+// "8000-8999".
+func ParsePortRange(s string) (PortRange, error) {
+	from, to, isRange := strings.Cut(s, "-")
+	if !isRange {
+		to = from
+	}
+	f, err := strconv.ParseUint(strings.TrimSpace(from), 10, 16)
+	if err != nil || f == 0 {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	t, err := strconv.ParseUint(strings.TrimSpace(to), 10, 16)
+	if err != nil || t < f {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{From: uint16(f), To: uint16(t)}, nil
+}
+
+// Contains returns true if the port is in the range.
+func (r PortRange) Contains(port uint16) bool {
+	return r.From <= port && port <= r.To
+}
+
+func (r PortRange) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(int(r.From))
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+func (r PortRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *PortRange) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var s string
+	switch v := v.(type) {
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("invalid port range %s", b)
+	}
+	pr, err := ParsePortRange(s)
+	if err != nil {
+		return err
+	}
+	*r = pr
+	return nil
+}
+
+// Validate checks that the host patterns are valid.
+func (p *TargetPolicy) Validate() error {
+	for _, pattern := range append(append([]string{}, p.AllowHosts...), p.DenyHosts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid host pattern %q: %w", pattern, err)
+		}
+	}
+	for _, s := range p.Schemes {
+		if s == "" {
+			return errors.New("empty scheme")
+		}
+	}
+	return nil
+}
+
+// Check checks the target URL against the policy without resolving the host
+// name.  The returned error is a *PolicyError.
+func (p *TargetPolicy) Check(u *url.URL) error {
+	target := u.String()
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	if !containsFold(schemes, u.Scheme) {
+		return &PolicyError{target, "schemes", fmt.Sprintf("scheme %q is not allowed, must be one of: %s", u.Scheme, strings.Join(schemes, ", "))}
+	}
+	port, err := targetPort(u)
+	if err != nil {
+		return &PolicyError{target, "ports", err.Error()}
+	}
+	if err := p.checkPort(target, port); err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if err := p.checkHost(target, host); err != nil {
+		return err
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(target, ip)
+	}
+	return nil
+}
+
+// CheckResolved checks the target URL against the policy, and the addresses,
+// that the host name resolves to.  The names, that can't be resolved, are
+// not rejected, they are checked when the gateway dials them.
+func (p *TargetPolicy) CheckResolved(ctx context.Context, u *url.URL) error {
+	if err := p.Check(u); err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if err := p.checkAddr(u.String(), ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPort checks the port against the allowed ports.
+func (p *TargetPolicy) checkPort(target string, port uint16) error {
+	if len(p.Ports) == 0 {
+		return nil
+	}
+	for _, r := range p.Ports {
+		if r.Contains(port) {
+			return nil
+		}
+	}
+	ports := make([]string, len(p.Ports))
+	for i, r := range p.Ports {
+		ports[i] = r.String()
+	}
+	return &PolicyError{target, "ports", fmt.Sprintf("port %d is not in the allowed ports %s", port, strings.Join(ports, ", "))}
+}
+
+// checkHost checks the host name against the host patterns.
+func (p *TargetPolicy) checkHost(target, host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range p.DenyHosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return &PolicyError{target, "deny_hosts", fmt.Sprintf("host %q matches the denied pattern %q", host, pattern)}
+		}
+	}
+	if len(p.AllowHosts) == 0 {
+		return nil
+	}
+	for _, pattern := range p.AllowHosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return nil
+		}
+	}
+	return &PolicyError{target, "allow_hosts", fmt.Sprintf("host %q does not match any of the allowed patterns", host)}
+}
+
+// checkAddr checks the IP address against the networks.
+func (p *TargetPolicy) checkAddr(target string, ip netip.Addr) error {
+	ip = ip.Unmap()
+	for _, n := range p.DenyCIDRs {
+		if n.Contains(ip) {
+			return &PolicyError{target, "deny_cidrs", fmt.Sprintf("address %s is in the denied network %s", ip, n)}
+		}
+	}
+	if len(p.AllowCIDRs) == 0 {
+		return nil
+	}
+	for _, n := range p.AllowCIDRs {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	return &PolicyError{target, "allow_cidrs", fmt.Sprintf("address %s is not in the allowed networks", ip)}
+}
+
+// control is the net.Dialer control function, that checks the resolved
+// address right before connecting.
+func (p *TargetPolicy) control(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	if err := p.checkPort(address, ap.Port()); err != nil {
+		return err
+	}
+	return p.checkAddr(address, ap.Addr())
+}
+
+// transport returns the transport for the proxies, that enforces the policy
+// when dialing the targets.  The proxy environment variables are ignored, as
+// the policy checks the addresses that are dialed.
+func (p *TargetPolicy) transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   p.control,
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkHost(addr, host); err != nil {
+			return nil, err
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	return t
+}
+
+// policyErrorHandler is the proxy error handler, used when there are no
+// error pages.  It responds with 403 to the targets rejected by the policy,
+// and with 502 to the other errors, as the default handler does.
+func policyErrorHandler(lg *log.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		lg.Printf("upstream error: %s", err)
+		var pe *PolicyError
+		if errors.As(err, &pe) {
+			http.Error(w, "403 "+pe.Error(), http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+// targetPort returns the port of the target URL, or the default port of the
+// scheme.
+func targetPort(u *url.URL) (uint16, error) {
+	s := u.Port()
+	if s == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "https":
+			return 443, nil
+		default:
+			return 80, nil
+		}
+	}
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || port == 0 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return uint16(port), nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithTargetPolicy sets the policy, that the targets of the hosts and the
+// fallback must comply with when the gateway dials them.
+func WithTargetPolicy(p *TargetPolicy) Option {
+	return func(o *options) {
+		o.policy = p
+	}
+}
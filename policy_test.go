@@ -0,0 +1,110 @@
+package vhoster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetPolicy_Check(t *testing.T) {
+	p := &TargetPolicy{
+		DenyCIDRs:  []netip.Prefix{netip.MustParsePrefix("169.254.0.0/16"), netip.MustParsePrefix("127.0.0.0/8")},
+		AllowCIDRs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("169.254.0.0/16")},
+		AllowHosts: []string{"*.svc.cluster.local", "10.*"},
+		DenyHosts:  []string{"admin.*"},
+		Ports:      []PortRange{{80, 80}, {8000, 8999}},
+	}
+	tests := []struct {
+		target   string
+		wantRule string
+	}{
+		{"http://web.svc.cluster.local", ""},
+		{"http://web.svc.cluster.local:8080", ""},
+		{"http://10.1.2.3:8000/", ""},
+		{"ftp://web.svc.cluster.local", "schemes"},
+		{"https://web.svc.cluster.local", "ports"},
+		{"http://web.svc.cluster.local:9000", "ports"},
+		{"http://admin.svc.cluster.local", "deny_hosts"},
+		{"http://example.com", "allow_hosts"},
+		{"http://10.1.2.3:22", "ports"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.target)
+		require.NoError(t, err)
+		err = p.Check(u)
+		if tt.wantRule == "" {
+			assert.NoError(t, err, tt.target)
+			continue
+		}
+		var pe *PolicyError
+		require.ErrorAs(t, err, &pe, tt.target)
+		assert.Equal(t, tt.wantRule, pe.Rule, tt.target)
+		assert.ErrorIs(t, err, ErrTargetDenied, tt.target)
+	}
+
+	t.Run("addresses", func(t *testing.T) {
+		p := &TargetPolicy{DenyCIDRs: p.DenyCIDRs, AllowCIDRs: p.AllowCIDRs}
+		u, _ := url.Parse("http://169.254.169.254/latest/meta-data/")
+		assert.EqualError(t, p.Check(u), "target http://169.254.169.254/latest/meta-data/ is rejected by the deny_cidrs rule: address 169.254.169.254 is in the denied network 169.254.0.0/16")
+		u, _ = url.Parse("http://[::ffff:127.0.0.1]:8080/")
+		assert.ErrorIs(t, p.Check(u), ErrTargetDenied, "IPv4-mapped address")
+		u, _ = url.Parse("http://192.168.0.1/")
+		assert.EqualError(t, p.Check(u), "target http://192.168.0.1/ is rejected by the allow_cidrs rule: address 192.168.0.1 is not in the allowed networks")
+		u, _ = url.Parse("http://localhost:8080/")
+		assert.NoError(t, p.Check(u), "names are not resolved")
+		assert.ErrorIs(t, p.CheckResolved(context.Background(), u), ErrTargetDenied)
+	})
+}
+
+func TestPortRange_JSON(t *testing.T) {
+	var prs []PortRange
+	require.NoError(t, json.Unmarshal([]byte(`[80, "443", "8000-8999"]`), &prs))
+	assert.Equal(t, []PortRange{{80, 80}, {443, 443}, {8000, 8999}}, prs)
+	b, err := json.Marshal(prs)
+	require.NoError(t, err)
+	assert.Equal(t, `["80","443","8000-8999"]`, string(b))
+
+	for _, s := range []string{`0`, `"8999-8000"`, `"http"`, `"70000"`, `true`} {
+		var pr PortRange
+		assert.Error(t, json.Unmarshal([]byte(s), &pr), s)
+	}
+}
+
+func TestGateway_targetPolicy(t *testing.T) {
+	srv := backend(t, "ok")
+	port := srv.URL[strings.LastIndexByte(srv.URL, ':'):]
+
+	t.Run("denied at dial time", func(t *testing.T) {
+		// the host name passes the static check, the resolved address is
+		// rejected when dialing.
+		policy := &TargetPolicy{DenyCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}}
+		g, err := Listen("127.0.0.1:0", WithTargetPolicy(policy), WithHosts([]Host{testHost("test.example.com", "http://localhost"+port)}))
+		require.NoError(t, err)
+		t.Cleanup(func() { g.Close() })
+
+		code, body := getBody(t, g, "test.example.com")
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Contains(t, body, "is rejected by the deny_cidrs rule: address ")
+	})
+	t.Run("allowed", func(t *testing.T) {
+		policy := &TargetPolicy{AllowCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}
+		g, err := Listen("127.0.0.1:0", WithTargetPolicy(policy), WithHosts([]Host{testHost("test.example.com", srv.URL)}))
+		require.NoError(t, err)
+		t.Cleanup(func() { g.Close() })
+
+		code, body := getBody(t, g, "test.example.com")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ok", body)
+	})
+	t.Run("invalid policy", func(t *testing.T) {
+		_, err := Listen("127.0.0.1:0", WithTargetPolicy(&TargetPolicy{AllowHosts: []string{"[a-"}}))
+		assert.Error(t, err)
+	})
+}
@@ -5,19 +5,43 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"time"
 )
 
 type proxyWrapper struct {
 	vhost Host
-	l     net.Listener
+	ls    []net.Listener // listeners for the name and the aliases
 	srv   *http.Server
 	wg    *sync.WaitGroup // reference to the parent waitgroup
+	act   *activity       // requests to the host
 }
 
+// closeTimeout is the time given to the active requests of the removed host
+// to complete, before their connections are closed.
+const closeTimeout = 30 * time.Second
+
 // Close closes all open handles and connections.
 func (pw proxyWrapper) Close() error {
-	pw.srv.Shutdown(context.Background())
-	pw.l.Close()
-	pw.wg.Done()
-	return nil
+	return pw.Shutdown(context.Background())
+}
+
+// Shutdown gracefully shuts down the server.  If the context is done before
+// the active requests complete, the remaining connections are closed and the
+// context error is returned.
+func (pw proxyWrapper) Shutdown(ctx context.Context) error {
+	defer pw.wg.Done()
+	err := pw.srv.Shutdown(ctx)
+	if err != nil {
+		pw.srv.Close()
+	}
+	pw.closeListeners()
+	return err
+}
+
+// closeListeners stops accepting the connections for the host names, it is
+// safe to call it more than once.
+func (pw proxyWrapper) closeListeners() {
+	for _, l := range pw.ls {
+		l.Close()
+	}
 }
@@ -0,0 +1,210 @@
+package vhoster
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowBackend returns the backend server, that blocks the requests until the
+// release channel is closed, and the channel that receives a value when the
+// request has started.
+func slowBackend(t *testing.T) (srv *httptest.Server, started <-chan struct{}, release chan struct{}) {
+	t.Helper()
+	st := make(chan struct{}, 1)
+	release = make(chan struct{})
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, "done")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, st, release
+}
+
+// get sends the request for the host through the gateway.
+func get(g *Gateway, host string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+g.ln.Addr().String()+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = host
+	cl := http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	return cl.Do(req)
+}
+
+func TestGateway_Shutdown(t *testing.T) {
+	t.Run("completes the active requests", func(t *testing.T) {
+		backend, started, release := slowBackend(t)
+		g := testGateway(t, testHost("slow.example.com", backend.URL))
+
+		type result struct {
+			body string
+			err  error
+		}
+		resc := make(chan result, 1)
+		go func() {
+			resp, err := get(g, "slow.example.com")
+			if err != nil {
+				resc <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			resc <- result{string(b), err}
+		}()
+		<-started
+
+		shutc := make(chan error, 1)
+		go func() { shutc <- g.Shutdown(context.Background()) }()
+		require.Eventually(t, func() bool {
+			_, err := get(g, "slow.example.com")
+			return err != nil
+		}, time.Second, 10*time.Millisecond, "new connections must be refused")
+
+		close(release)
+		res := <-resc
+		require.NoError(t, res.err)
+		assert.Equal(t, "done", res.body)
+		assert.NoError(t, <-shutc)
+		assert.NoError(t, g.Shutdown(context.Background()), "second shutdown is a no-op")
+	})
+	t.Run("closes the connections on timeout", func(t *testing.T) {
+		backend, started, _ := slowBackend(t)
+		g := testGateway(t, testHost("slow.example.com", backend.URL))
+
+		errc := make(chan error, 1)
+		go func() {
+			resp, err := get(g, "slow.example.com")
+			if err == nil {
+				resp.Body.Close()
+			}
+			errc <- err
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, g.Shutdown(ctx), context.DeadlineExceeded)
+		assert.Error(t, <-errc)
+	})
+}
+
+func TestGateway_Close(t *testing.T) {
+	g, err := Listen("127.0.0.1:0", WithHosts([]Host{testHost("a.example.com", "http://a:80")}))
+	require.NoError(t, err)
+	assert.NoError(t, g.Close())
+	g.Wait()
+}
+
+func TestGateway_Remove_activeRequest(t *testing.T) {
+	backend, started, release := slowBackend(t)
+	g := testGateway(t, testHost("slow.example.com", backend.URL))
+
+	resc := make(chan string, 1)
+	go func() {
+		resp, err := get(g, "slow.example.com")
+		if err != nil {
+			resc <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		resc <- string(b)
+	}()
+	<-started
+
+	removed := make(chan error, 1)
+	go func() { removed <- g.Remove("slow.example.com") }()
+	select {
+	case err := <-removed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "remove waits for the active request")
+	}
+	assert.False(t, g.Exists("slow.example.com"), "other operations are not blocked")
+	u, _ := url.Parse(backend.URL)
+	require.NoError(t, g.Add("slow.example.com", u), "the name can be registered again")
+
+	close(release)
+	assert.Equal(t, "done", <-resc, "the active request completes")
+}
+
+func TestGateway_Shutdown_removedHost(t *testing.T) {
+	backend, started, _ := slowBackend(t)
+	g := testGateway(t, testHost("slow.example.com", backend.URL))
+
+	errc := make(chan error, 1)
+	go func() {
+		resp, err := get(g, "slow.example.com")
+		if err == nil {
+			resp.Body.Close()
+		}
+		errc <- err
+	}()
+	<-started
+	require.NoError(t, g.Remove("slow.example.com"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.NoError(t, g.Shutdown(ctx))
+	assert.Less(t, time.Since(start), closeTimeout/2, "shutdown waits for the removed host past the context")
+	assert.Error(t, <-errc, "the connection of the removed host is closed")
+}
+
+func TestGateway_Shutdown_unlocked(t *testing.T) {
+	backend, started, release := slowBackend(t)
+	g := testGateway(t, testHost("slow.example.com", backend.URL))
+
+	go func() {
+		resp, err := get(g, "slow.example.com")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	shutc := make(chan error, 1)
+	go func() { shutc <- g.Shutdown(context.Background()) }()
+	require.Eventually(t, func() bool {
+		_, err := g.Watch(context.Background(), 0)
+		return errors.Is(err, ErrClosed)
+	}, time.Second, 10*time.Millisecond, "shutdown did not start")
+
+	// the drain is in progress, the other calls don't wait for it.
+	calls := make(chan error, 1)
+	go func() {
+		g.List()
+		g.Revision()
+		u, _ := url.Parse(backend.URL)
+		calls <- g.Add("new.example.com", u)
+	}()
+	select {
+	case err := <-calls:
+		assert.ErrorIs(t, err, ErrClosed)
+	case <-time.After(time.Second):
+		require.Fail(t, "calls are blocked by the drain")
+	}
+	select {
+	case <-shutc:
+		require.Fail(t, "shutdown completed before the active request")
+	default:
+	}
+
+	close(release)
+	assert.NoError(t, <-shutc)
+	g.Wait()
+}
@@ -0,0 +1,26 @@
+package vhoster
+
+// Store is a persistent storage for the route table.  Gateway writes all
+// changes of the route table through to the store, and restores the route
+// table from it on start.
+type Store interface {
+	// Load returns all stored hosts.
+	Load() ([]Host, error)
+	// Put stores the host, replacing the stored host with the same name.
+	Put(Host) error
+	// Delete removes the host with the given name.  It is not an error to
+	// delete a host that does not exist.
+	Delete(name string) error
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// WithStore sets the persistent store for the route table.  Hosts stored in
+// it are restored when the gateway starts, and preconfigured hosts with the
+// same name take precedence over the stored ones.  The caller is responsible
+// for closing the store after the gateway is closed.
+func WithStore(s Store) Option {
+	return func(o *options) {
+		o.store = s
+	}
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rusq/vhoster"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bktHosts   = []byte("hosts")   // host name -> boltRecord
+	bktChanges = []byte("changes") // revision -> Change, sequence is the current revision
+)
+
+// Change is a single change recorded by the Bolt store.
+type Change struct {
+	Revision uint64        `json:"revision"`
+	Time     time.Time     `json:"time"`
+	Op       Op            `json:"op"`
+	Name     string        `json:"name"`
+	Host     *vhoster.Host `json:"host,omitempty"` // set for OpPut
+}
+
+// boltRecord is the stored host with the revision of its last change.
+type boltRecord struct {
+	Host     vhoster.Host `json:"host"`
+	Revision uint64       `json:"revision"`
+}
+
+// Bolt is a store backed by the embedded bbolt database.  Every change is
+// assigned a monotonically increasing revision number and is recorded in
+// the change log, that can be trimmed with Compact.
+type Bolt struct {
+	path string
+
+	mu sync.RWMutex // protects db, exclusive lock is taken during compaction
+	db *bolt.DB
+}
+
+var _ vhoster.Store = (*Bolt)(nil)
+
+// OpenBolt opens or creates the bbolt database at path.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := openBoltDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Bolt{path: path, db: db}, nil
+}
+
+func openBoltDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bktHosts, bktChanges} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Load returns all stored hosts sorted by name.
+func (b *Bolt) Load() ([]vhoster.Host, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var hosts []vhoster.Host
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bktHosts).ForEach(func(_, v []byte) error {
+			var rec boltRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			hosts = append(hosts, rec.Host)
+			return nil
+		})
+	})
+	return hosts, err
+}
+
+// Put stores the host.
+func (b *Bolt) Put(h vhoster.Host) error {
+	return b.record(Change{Op: OpPut, Name: h.Name, Host: &h})
+}
+
+// Delete removes the host.
+func (b *Bolt) Delete(name string) error {
+	return b.record(Change{Op: OpDelete, Name: name})
+}
+
+// record applies the change and records it in the change log under the next
+// revision.
+func (b *Bolt) record(c Change) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.db.Update(func(tx *bolt.Tx) error {
+		changes := tx.Bucket(bktChanges)
+		rev, err := changes.NextSequence()
+		if err != nil {
+			return err
+		}
+		c.Revision = rev
+		c.Time = time.Now().UTC()
+
+		hosts := tx.Bucket(bktHosts)
+		switch c.Op {
+		case OpPut:
+			v, err := json.Marshal(boltRecord{Host: *c.Host, Revision: rev})
+			if err != nil {
+				return err
+			}
+			if err := hosts.Put([]byte(c.Name), v); err != nil {
+				return err
+			}
+		case OpDelete:
+			if err := hosts.Delete([]byte(c.Name)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown operation: %q", c.Op)
+		}
+
+		v, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return changes.Put(itob(rev), v)
+	})
+}
+
+// Revision returns the current revision of the store, i.e. the revision of
+// the last change.
+func (b *Bolt) Revision() (uint64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var rev uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		rev = tx.Bucket(bktChanges).Sequence()
+		return nil
+	})
+	return rev, err
+}
+
+// Changes returns the recorded changes with revisions greater than since,
+// in the order of revisions.  Changes removed by Compact are not returned.
+func (b *Bolt) Changes(since uint64) ([]Change, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var ret []Change
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bktChanges).Cursor()
+		for k, v := c.Seek(itob(since + 1)); k != nil; k, v = c.Next() {
+			var ch Change
+			if err := json.Unmarshal(v, &ch); err != nil {
+				return err
+			}
+			ret = append(ret, ch)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// Compact removes all but the last keep changes from the change log, and
+// rewrites the database file to reclaim the free space.  The current
+// revision and the stored hosts are not affected.
+func (b *Bolt) Compact(keep uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.db.Update(func(tx *bolt.Tx) error {
+		changes := tx.Bucket(bktChanges)
+		rev := changes.Sequence()
+		if rev <= keep {
+			return nil
+		}
+		c := changes.Cursor()
+		for k, _ := c.First(); k != nil && btoi(k) <= rev-keep; k, _ = c.Next() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return b.defragment()
+}
+
+// defragment copies the database into a new file and replaces the old one
+// with it.  The caller must hold the exclusive lock.
+func (b *Bolt) defragment() error {
+	tmpPath := b.path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bolt.Open(tmpPath, 0o600, nil)
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, b.db, 1<<20); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := b.db.Close(); err != nil {
+		return err
+	}
+	renameErr := os.Rename(tmpPath, b.path)
+	// reopen in any case, if rename failed, we reopen the old file.
+	db, err := openBoltDB(b.path)
+	if err != nil {
+		return errors.Join(renameErr, err)
+	}
+	b.db = db
+	return renameErr
+}
+
+// Close closes the database.
+func (b *Bolt) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.db.Close()
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
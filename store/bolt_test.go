@@ -0,0 +1,104 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rusq/vhoster"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestBolt(t *testing.T) (*Bolt, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routes.db")
+	b, err := OpenBolt(path)
+	require.NoError(t, err)
+	return b, path
+}
+
+func TestBolt_PutDelete(t *testing.T) {
+	b, path := openTestBolt(t)
+
+	require.NoError(t, b.Put(testHost("b.example.com", "http://b:80")))
+	require.NoError(t, b.Put(testHost("a.example.com", "http://a:80")))
+	require.NoError(t, b.Put(testHost("a.example.com", "http://aa:80")))
+	require.NoError(t, b.Delete("b.example.com"))
+	require.NoError(t, b.Delete("missing.example.com"))
+
+	want := []vhoster.Host{testHost("a.example.com", "http://aa:80")}
+	assert.Equal(t, want, loadAll(t, b))
+	require.NoError(t, b.Close())
+
+	b, err := OpenBolt(path)
+	require.NoError(t, err)
+	defer b.Close()
+	assert.Equal(t, want, loadAll(t, b))
+}
+
+func TestBolt_revisions(t *testing.T) {
+	b, _ := openTestBolt(t)
+	defer b.Close()
+
+	rev, err := b.Revision()
+	require.NoError(t, err)
+	assert.Zero(t, rev)
+
+	require.NoError(t, b.Put(testHost("a.example.com", "http://a:80")))
+	require.NoError(t, b.Put(testHost("b.example.com", "http://b:80")))
+	require.NoError(t, b.Delete("a.example.com"))
+
+	rev, err = b.Revision()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), rev)
+
+	changes, err := b.Changes(1)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, uint64(2), changes[0].Revision)
+	assert.Equal(t, OpPut, changes[0].Op)
+	assert.Equal(t, "b.example.com", changes[0].Host.Name)
+	assert.Equal(t, uint64(3), changes[1].Revision)
+	assert.Equal(t, OpDelete, changes[1].Op)
+	assert.Equal(t, "a.example.com", changes[1].Name)
+	assert.Nil(t, changes[1].Host)
+}
+
+func TestBolt_Compact(t *testing.T) {
+	b, path := openTestBolt(t)
+	defer b.Close()
+
+	for i := 0; i < 500; i++ {
+		require.NoError(t, b.Put(testHost("a.example.com", "http://a:80")))
+	}
+	require.NoError(t, b.Put(testHost("b.example.com", "http://b:80")))
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Compact(2))
+
+	changes, err := b.Changes(0)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, uint64(500), changes[0].Revision)
+	assert.Equal(t, uint64(501), changes[1].Revision)
+
+	rev, err := b.Revision()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(501), rev, "compaction must not reset the revision")
+	assert.Equal(t, []vhoster.Host{
+		testHost("a.example.com", "http://a:80"),
+		testHost("b.example.com", "http://b:80"),
+	}, loadAll(t, b))
+
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, after.Size(), before.Size())
+
+	// the store is usable after compaction.
+	require.NoError(t, b.Put(testHost("c.example.com", "http://c:80")))
+	rev, err = b.Revision()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(502), rev)
+}
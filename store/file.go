@@ -0,0 +1,309 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/rusq/vhoster"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	journalFile  = "journal.jsonl"
+)
+
+// DefaultCompactEvery is the default number of journal entries after which
+// the journal is compacted into the snapshot.
+const DefaultCompactEvery = 1000
+
+// Op is the type of the change recorded by the store.
+type Op string
+
+const (
+	OpPut    Op = "put"    // host was added or replaced
+	OpDelete Op = "delete" // host was deleted
+)
+
+// journalEntry is a single line of the journal.
+type journalEntry struct {
+	Op   Op            `json:"op"`
+	Host *vhoster.Host `json:"host,omitempty"` // set for OpPut
+	Name string        `json:"name,omitempty"` // set for OpDelete
+}
+
+// File is a file-backed store.  It keeps the state in a directory, that
+// contains the JSON snapshot of the route table and the append-only journal
+// of changes made since the snapshot was taken.  Every change is written to
+// the journal and synced to disk before it is acknowledged, and the journal
+// is periodically compacted into a new snapshot, that replaces the old one
+// atomically.  A torn write at the end of the journal, that may be left by a
+// crash, is discarded when the store is opened.
+type File struct {
+	dir          string
+	compactEvery int
+
+	mu      sync.Mutex
+	hosts   map[string]vhoster.Host
+	journal *os.File
+	entries int // number of entries in the journal
+}
+
+var _ vhoster.Store = (*File)(nil)
+
+// FileOption is a functional option for the File store.
+type FileOption func(*File)
+
+// WithCompactEvery sets the number of journal entries after which the
+// journal is compacted.
+func WithCompactEvery(n int) FileOption {
+	return func(f *File) {
+		if n > 0 {
+			f.compactEvery = n
+		}
+	}
+}
+
+// OpenFile opens the file store in the directory dir, creating it if
+// necessary, and recovers the state from the snapshot and the journal.
+func OpenFile(dir string, opts ...FileOption) (*File, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	f := &File{
+		dir:          dir,
+		compactEvery: DefaultCompactEvery,
+		hosts:        make(map[string]vhoster.Host),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if err := f.recover(); err != nil {
+		return nil, err
+	}
+	// start with a clean journal, this also discards the torn tail.
+	if err := f.compact(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// recover loads the snapshot and replays the journal on top of it.
+func (f *File) recover() error {
+	b, err := os.ReadFile(filepath.Join(f.dir, snapshotFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var hosts []vhoster.Host
+		if err := json.Unmarshal(b, &hosts); err != nil {
+			return fmt.Errorf("corrupt snapshot: %w", err)
+		}
+		for _, h := range hosts {
+			f.hosts[h.Name] = h
+		}
+	}
+
+	jf, err := os.Open(filepath.Join(f.dir, journalFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer jf.Close()
+	return f.replay(jf)
+}
+
+// replay applies the journal entries from r.  Replay stops at the first
+// incomplete or corrupt entry, as it may only be the result of a crash
+// during the write.
+func (f *File) replay(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if len(bytes.TrimSpace(line)) > 0 {
+					log.Printf("store: discarding incomplete journal entry %d", n)
+				}
+				return nil
+			}
+			return err
+		}
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			log.Printf("store: discarding corrupt journal entry %d and the rest of the journal: %s", n, err)
+			return nil
+		}
+		f.applyEntry(e)
+	}
+}
+
+func (f *File) applyEntry(e journalEntry) {
+	switch e.Op {
+	case OpPut:
+		if e.Host != nil {
+			f.hosts[e.Host.Name] = *e.Host
+		}
+	case OpDelete:
+		delete(f.hosts, e.Name)
+	}
+}
+
+// Load returns all stored hosts sorted by name.
+func (f *File) Load() ([]vhoster.Host, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.list(), nil
+}
+
+func (f *File) list() []vhoster.Host {
+	hosts := make([]vhoster.Host, 0, len(f.hosts))
+	for _, h := range f.hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	return hosts
+}
+
+// Put stores the host.
+func (f *File) Put(h vhoster.Host) error {
+	return f.write(journalEntry{Op: OpPut, Host: &h})
+}
+
+// Delete removes the host.
+func (f *File) Delete(name string) error {
+	return f.write(journalEntry{Op: OpDelete, Name: name})
+}
+
+// write appends the entry to the journal, syncs it to disk and applies it to
+// the in-memory state.
+func (f *File) write(e journalEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.journal == nil {
+		return os.ErrClosed
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.journal.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := f.journal.Sync(); err != nil {
+		return err
+	}
+	f.applyEntry(e)
+	f.entries++
+	if f.entries >= f.compactEvery {
+		if err := f.compact(); err != nil {
+			// the entry is in the journal, so it is not lost.
+			log.Printf("store: compaction failed: %s", err)
+		}
+	}
+	return nil
+}
+
+// Compact writes the current state to the snapshot and truncates the
+// journal.
+func (f *File) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.journal == nil {
+		return os.ErrClosed
+	}
+	return f.compact()
+}
+
+// compact is concurrently unsafe version of Compact.
+func (f *File) compact() error {
+	b, err := json.MarshalIndent(f.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(f.dir, snapshotFile), b); err != nil {
+		return err
+	}
+	// the snapshot contains everything from the journal at this point, so
+	// if we crash before the journal is truncated, the replay of the stale
+	// journal is harmless, as all entries are idempotent.
+	if f.journal != nil {
+		f.journal.Close()
+	}
+	jf, err := os.OpenFile(filepath.Join(f.dir, journalFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		f.journal = nil
+		return err
+	}
+	f.journal = jf
+	f.entries = 0
+	return syncDir(f.dir)
+}
+
+// Close compacts the journal and closes the store.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.journal == nil {
+		return nil
+	}
+	err := f.compact()
+	if f.journal != nil {
+		if cerr := f.journal.Close(); err == nil {
+			err = cerr
+		}
+	}
+	f.journal = nil
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory,
+// syncs it and renames it to name, so that name contains either the old or
+// the new data, even if the process crashes.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// syncDir syncs the directory, so that the renames and file creations in it
+// are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		// some platforms do not support syncing directories.
+		return err
+	}
+	return nil
+}
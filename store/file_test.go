@@ -0,0 +1,147 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rusq/vhoster"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testHost(name, uri string) vhoster.Host {
+	return vhoster.Host{Name: name, URI: vhoster.Must(vhoster.Parse(uri))}
+}
+
+func loadAll(t *testing.T, s vhoster.Store) []vhoster.Host {
+	t.Helper()
+	hosts, err := s.Load()
+	require.NoError(t, err)
+	return hosts
+}
+
+func TestFile_PutDelete(t *testing.T) {
+	dir := t.TempDir()
+	f, err := OpenFile(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, f.Put(testHost("b.example.com", "http://b:80")))
+	require.NoError(t, f.Put(testHost("a.example.com", "http://a:80")))
+	require.NoError(t, f.Put(testHost("a.example.com", "http://aa:80")))
+	require.NoError(t, f.Put(testHost("c.example.com", "http://c:80")))
+	require.NoError(t, f.Delete("c.example.com"))
+	require.NoError(t, f.Delete("missing.example.com"))
+
+	want := []vhoster.Host{
+		testHost("a.example.com", "http://aa:80"),
+		testHost("b.example.com", "http://b:80"),
+	}
+	assert.Equal(t, want, loadAll(t, f))
+	require.NoError(t, f.Close())
+	assert.ErrorIs(t, f.Put(testHost("d.example.com", "http://d:80")), os.ErrClosed)
+
+	f, err = OpenFile(dir)
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, want, loadAll(t, f))
+}
+
+func TestFile_crashRecovery(t *testing.T) {
+	t.Run("journal is replayed without close", func(t *testing.T) {
+		dir := t.TempDir()
+		f, err := OpenFile(dir)
+		require.NoError(t, err)
+		require.NoError(t, f.Put(testHost("a.example.com", "http://a:80")))
+		require.NoError(t, f.Put(testHost("b.example.com", "http://b:80")))
+		require.NoError(t, f.Delete("a.example.com"))
+		// simulate the crash: the store is never closed.
+
+		f2, err := OpenFile(dir)
+		require.NoError(t, err)
+		defer f2.Close()
+		assert.Equal(t, []vhoster.Host{testHost("b.example.com", "http://b:80")}, loadAll(t, f2))
+	})
+	t.Run("torn journal tail is discarded", func(t *testing.T) {
+		dir := t.TempDir()
+		f, err := OpenFile(dir)
+		require.NoError(t, err)
+		require.NoError(t, f.Put(testHost("a.example.com", "http://a:80")))
+		// simulate the crash in the middle of the write.
+		jf, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = jf.WriteString(`{"op":"put","host":{"name":"b.exa`)
+		require.NoError(t, err)
+		require.NoError(t, jf.Close())
+
+		f2, err := OpenFile(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []vhoster.Host{testHost("a.example.com", "http://a:80")}, loadAll(t, f2))
+		// the store must be writable after recovery, and the torn entry
+		// must not corrupt the following ones.
+		require.NoError(t, f2.Put(testHost("c.example.com", "http://c:80")))
+		f3, err := OpenFile(dir)
+		require.NoError(t, err)
+		defer f3.Close()
+		assert.Equal(t, []vhoster.Host{
+			testHost("a.example.com", "http://a:80"),
+			testHost("c.example.com", "http://c:80"),
+		}, loadAll(t, f3))
+	})
+	t.Run("stale journal after compaction is harmless", func(t *testing.T) {
+		dir := t.TempDir()
+		f, err := OpenFile(dir)
+		require.NoError(t, err)
+		require.NoError(t, f.Put(testHost("a.example.com", "http://a:80")))
+		require.NoError(t, f.Delete("a.example.com"))
+		require.NoError(t, f.Put(testHost("b.example.com", "http://b:80")))
+		journal, err := os.ReadFile(filepath.Join(dir, journalFile))
+		require.NoError(t, err)
+		require.NoError(t, f.Compact())
+		// simulate the crash between the snapshot rename and the journal
+		// truncation.
+		require.NoError(t, os.WriteFile(filepath.Join(dir, journalFile), journal, 0o600))
+
+		f2, err := OpenFile(dir)
+		require.NoError(t, err)
+		defer f2.Close()
+		assert.Equal(t, []vhoster.Host{testHost("b.example.com", "http://b:80")}, loadAll(t, f2))
+	})
+	t.Run("leftover temporary snapshot is ignored", func(t *testing.T) {
+		dir := t.TempDir()
+		f, err := OpenFile(dir)
+		require.NoError(t, err)
+		require.NoError(t, f.Put(testHost("a.example.com", "http://a:80")))
+		require.NoError(t, f.Close())
+		require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFile+".tmp123"), []byte(`[{"name":`), 0o600))
+
+		f2, err := OpenFile(dir)
+		require.NoError(t, err)
+		defer f2.Close()
+		assert.Equal(t, []vhoster.Host{testHost("a.example.com", "http://a:80")}, loadAll(t, f2))
+	})
+	t.Run("corrupt snapshot is an error", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFile), []byte(`[{"name":`), 0o600))
+		_, err := OpenFile(dir)
+		assert.Error(t, err)
+	})
+}
+
+func TestFile_compaction(t *testing.T) {
+	dir := t.TempDir()
+	f, err := OpenFile(dir, WithCompactEvery(3))
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, f.Put(testHost("a.example.com", "http://a:80")))
+	require.NoError(t, f.Put(testHost("b.example.com", "http://b:80")))
+	require.NoError(t, f.Put(testHost("c.example.com", "http://c:80")))
+
+	fi, err := os.Stat(filepath.Join(dir, journalFile))
+	require.NoError(t, err)
+	assert.Zero(t, fi.Size(), "journal must be truncated after compaction")
+	snap, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(snap), "c.example.com")
+}
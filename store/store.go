@@ -0,0 +1,27 @@
+// Package store contains the implementations of the vhoster.Store.
+package store
+
+import (
+	"fmt"
+
+	"github.com/rusq/vhoster"
+)
+
+// Backend names accepted by Open.
+const (
+	BackendFile = "file" // directory with the JSON snapshot and the journal, see File
+	BackendBolt = "bolt" // bbolt database file, see Bolt
+)
+
+// Open opens the store of the given backend at path.  Empty backend means
+// BackendFile.
+func Open(backend, path string) (vhoster.Store, error) {
+	switch backend {
+	case "", BackendFile:
+		return OpenFile(path)
+	case BackendBolt:
+		return OpenBolt(path)
+	default:
+		return nil, fmt.Errorf("unknown store backend: %q", backend)
+	}
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rusq/vhoster"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen(t *testing.T) {
+	_, err := Open("etcd", t.TempDir())
+	assert.Error(t, err)
+}
+
+// TestGatewayStore checks that all backends persist the route table of the
+// gateway between restarts.
+func TestGatewayStore(t *testing.T) {
+	for _, backend := range []string{BackendFile, BackendBolt} {
+		t.Run(backend, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state")
+			st, err := Open(backend, path)
+			require.NoError(t, err)
+
+			preconfigured := []vhoster.Host{testHost("config.example.com", "http://config:80")}
+			g, err := vhoster.Listen("127.0.0.1:0", vhoster.WithHosts(preconfigured), vhoster.WithStore(st))
+			require.NoError(t, err)
+			require.NoError(t, g.Add("api.example.com", vhoster.Must(vhoster.Parse("http://api:80")).URL()))
+			require.NoError(t, g.Add("gone.example.com", vhoster.Must(vhoster.Parse("http://gone:80")).URL()))
+			require.NoError(t, g.Remove("gone.example.com"))
+			g.Close()
+			require.NoError(t, st.Close())
+
+			// restart with the changed preconfigured host.
+			st, err = Open(backend, path)
+			require.NoError(t, err)
+			defer st.Close()
+			preconfigured = []vhoster.Host{testHost("config.example.com", "http://config-new:80")}
+			g, err = vhoster.Listen("127.0.0.1:0", vhoster.WithHosts(preconfigured), vhoster.WithStore(st))
+			require.NoError(t, err)
+			defer g.Close()
+			assert.ElementsMatch(t, []vhoster.Host{
+				testHost("api.example.com", "http://api:80"),
+				testHost("config.example.com", "http://config-new:80"),
+			}, g.List())
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package systemd implements the parts of the systemd service protocol used
+// by the gateway: socket activation and the service state notifications.
+//
+// See sd_listen_fds(3) and sd_notify(3) for the details.
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// UnknownName is the name of the socket, that has no FileDescriptorName= in
+// the socket unit.
+const UnknownName = "unknown"
+
+// Listener is the listening socket passed by systemd.
+type Listener struct {
+	net.Listener
+	// Name is the FileDescriptorName= of the socket unit, or UnknownName.
+	Name string
+}
+
+// Listeners returns the listening sockets passed by systemd socket
+// activation, in the order they were passed.  If the process was not socket
+// activated, it returns nil.  The LISTEN_* environment variables are unset,
+// so that they are not inherited by the child processes.
+func Listeners() ([]Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	n, names, err := listenFDs(os.Getenv, os.Getpid())
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	ls := make([]Listener, 0, n)
+	for i := 0; i < n; i++ {
+		fd := uintptr(listenFDsStart + i)
+		f := os.NewFile(fd, names[i])
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %d (%s): %w", fd, names[i], err)
+		}
+		ls = append(ls, Listener{Listener: l, Name: names[i]})
+	}
+	return ls, nil
+}
+
+// listenFDs parses the socket activation environment variables, and returns
+// the number of passed file descriptors and their names.
+func listenFDs(getenv func(string) string, pid int) (int, []string, error) {
+	spid := getenv("LISTEN_PID")
+	if spid == "" {
+		return 0, nil, nil
+	}
+	if lpid, err := strconv.Atoi(spid); err != nil {
+		return 0, nil, fmt.Errorf("invalid LISTEN_PID: %q", spid)
+	} else if lpid != pid {
+		// the variables are meant for another process.
+		return 0, nil, nil
+	}
+	sfds := getenv("LISTEN_FDS")
+	n, err := strconv.Atoi(sfds)
+	if err != nil || n < 0 {
+		return 0, nil, fmt.Errorf("invalid LISTEN_FDS: %q", sfds)
+	}
+	names := make([]string, n)
+	if s := getenv("LISTEN_FDNAMES"); s != "" {
+		copy(names, strings.Split(s, ":"))
+	}
+	for i := range names {
+		if names[i] == "" {
+			names[i] = UnknownName
+		}
+	}
+	return n, names, nil
+}
+
+// Service state notifications.
+const (
+	Ready     = "READY=1"
+	Reloading = "RELOADING=1"
+	Stopping  = "STOPPING=1"
+	Watchdog  = "WATCHDOG=1"
+)
+
+// MainPID returns the notification that tells the service manager that the
+// main process of the service is pid.
+func MainPID(pid int) string {
+	return "MAINPID=" + strconv.Itoa(pid)
+}
+
+// Notify sends the newline separated state notifications to the service
+// manager.  It returns false, if the process was not started by systemd with
+// the notification support.
+func Notify(state ...string) (bool, error) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return false, nil
+	}
+	// the leading "@" denotes the abstract socket, the net package handles
+	// it.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(strings.Join(state, "\n"))); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the watchdog timeout set by the service manager,
+// or zero, if the watchdog is disabled.  The Watchdog notification should be
+// sent at least every half of it.
+func WatchdogInterval() (time.Duration, error) {
+	return watchdogInterval(os.Getenv, os.Getpid())
+}
+
+func watchdogInterval(getenv func(string) string, pid int) (time.Duration, error) {
+	s := getenv("WATCHDOG_USEC")
+	if s == "" {
+		return 0, nil
+	}
+	if spid := getenv("WATCHDOG_PID"); spid != "" {
+		if wpid, err := strconv.Atoi(spid); err != nil {
+			return 0, fmt.Errorf("invalid WATCHDOG_PID: %q", spid)
+		} else if wpid != pid {
+			return 0, nil
+		}
+	}
+	usec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, errors.New("invalid WATCHDOG_USEC: " + strconv.Quote(s))
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
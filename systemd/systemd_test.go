@@ -0,0 +1,193 @@
+//go:build !windows
+
+package systemd
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// envTestChild is set in the environment of the test binary started by
+// activate.
+const envTestChild = "SYSTEMD_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envTestChild) != "" {
+		os.Exit(testChild())
+	}
+	os.Exit(m.Run())
+}
+
+// testChild runs in the socket activated process.  It answers one connection
+// on every inherited listener with the listener name and the remaining
+// LISTEN_FDS variable.
+func testChild() int {
+	// the service manager sets LISTEN_PID after fork, the harness can't know
+	// the pid in advance.
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	ls, err := Listeners()
+	if err != nil {
+		os.Stdout.WriteString("error: " + err.Error())
+		return 1
+	}
+	for _, l := range ls {
+		l.Listener.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+		conn, err := l.Accept()
+		if err != nil {
+			return 1
+		}
+		io.WriteString(conn, l.Name+" "+os.Getenv("LISTEN_FDS")+"\n")
+		conn.Close()
+		l.Close()
+	}
+	return 0
+}
+
+// activate simulates the systemd socket activation: it starts the test binary
+// with the listeners passed as file descriptors starting from 3, and the
+// LISTEN_* environment variables set.  names are joined into LISTEN_FDNAMES,
+// if not empty.
+func activate(t *testing.T, names []string, ls ...net.Listener) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	for _, l := range ls {
+		f, err := l.(*net.TCPListener).File()
+		require.NoError(t, err)
+		defer f.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	}
+	cmd.Env = append(os.Environ(), envTestChild+"=1", "LISTEN_PID=0", "LISTEN_FDS="+strconv.Itoa(len(ls)))
+	if len(names) > 0 {
+		cmd.Env = append(cmd.Env, "LISTEN_FDNAMES="+strings.Join(names, ":"))
+	}
+	cmd.Stderr = os.Stderr
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() { cmd.Process.Kill(); cmd.Wait() })
+	return cmd
+}
+
+func TestListeners(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"named", []string{"gateway", "api"}, []string{"gateway", "api"}},
+		{"unnamed", nil, []string{UnknownName, UnknownName}},
+		{"partially named", []string{"gateway"}, []string{"gateway", UnknownName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ls []net.Listener
+			for i := 0; i < 2; i++ {
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				require.NoError(t, err)
+				defer l.Close()
+				ls = append(ls, l)
+			}
+			activate(t, tt.names, ls...)
+			for i, l := range ls {
+				conn, err := net.Dial("tcp", l.Addr().String())
+				require.NoError(t, err)
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				conn.Close()
+				require.NoError(t, err)
+				assert.Equal(t, tt.want[i]+" \n", line, "env variables must be unset")
+			}
+		})
+	}
+}
+
+func Test_listenFDs(t *testing.T) {
+	env := func(m map[string]string) func(string) string {
+		return func(k string) string { return m[k] }
+	}
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantN     int
+		wantNames []string
+		wantErr   bool
+	}{
+		{"not activated", nil, 0, nil, false},
+		{"another process", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "2"}, 0, nil, false},
+		{"activated", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "gateway:api"}, 2, []string{"gateway", "api"}, false},
+		{"extra names", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "1", "LISTEN_FDNAMES": "gateway:api"}, 1, []string{"gateway"}, false},
+		{"invalid pid", map[string]string{"LISTEN_PID": "x", "LISTEN_FDS": "2"}, 0, nil, true},
+		{"invalid fds", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "-1"}, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, names, err := listenFDs(env(tt.env), 42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listenFDs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantN, n)
+			assert.Equal(t, tt.wantNames, names)
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Run("not under systemd", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+		sent, err := Notify(Ready)
+		assert.NoError(t, err)
+		assert.False(t, sent)
+	})
+	t.Run("sends the state", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "notify.sock")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		require.NoError(t, err)
+		defer conn.Close()
+		t.Setenv("NOTIFY_SOCKET", path)
+
+		sent, err := Notify(Ready, MainPID(42))
+		require.NoError(t, err)
+		assert.True(t, sent)
+
+		buf := make([]byte, 256)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "READY=1\nMAINPID=42", string(buf[:n]))
+	})
+}
+
+func Test_watchdogInterval(t *testing.T) {
+	env := func(m map[string]string) func(string) string {
+		return func(k string) string { return m[k] }
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"disabled", nil, 0, false},
+		{"enabled", map[string]string{"WATCHDOG_USEC": "30000000"}, 30 * time.Second, false},
+		{"this process", map[string]string{"WATCHDOG_USEC": "1000", "WATCHDOG_PID": "42"}, time.Millisecond, false},
+		{"another process", map[string]string{"WATCHDOG_USEC": "1000", "WATCHDOG_PID": "1"}, 0, false},
+		{"invalid", map[string]string{"WATCHDOG_USEC": "soon"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := watchdogInterval(env(tt.env), 42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("watchdogInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
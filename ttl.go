@@ -0,0 +1,121 @@
+package vhoster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultReapInterval is the default interval between the checks for the
+// expired hosts.
+const DefaultReapInterval = time.Second
+
+// ErrInvalidTTL is returned when the TTL is not positive.
+var ErrInvalidTTL = errors.New("ttl must be positive")
+
+// ReaperActor is the actor of the removals made by the reaper, as recorded
+// in the history.
+const ReaperActor = "reaper"
+
+// WithReapInterval sets the interval between the checks for the expired
+// hosts.
+func WithReapInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.reapInterval = d
+		}
+	}
+}
+
+// Expired returns true if the host has the expiry time and it is not after
+// now.
+func (h Host) Expired(now time.Time) bool {
+	return h.Expires != nil && !now.Before(*h.Expires)
+}
+
+// Extend sets the expiry time of the virtual host to ttl from now, records
+// the change in the history as ActionReplace on behalf of actor, and returns
+// the updated host.  The proxy is not restarted.
+func (g *Gateway) Extend(vhost string, ttl time.Duration, actor string) (Host, error) {
+	if ttl <= 0 {
+		return Host{}, ErrInvalidTTL
+	}
+	vhost, err := NormalizeName(vhost)
+	if err != nil {
+		return Host{}, ErrNotFound
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	prev := g.lookup(vhost)
+	h, err := g.extend(vhost, ttl)
+	if err != nil {
+		return Host{}, err
+	}
+	g.record(actor, ActionReplace, h, prev)
+	return h, nil
+}
+
+// extend sets the expiry time of the host without recording the change.  The
+// caller should take care of locking the mutex.
+func (g *Gateway) extend(vhost string, ttl time.Duration) (Host, error) {
+	pw, ok := g.pws[vhost]
+	if !ok {
+		return Host{}, ErrNotFound
+	}
+	h := pw.vhost
+	expires := time.Now().Add(ttl).UTC()
+	h.Expires = &expires
+	if g.store != nil {
+		if err := g.store.Put(h); err != nil {
+			return Host{}, fmt.Errorf("error storing host %q: %w", h.Name, err)
+		}
+	}
+	pw.vhost = h
+	g.pws[vhost] = pw
+	return h, nil
+}
+
+// reaper removes the expired hosts every interval, until the gateway is
+// closed.
+func (g *Gateway) reaper(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case now := <-t.C:
+			g.reap(now)
+		}
+	}
+}
+
+// reap removes the hosts, that expired by now, and the idle ones, if the
+// idle action is IdleRemove, and records the removals in the history as
+// ActionExpire.  It returns the names of the removed hosts.
+func (g *Gateway) reap(now time.Time) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var removed []string
+	for name, pw := range g.pws {
+		expired := pw.vhost.Expired(now)
+		idle := g.idleAction == IdleRemove && g.isIdle(pw, now)
+		if !expired && !idle {
+			continue
+		}
+		prev := pw.vhost
+		if err := g.remove(name); err != nil {
+			log.Printf("error removing expired host %q: %v", name, err)
+			continue
+		}
+		if expired {
+			log.Printf("host %q expired at %s", name, prev.Expires.Format(time.RFC3339))
+		} else {
+			log.Printf("host %q removed after %s without requests", name, g.idleTimeout)
+		}
+		g.record(ReaperActor, ActionExpire, Host{Name: name}, &prev)
+		removed = append(removed, name)
+	}
+	return removed
+}
@@ -0,0 +1,85 @@
+package vhoster
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withExpiry returns the copy of the host, that expires at t.
+func withExpiry(h Host, t time.Time) Host {
+	h.Expires = &t
+	return h
+}
+
+func TestGateway_reap(t *testing.T) {
+	now := time.Now()
+	g := testGateway(t, testHost("static.example.com", "http://a:80"))
+	expiring := withExpiry(testHost("old.example.com", "http://b:80"), now.Add(-time.Second))
+	fresh := withExpiry(testHost("new.example.com", "http://c:80"), now.Add(time.Hour))
+	require.NoError(t, g.Apply(Op{Action: ActionAdd, Host: expiring}, Op{Action: ActionAdd, Host: fresh}))
+
+	assert.Equal(t, []string{"old.example.com"}, g.reap(now))
+	assert.ElementsMatch(t, []Host{testHost("static.example.com", "http://a:80"), fresh}, g.List())
+
+	hist := g.History()
+	last := hist[len(hist)-1]
+	assert.Equal(t, ActionExpire, last.Action)
+	assert.Equal(t, ReaperActor, last.Actor)
+	assert.Equal(t, &expiring, last.Previous)
+
+	t.Run("rollback restores the expired host", func(t *testing.T) {
+		_, err := g.Rollback(last.ID-1, "admin")
+		require.NoError(t, err)
+		assert.True(t, g.Exists("old.example.com"))
+	})
+}
+
+func TestGateway_reaper(t *testing.T) {
+	srv := backend(t, "ok")
+	g, err := Listen("127.0.0.1:0", WithReapInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+
+	h := withExpiry(testHost("short.example.com", srv.URL), time.Now().Add(100*time.Millisecond))
+	require.NoError(t, g.Apply(Op{Action: ActionAdd, Host: h}))
+	code, _ := getBody(t, g, "short.example.com")
+	assert.Equal(t, http.StatusOK, code)
+
+	assert.Eventually(t, func() bool { return !g.Exists("short.example.com") }, 2*time.Second, 10*time.Millisecond)
+	code, _ = getBody(t, g, "short.example.com")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestGateway_Extend(t *testing.T) {
+	g := testGateway(t, testHost("a.example.com", "http://a:80"))
+
+	before := time.Now()
+	h, err := g.Extend("a.example.com", time.Hour, "alice")
+	require.NoError(t, err)
+	require.NotNil(t, h.Expires)
+	assert.WithinDuration(t, before.Add(time.Hour), *h.Expires, time.Minute)
+	assert.Equal(t, []Host{h}, g.List())
+	hist := g.History()
+	last := hist[len(hist)-1]
+	assert.Equal(t, ActionReplace, last.Action, "extension is recorded")
+	assert.Equal(t, "alice", last.Actor)
+	assert.Equal(t, h.Expires, last.Host.Expires)
+	require.NotNil(t, last.Previous)
+	assert.Nil(t, last.Previous.Expires)
+	assert.Empty(t, g.reap(before.Add(30*time.Minute)))
+
+	t.Run("replace keeps the expiry", func(t *testing.T) {
+		require.NoError(t, g.Replace("a.example.com", Must(Parse("http://b:80")).URL()))
+		assert.Equal(t, h.Expires, g.List()[0].Expires)
+	})
+	t.Run("errors", func(t *testing.T) {
+		_, err := g.Extend("b.example.com", time.Hour, "alice")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = g.Extend("a.example.com", 0, "alice")
+		assert.ErrorIs(t, err, ErrInvalidTTL)
+	})
+}
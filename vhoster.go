@@ -1,7 +1,10 @@
 package vhoster
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -24,21 +27,58 @@ var (
 
 // Gateway is a virtual host reverse proxy server.  Zero value is not usable.
 type Gateway struct {
-	ln   net.Listener // main listener
-	vhm  *vhost.HTTPMuxer
-	done chan struct{}
-
-	mu  sync.Mutex
-	pws map[string]proxyWrapper // a map of registered listeners
-	wg  *sync.WaitGroup         // a waitgroup for running servers
+	ln      net.Listener // main listener
+	vhm     *vhost.HTTPMuxer
+	done    chan struct{} // closed, when the shutdown starts
+	stopped chan struct{} // closed, when the shutdown completes
+
+	mu          sync.Mutex
+	pws         map[string]proxyWrapper // a map of registered listeners
+	alias       map[string]string       // alias to the host name
+	wg          *sync.WaitGroup         // a waitgroup for running servers
+	removed     context.Context         // context of the removed hosts, that complete the active requests
+	stopRemoved context.CancelFunc      // closes the connections of the removed hosts
+	store       Store                   // optional persistent store
+	hist        history                 // route table revisions
+	watchers    watchers                // subscribers to the route table changes
+	pages       *ErrorPages             // optional error pages
+	fb          *fallback               // fallback for the unknown hosts
+
+	idleTimeout time.Duration // zero disables the idle hosts handling
+	idleAction  IdleAction    // what to do with the idle hosts
+
+	transport http.RoundTripper // enforces the target policy, nil if there's none
 }
 
 // Host is a single Virtual Host.
 type Host struct {
 	// Name is the name of the Virtual Host.
 	Name string `json:"name"`
+	// Aliases are the other names of the Virtual Host, that are registered
+	// and removed together with it.
+	Aliases []string `json:"aliases,omitempty"`
 	// URI is the URI of the target HTTP server.
 	URI *URI `json:"uri"`
+	// Labels are the identifying attributes of the host, i.e. the owner team
+	// or the environment, that can be used to select the hosts.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are the free-form attributes of the host, i.e. the git
+	// commit, that are not used for selection.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Expires is the time, after which the host is removed by the gateway.
+	// Nil means the host never expires.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Lease is the lease of the host, that must be renewed before the host
+	// expires.
+	Lease *Lease `json:"lease,omitempty"`
+	// Pinned hosts are never considered idle.
+	Pinned bool `json:"pinned,omitempty"`
+	// LastSeen is the time of the last request to the host, nil if the host
+	// hasn't received any requests yet.  It is set by List.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	// Dormant is true, if the host hasn't received requests for the idle
+	// timeout.  It is set by List.
+	Dormant bool `json:"dormant,omitempty"`
 }
 
 func (h Host) Validate() error {
@@ -48,16 +88,56 @@ func (h Host) Validate() error {
 	if h.URI == nil {
 		return errors.New("empty host URI")
 	}
+	name, err := NormalizeName(h.Name)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{name: true}
+	for _, a := range h.Aliases {
+		if a == "" {
+			return errors.New("empty alias")
+		}
+		alias, err := NormalizeName(a)
+		if err != nil {
+			return fmt.Errorf("alias: %w", err)
+		}
+		if seen[alias] {
+			return fmt.Errorf("duplicate alias %q", a)
+		}
+		seen[alias] = true
+	}
+	if h.Lease != nil && (h.Lease.ID == "" || h.Lease.Interval <= 0) {
+		return errors.New("invalid lease")
+	}
+	if err := ValidateLabels(h.Labels); err != nil {
+		return err
+	}
+	if err := ValidateAnnotations(h.Annotations); err != nil {
+		return err
+	}
 	return nil
 }
 
+// names returns the name and the aliases of the host.
+func (h Host) names() []string {
+	return append([]string{h.Name}, h.Aliases...)
+}
+
 // Option is a functional option for the server.
 type Option func(*options)
 
 // options is a set of options for the server.
 type options struct {
-	timeout time.Duration
-	hosts   []Host
+	timeout      time.Duration
+	hosts        []Host
+	store        Store
+	historySize  int
+	pages        *ErrorPages
+	fallback     *URI
+	reapInterval time.Duration
+	idleTimeout  time.Duration
+	idleAction   IdleAction
+	policy       *TargetPolicy
 }
 
 // WithTimeout sets the connection timeout to the virtual hosts.
@@ -76,57 +156,182 @@ func WithHosts(hs []Host) Option {
 	}
 }
 
+// WithErrorPages sets the error pages, that are served instead of the plain
+// text errors and the upstream errors.
+func WithErrorPages(p *ErrorPages) Option {
+	return func(o *options) {
+		o.pages = p
+	}
+}
+
 // Listen initialises the server and starts listening on the given address.
 func Listen(addr string, opts ...Option) (*Gateway, error) {
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
+	g, err := New(ln, opts...)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return g, nil
+}
 
+// New initialises the server on the existing listener, i.e. the one
+// inherited from the parent process.  The gateway takes the ownership of the
+// listener and closes it on shutdown.
+func New(ln net.Listener, opts ...Option) (*Gateway, error) {
 	o := &options{
-		timeout: 100 * time.Millisecond,
+		timeout:      100 * time.Millisecond,
+		historySize:  DefaultHistorySize,
+		reapInterval: DefaultReapInterval,
 	}
 	for _, opt := range opts {
 		opt(o)
 	}
+	if o.fallback != nil {
+		if err := validateFallback(o.fallback.URL()); err != nil {
+			return nil, err
+		}
+	}
+	if o.idleTimeout > 0 {
+		if err := o.idleAction.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	var transport http.RoundTripper
+	if o.policy != nil {
+		if err := o.policy.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid target policy: %w", err)
+		}
+		transport = o.policy.transport()
+	}
 
 	vhm, err := vhost.NewHTTPMuxer(ln, o.timeout)
 	if err != nil {
 		return nil, err
 	}
 	done := make(chan struct{})
+	removed, stopRemoved := context.WithCancel(context.Background())
 	g := &Gateway{
 		ln:   ln,
 		vhm:  vhm,
 		done: done,
-		pws:  make(map[string]proxyWrapper, 1),
-		wg:   new(sync.WaitGroup),
+
+		stopped: make(chan struct{}),
+		pws:     make(map[string]proxyWrapper, 1),
+		alias:   make(map[string]string),
+		wg:      new(sync.WaitGroup),
+		hist:    newHistory(o.historySize, time.Now()),
+
+		removed:     removed,
+		stopRemoved: stopRemoved,
+		pages:       o.pages,
+		fb:          newFallback(ln.Addr(), o.pages, transport),
+
+		idleTimeout: o.idleTimeout,
+		idleAction:  o.idleAction,
+		transport:   transport,
+	}
+	if o.fallback != nil {
+		g.fb.set(o.fallback)
+	}
+
+	// restoring stored hosts
+	if o.store != nil {
+		if err := g.restore(o.store, o.hosts); err != nil {
+			return nil, err
+		}
+		g.store = o.store
 	}
 
 	// preconfigured hosts
 	for _, h := range o.hosts {
-		if err := g.Add(h.Name, h.URI.URL()); err != nil {
+		if err := g.addHost(h); err != nil {
 			return nil, err
 		}
 	}
 
-	go errorhandler(vhm, done)
+	go errorhandler(vhm, done, o.pages, g.fb)
+	go g.reaper(o.reapInterval)
 	return g, nil
 }
 
+// Close immediately closes the gateway and all active connections.  For a
+// graceful shutdown, use Shutdown.
 func (g *Gateway) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.Shutdown(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the gateway.  It stops accepting new
+// connections, and waits for the active requests to complete.  If the
+// context is done before that, the remaining connections are closed and the
+// context error is returned.  The route table is emptied right away, and the
+// changes are rejected with ErrClosed, but the mutex is not held while
+// waiting, so the other calls don't hang.  Calling Shutdown on the closed
+// gateway is a no-op.
+func (g *Gateway) Shutdown(ctx context.Context) error {
 	g.mu.Lock()
-	defer g.mu.Unlock()
-	defer close(g.done)
+	select {
+	case <-g.done:
+		g.mu.Unlock()
+		return nil
+	default:
+	}
+	close(g.done)
+	defer close(g.stopped)
 
-	// closing listeners
-	for vhost, l := range g.pws {
-		delete(g.pws, vhost)
-		l.Close()
+	// closing the muxer closes the main listener.
+	g.vhm.Close()
+	g.watchers.closeAll()
+	pws := g.pws
+	g.pws = make(map[string]proxyWrapper)
+	g.alias = make(map[string]string)
+	g.mu.Unlock()
+
+	var (
+		wg   sync.WaitGroup
+		errc = make(chan error, len(pws)+1)
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errc <- g.fb.Shutdown(ctx)
+	}()
+	for _, pw := range pws {
+		wg.Add(1)
+		go func(pw proxyWrapper) {
+			defer wg.Done()
+			errc <- pw.Shutdown(ctx)
+		}(pw)
 	}
+	wg.Wait()
+	// the hosts removed earlier may still be completing the requests, they
+	// get no more time than the rest.
+	drained := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			g.stopRemoved()
+		case <-drained:
+		}
+	}()
 	g.wg.Wait() // waiting for servers to shut down
-	g.vhm.Close()
-	return g.ln.Close()
+	close(drained)
+	g.stopRemoved()
+	close(errc)
+	for err := range errc {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // wrapAlreadyBound wraps the error returned by the vhost manager when the
@@ -144,77 +349,294 @@ func wrapAlreadyBound(err error) error {
 
 // Add adds the virtual host to the server.
 func (g *Gateway) Add(vhost string, uri *url.URL) error {
+	return g.addHost(Host{Name: vhost, URI: ToURI(uri)})
+}
+
+// addHost normalises the names of the host, adds it with its aliases and
+// records the change in the history.
+func (g *Gateway) addHost(h Host) error {
+	h, err := h.normalize()
+	if err != nil {
+		return err
+	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	if err := g.add(h); err != nil {
+		return err
+	}
+	g.record("", ActionAdd, h, nil)
+	return nil
+}
 
-	lg := log.New(log.Default().Writer(), vhost+": ", log.Default().Flags())
-
-	lg.Printf("setting up proxy for %s to %s", vhost, uri)
-	ml, err := g.vhm.Listen(vhost)
+// restore adds the hosts from the store, except the ones that are in the
+// preconfigured hosts.
+func (g *Gateway) restore(s Store, preconfigured []Host) error {
+	stored, err := s.Load()
 	if err != nil {
-		return wrapAlreadyBound(err)
+		return fmt.Errorf("error loading hosts from the store: %w", err)
+	}
+	skip := make(map[string]struct{}, len(preconfigured))
+	for _, h := range preconfigured {
+		if nh, err := h.normalize(); err == nil {
+			h = nh
+		}
+		skip[h.Name] = struct{}{}
 	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, h := range stored {
+		if nh, err := h.normalize(); err != nil {
+			log.Printf("warning: stored host %q has an invalid name, restoring as is: %s", h.Name, err)
+		} else {
+			h = nh
+		}
+		if _, ok := skip[h.Name]; ok {
+			continue
+		}
+		if err := g.listen(h); err != nil {
+			return fmt.Errorf("error restoring host %q: %w", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// add is concurrently unsafe version of Add.  The caller should take care of
+// locking the mutex.
+func (g *Gateway) add(h Host) error {
+	h.LastSeen, h.Dormant = nil, false // these are set by List
+	if err := g.listen(h); err != nil {
+		return err
+	}
+	if g.store != nil {
+		if err := g.store.Put(h); err != nil {
+			g.unlisten(h.Name)
+			return fmt.Errorf("error storing host %q: %w", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// listen starts the proxy for the host and its aliases.  The caller should
+// take care of locking the mutex.
+func (g *Gateway) listen(h Host) error {
+	select {
+	case <-g.done:
+		return ErrClosed
+	default:
+	}
+	lg := log.New(log.Default().Writer(), h.Name+": ", log.Default().Flags())
+
+	if err := g.conflicts(h); err != nil {
+		return err
+	}
+	if len(h.Aliases) > 0 {
+		lg.Printf("setting up proxy for %s (aliases: %s) to %s", h.Name, strings.Join(h.Aliases, ", "), h.URI)
+	} else {
+		lg.Printf("setting up proxy for %s to %s", h.Name, h.URI)
+	}
+	var ls []net.Listener
+	for _, name := range h.names() {
+		ml, err := g.vhm.Listen(name)
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return wrapAlreadyBound(err)
+		}
+		ls = append(ls, ml)
+	}
+	act := newActivity()
 	srv := http.Server{
-		Handler: httputil.NewSingleHostReverseProxy(uri),
+		Handler: act.track(g.proxy(h, lg)),
 	}
 	pw := proxyWrapper{
-		l:   ml,
-		srv: &srv,
-		wg:  g.wg,
-		vhost: Host{
-			Name: vhost,
-			URI:  ToURI(uri),
-		},
+		ls:    ls,
+		srv:   &srv,
+		wg:    g.wg,
+		vhost: h,
+		act:   act,
+	}
+	g.pws[h.Name] = pw
+	for _, a := range h.Aliases {
+		g.alias[a] = h.Name
 	}
-	g.pws[vhost] = pw
 
 	g.wg.Add(1)
-	go func() {
-		if err := srv.Serve(ml); err != nil {
-			if errors.Is(err, http.ErrServerClosed) {
-				return
+	for _, ml := range ls {
+		go func(ml net.Listener) {
+			if err := srv.Serve(ml); err != nil {
+				if errors.Is(err, http.ErrServerClosed) {
+					return
+				}
+				lg.Printf("error: %v", err)
 			}
-			lg.Printf("error: %v", err)
+		}(ml)
+	}
+	return nil
+}
+
+// conflicts returns ErrAlreadyExists if the name or any of the aliases of the
+// host is already used by another host, as a name or as an alias.  The
+// caller should take care of locking the mutex.
+func (g *Gateway) conflicts(h Host) error {
+	for _, name := range h.names() {
+		if _, ok := g.pws[name]; ok {
+			return fmt.Errorf("%w: %s", ErrAlreadyExists, name)
 		}
-	}()
+		if owner, ok := g.alias[name]; ok {
+			return fmt.Errorf("%w: %s is an alias of %s", ErrAlreadyExists, name, owner)
+		}
+	}
 	return nil
 }
 
-// Replace replaces the virtual host with the new one.
+// proxy returns the reverse proxy handler for the host.
+func (g *Gateway) proxy(h Host, lg *log.Logger) http.Handler {
+	rp := httputil.NewSingleHostReverseProxy(h.URI.URL())
+	if g.transport != nil {
+		rp.Transport = g.transport
+		rp.ErrorHandler = policyErrorHandler(lg)
+	}
+	if g.pages == nil {
+		return rp
+	}
+	rp.ErrorHandler = g.pages.proxyErrorHandler(lg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ensureRequestID(r.Header)
+		rp.ServeHTTP(w, r)
+	})
+}
+
+// Replace replaces the virtual host with the new one, keeping its aliases, the
+// expiry time and the lease.
 // If the virtual host does not exist, it will be added.
 func (g *Gateway) Replace(vhost string, uri *url.URL) error {
-	if err := g.Remove(vhost); err != nil {
+	vhost, err := NormalizeName(vhost)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	h := Host{Name: vhost, URI: ToURI(uri)}
+	prev := g.lookup(vhost)
+	if prev != nil {
+		h.Aliases = prev.Aliases
+		h.Expires = prev.Expires
+		h.Lease = prev.Lease
+		h.Pinned = prev.Pinned
+		h.Labels = prev.Labels
+		h.Annotations = prev.Annotations
+	}
+	if err := g.replace(h); err != nil {
+		return err
+	}
+	g.record("", ActionReplace, h, prev)
+	return nil
+}
+
+// replace is concurrently unsafe version of Replace.  If the new host can't
+// be added, i.e. one of its aliases is taken, the previous one is restored.
+// The caller should take care of locking the mutex.
+func (g *Gateway) replace(h Host) error {
+	prev := g.lookup(h.Name)
+	var seen int64
+	if pw, ok := g.pws[h.Name]; ok {
+		seen = pw.act.seen.Load()
+	}
+	if err := g.remove(h.Name); err != nil {
 		if !errors.Is(err, ErrNotFound) {
 			return err
 		}
 	}
-	return g.Add(vhost, uri)
+	if err := g.add(h); err != nil {
+		if prev != nil {
+			if rerr := g.add(*prev); rerr != nil {
+				log.Printf("error restoring host %q: %v", prev.Name, rerr)
+			}
+		}
+		return err
+	}
+	g.pws[h.Name].act.seen.Store(seen)
+	return nil
 }
 
-// Exists returns true if the virtual host exists.
+// Exists returns true if the name is taken by a virtual host, either as its
+// name or as an alias.  The name is normalised before the lookup, so the check
+// is case-insensitive.
 func (g *Gateway) Exists(vhost string) bool {
+	vhost, err := NormalizeName(vhost)
+	if err != nil {
+		return false
+	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	_, ok := g.pws[vhost]
+	if _, ok := g.pws[vhost]; ok {
+		return true
+	}
+	_, ok := g.alias[vhost]
 	return ok
 }
 
 // Remove removes the virtual host from the server.
 func (g *Gateway) Remove(vhost string) error {
+	vhost, err := NormalizeName(vhost)
+	if err != nil {
+		return ErrNotFound
+	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	return g.remove(vhost)
+	return g.removeAndRecord("", vhost)
+}
+
+// removeAndRecord removes the host and records the change in the history.
+// The caller should take care of locking the mutex.
+func (g *Gateway) removeAndRecord(actor string, vhost string) error {
+	prev := g.lookup(vhost)
+	if err := g.remove(vhost); err != nil {
+		return err
+	}
+	g.record(actor, ActionRemove, Host{Name: vhost}, prev)
+	return nil
 }
 
 // remove is concurrently unsafe version of Remove.  The caller should take
 // care of locking the mutex.
 func (g *Gateway) remove(vhost string) error {
+	if _, ok := g.pws[vhost]; !ok {
+		return ErrNotFound
+	}
+	if g.store != nil {
+		if err := g.store.Delete(vhost); err != nil {
+			return fmt.Errorf("error deleting host %q from the store: %w", vhost, err)
+		}
+	}
+	return g.unlisten(vhost)
+}
+
+// unlisten stops the proxy for the host without touching the store.  The
+// listeners are closed right away, so that the names can be registered again,
+// and the active requests are given up to closeTimeout to complete in the
+// background, so that they don't hold the mutex, or less, if the gateway is
+// shut down in the meantime.  The caller should take care of locking the
+// mutex.
+func (g *Gateway) unlisten(vhost string) error {
 	l, ok := g.pws[vhost]
 	if !ok {
 		return ErrNotFound
 	}
 	delete(g.pws, vhost)
-	return l.Close()
+	for _, a := range l.vhost.Aliases {
+		delete(g.alias, a)
+	}
+	l.closeListeners()
+	go func() {
+		ctx, cancel := context.WithTimeout(g.removed, closeTimeout)
+		defer cancel()
+		if err := l.Shutdown(ctx); err != nil {
+			log.Printf("%s: error closing the active connections: %s", vhost, err)
+		}
+	}()
+	return nil
 }
 
 // RemoveByURI removes the virtual host from the server by URI.
@@ -224,7 +646,7 @@ func (g *Gateway) RemoveByURI(uri *URI) error {
 
 	for vhost, l := range g.pws {
 		if l.vhost.URI.URL().String() == uri.String() {
-			return g.remove(vhost)
+			return g.removeAndRecord("", vhost)
 		}
 	}
 	return ErrNotFound
@@ -232,13 +654,15 @@ func (g *Gateway) RemoveByURI(uri *URI) error {
 
 // Wait blocks until the server is closed.
 func (g *Gateway) Wait() {
-	<-g.done
+	<-g.stopped
 }
 
 // errorhandler loops over the errors returned by the vhost manager
 // and handles them, if necessary.  It exists when done channel is
-// closed.
-func errorhandler(vm *vhost.HTTPMuxer, done <-chan struct{}) {
+// closed.  If pages is not nil, errors are rendered using the error pages.
+// Connections for the unknown hosts are passed to the fallback, if it has the
+// target.
+func errorhandler(vm *vhost.HTTPMuxer, done <-chan struct{}, pages *ErrorPages, fb *fallback) {
 	for {
 		select {
 		case <-done:
@@ -249,10 +673,13 @@ func errorhandler(vm *vhost.HTTPMuxer, done <-chan struct{}) {
 		switch err.(type) {
 		case vhost.BadRequest:
 			log.Print("got a bad request!")
-			handleError(conn, http.StatusBadRequest, errors.New("bad request"))
+			handleError(conn, http.StatusBadRequest, errors.New("bad request"), pages)
 		case vhost.NotFound:
+			if fb.serve(conn) {
+				continue
+			}
 			log.Printf("got a connection for an unknown vhost: %s", err)
-			handleError(conn, http.StatusNotFound, ErrNotFound)
+			handleError(conn, http.StatusNotFound, ErrNotFound, pages)
 		case vhost.Closed:
 			log.Printf("closed conn: %s", err)
 		default:
@@ -264,7 +691,7 @@ func errorhandler(vm *vhost.HTTPMuxer, done <-chan struct{}) {
 			}
 			log.Printf("generic error (%[1]T): %[1]s,", err)
 			if conn != nil {
-				handleError(conn, http.StatusInternalServerError, errors.New("server error"))
+				handleError(conn, http.StatusInternalServerError, errors.New("server error"), pages)
 			}
 		}
 		if conn != nil {
@@ -273,8 +700,9 @@ func errorhandler(vm *vhost.HTTPMuxer, done <-chan struct{}) {
 	}
 }
 
-// handleError writes an HTTP error response to the connection.
-func handleError(conn net.Conn, code int, err error) {
+// handleError writes an HTTP error response to the connection.  If pages is
+// not nil, the response body is the rendered error page.
+func handleError(conn net.Conn, code int, err error, pages *ErrorPages) {
 	// Create a new HTTP response object.
 	if code == 0 {
 		code = http.StatusInternalServerError
@@ -286,6 +714,16 @@ func handleError(conn net.Conn, code int, err error) {
 		Header:     make(http.Header),
 		Body:       io.NopCloser(strings.NewReader(err.Error())),
 	}
+	if pages != nil {
+		var req *http.Request
+		if hc, ok := conn.(*vhost.HTTPConn); ok {
+			req = hc.Request
+		}
+		body := pages.renderConn(resp.Header, req, code, err)
+		resp.ContentLength = int64(len(body))
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.Close = true
+	}
 
 	// Write the response to the connection.
 	if err := resp.Write(conn); err != nil {
@@ -293,14 +731,21 @@ func handleError(conn net.Conn, code int, err error) {
 	}
 }
 
-// List returns the list of virtual hosts.
+// List returns the list of virtual hosts, sorted by name.
 func (s *Gateway) List() []Host {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var vhosts []Host
+	var (
+		vhosts []Host
+		now    = time.Now()
+	)
 	for _, pw := range s.pws {
-		vhosts = append(vhosts, pw.vhost)
+		h := pw.vhost
+		h.LastSeen = pw.act.lastSeen()
+		h.Dormant = s.isIdle(pw, now)
+		vhosts = append(vhosts, h)
 	}
+	sortHosts(vhosts)
 	return vhosts
 }
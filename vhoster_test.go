@@ -1,6 +1,7 @@
 package vhoster
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -53,3 +54,20 @@ func TestGateway_Exists(t *testing.T) {
 		})
 	}
 }
+
+func TestGateway_List(t *testing.T) {
+	g := testGateway(t,
+		testHost("c.example.com", "http://c:80"),
+		testHost("a.example.com", "http://a:80"),
+		testHost("b.example.com", "http://b:80"),
+	)
+	for i := 0; i < 10; i++ {
+		var names []string
+		for _, h := range g.List() {
+			names = append(names, h.Name)
+		}
+		if got, want := strings.Join(names, ","), "a.example.com,b.example.com,c.example.com"; got != want {
+			t.Fatalf("Gateway.List() = %s, want %s", got, want)
+		}
+	}
+}